@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthenticateAcceptsOnlyAccessTokensForTheRoute(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := &JWKS{keys: map[string]jwksKey{"test": {alg: "EdDSA", pub: pub}}, fetchedAt: time.Now()}
+	sign := func(typ string, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		tok.Header["kid"], tok.Header["typ"] = "test", typ
+		s, err := tok.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	claims := func(aud any, jti string) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "u1", "role": "pacijent", "exp": time.Now().Add(time.Minute).Unix()}
+		if aud != nil {
+			c["aud"] = aud
+		}
+		if jti != "" {
+			c["jti"] = jti
+		}
+		return c
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	route := Route{Prefix: "/api/school", Auth: true, Audience: "school"}
+	r.GET("/api/school/*path", authenticate(jwks, route), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"portal token", sign(accessTokenType, claims([]string{"sso", "school", "health"}, "j1")), http.StatusOK},
+		{"token for the service", sign(accessTokenType, claims("school", "j1")), http.StatusOK},
+		{"token for another service", sign(accessTokenType, claims([]string{"health"}, "j1")), http.StatusUnauthorized},
+		{"OIDC client token", sign(accessTokenType, claims([]string{"userinfo"}, "j1")), http.StatusUnauthorized},
+		{"no audience", sign(accessTokenType, claims(nil, "j1")), http.StatusUnauthorized},
+		{"no jti", sign(accessTokenType, claims([]string{"school"}, "")), http.StatusUnauthorized},
+		{"id_token", sign("JWT", claims("school", "j1")), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/school/grades", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port    string
+	JWKSURL string
+	Routes  []Route
+	// TrustedProxies may set X-Forwarded-For; everyone else is identified by
+	// the connection address for rate limiting.
+	TrustedProxies []string
+	// Token buckets: each client address and each signed-in user gets Burst
+	// requests at once, refilled at RPS per second.
+	IPRPS     float64
+	IPBurst   int
+	UserRPS   float64
+	UserBurst int
+	// MaxBodyBytes caps request bodies; school-service accepts 10 MB uploads,
+	// the rest is room for multipart framing.
+	MaxBodyBytes int64
+	// ShutdownTimeout bounds draining in-flight requests after SIGTERM; the
+	// default stays under Docker's 10s grace period before SIGKILL.
+	ShutdownTimeout time.Duration
+}
+
+func getFloatEnv(key string, def float64) float64 {
+	v := getEnv(key, strconv.FormatFloat(def, 'f', -1, 64))
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		configError("%s: %q is not a positive number", key, v)
+		return def
+	}
+	return f
+}
+
+// defaultRoutes keeps the historical layout: /api/auth and /api/sso go to
+// sso-service, which authenticates on its own, the other services require a
+// valid token at the edge.
+func defaultRoutes() string {
+	sso := getEnv("SSO_SERVICE_URL", "http://sso-service:8080")
+	return "/api/auth=" + sso + ";" +
+		"/api/sso=" + sso + ";" +
+		"/api/school=" + getEnv("SCHOOL_SERVICE_URL", "http://school-service:8080") + " auth;" +
+		"/api/health=" + getEnv("HEALTH_SERVICE_URL", "http://health-service:8080") + " auth"
+}
+
+// getRoutesEnv parses "prefix=upstream [auth[=audience]]; ..." entries. The
+// audience of tokens on an auth route defaults to the last element of its
+// prefix, which names the service: /api/school takes tokens for "school".
+func getRoutesEnv(key string) []Route {
+	var routes []Route
+	for _, entry := range strings.Split(getEnv(key, defaultRoutes()), ";") {
+		f := strings.Fields(entry)
+		if len(f) == 0 {
+			continue
+		}
+		prefix, upstream, ok := strings.Cut(f[0], "=")
+		target, err := url.Parse(upstream)
+		if !ok || !strings.HasPrefix(prefix, "/") || err != nil || target.Host == "" {
+			configError("%s: entry %q must be /prefix=http://host[:port] [auth[=audience]]", key, entry)
+			continue
+		}
+		r := Route{Prefix: strings.TrimSuffix(prefix, "/"), Upstream: target}
+		for _, opt := range f[1:] {
+			name, audience, _ := strings.Cut(opt, "=")
+			if name != "auth" {
+				configError("%s: unknown option %q in %q", key, opt, entry)
+			}
+			if audience == "" {
+				audience = path.Base(r.Prefix)
+			}
+			r.Auth, r.Audience = true, audience
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+func Load() *Config {
+	cfg := &Config{
+		Port:           getEnv("PORT", "8080"),
+		JWKSURL:        getEnv("SSO_JWKS_URL", getEnv("SSO_SERVICE_URL", "http://sso-service:8080")+"/.well-known/jwks.json"),
+		Routes:         getRoutesEnv("GATEWAY_ROUTES"),
+		TrustedProxies: getListEnv("TRUSTED_PROXIES", "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.1/32"),
+		IPRPS:          getFloatEnv("RATE_LIMIT_IP_RPS", 20),
+		IPBurst:        getIntEnv("RATE_LIMIT_IP_BURST", 60),
+		UserRPS:        getFloatEnv("RATE_LIMIT_USER_RPS", 10),
+		UserBurst:      getIntEnv("RATE_LIMIT_USER_BURST", 30),
+		MaxBodyBytes:   int64(getIntEnv("MAX_BODY_MB", 12)) << 20,
+
+		ShutdownTimeout: getDurationEnv("SHUTDOWN_TIMEOUT", 8*time.Second),
+	}
+	finishConfig()
+	for _, r := range cfg.Routes {
+		log.Printf("[config] route %s -> %s (auth=%v, audience=%q)", r.Prefix, r.Upstream, r.Auth, r.Audience)
+	}
+	return cfg
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+// parseRoutes runs getRoutesEnv on value and returns the routes and the
+// configuration errors it reported.
+func parseRoutes(t *testing.T, value string) ([]Route, []error) {
+	t.Helper()
+	t.Setenv("GATEWAY_ROUTES", value)
+	settingsMu.Lock()
+	configErrs = nil
+	settingsMu.Unlock()
+	t.Cleanup(func() { configErrs = nil })
+	routes := getRoutesEnv("GATEWAY_ROUTES")
+	return routes, configErrs
+}
+
+func TestGetRoutesEnv(t *testing.T) {
+	routes, errs := parseRoutes(t, " /api/auth=http://sso:8080 ;/api/school/=http://school:8080 auth;; /zdravlje=http://health:8080 auth=health")
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	want := []struct {
+		prefix, host string
+		auth         bool
+		audience     string
+	}{
+		{"/api/auth", "sso:8080", false, ""},
+		{"/api/school", "school:8080", true, "school"},
+		{"/zdravlje", "health:8080", true, "health"},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("got %d routes, want %d", len(routes), len(want))
+	}
+	for i, w := range want {
+		r := routes[i]
+		if r.Prefix != w.prefix || r.Upstream.Host != w.host || r.Auth != w.auth || r.Audience != w.audience {
+			t.Errorf("route %d = %s -> %s auth=%v audience=%q; want %s -> %s auth=%v audience=%q",
+				i, r.Prefix, r.Upstream.Host, r.Auth, r.Audience, w.prefix, w.host, w.auth, w.audience)
+		}
+	}
+}
+
+func TestGetRoutesEnvRejectsBadEntries(t *testing.T) {
+	for _, entry := range []string{
+		"api/school=http://school:8080",      // prefix without a slash
+		"/api/school",                        // no upstream
+		"/api/school=school:8080",            // upstream without a scheme
+		"/api/school=http://school:8080 tls", // unknown option
+	} {
+		if _, errs := parseRoutes(t, entry); len(errs) != 1 {
+			t.Errorf("%q: got errors %v, want one", entry, errs)
+		}
+	}
+}
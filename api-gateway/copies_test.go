@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// copies lists the files every service keeps its own copy of, with the
+// services that have one. Each service is its own module, vendored and built
+// from its own directory, so the code is copied rather than imported; this
+// test, itself one of the copies, keeps the copies identical.
+var copies = map[string][]string{
+	"copies_test.go": {"sso-service", "school-service", "health-service", "api-gateway"},
+	"settings.go":    {"sso-service", "school-service", "health-service", "api-gateway"},
+	"telemetry.go":   {"sso-service", "school-service", "health-service", "api-gateway"},
+	"logging.go":     {"sso-service", "school-service", "health-service", "api-gateway"},
+	"probes.go":      {"sso-service", "school-service", "health-service", "api-gateway"},
+	"migrate.go":     {"sso-service", "school-service", "health-service"},
+	"errors.go":      {"sso-service", "school-service", "health-service"},
+	"jwks.go":        {"school-service", "health-service", "api-gateway"},
+	"events.go":      {"school-service", "health-service"},
+	"eventbus.go":    {"school-service", "health-service"},
+	"audit.go":       {"school-service", "health-service"},
+	"policy.go":      {"school-service", "health-service"},
+	"sso_client.go":  {"school-service", "health-service"},
+}
+
+func TestCopiesIdentical(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := filepath.Base(wd)
+	for file, services := range copies {
+		if !slices.Contains(services, self) {
+			continue
+		}
+		own, err := os.ReadFile(file)
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		for _, other := range services {
+			if other == self {
+				continue
+			}
+			theirs, err := os.ReadFile(filepath.Join("..", other, file))
+			if os.IsNotExist(err) {
+				continue // built on its own, without the other services
+			}
+			if err != nil {
+				t.Errorf("%s/%s: %v", other, file, err)
+			} else if !bytes.Equal(own, theirs) {
+				t.Errorf("%s differs from %s/%s; change every copy alike", file, other, file)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Route sends every request under Prefix to Upstream with the prefix removed.
+type Route struct {
+	Prefix   string
+	Upstream *url.URL
+	// Auth requires a valid token at the edge, an access token issued for
+	// Audience.
+	Auth     bool
+	Audience string
+}
+
+type ctxKey string
+
+// internalPaths exist on every upstream for operators and are not served
+// through the gateway.
+var internalPaths = map[string]bool{"/metrics": true, "/livez": true, "/readyz": true}
+
+// Proxy builds the reverse proxy for a route once; it is safe for
+// concurrent use and keeps upstream connections alive between requests.
+func (r Route) Proxy() *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Path = strings.TrimPrefix(pr.In.URL.Path, r.Prefix)
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(r.Upstream)
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.SetXForwarded()
+
+			pr.Out.Header.Del(headerUserID)
+			pr.Out.Header.Del(headerUserRole)
+			if userID, _ := pr.In.Context().Value(ctxKey("userID")).(string); userID != "" {
+				pr.Out.Header.Set(headerUserID, userID)
+				role, _ := pr.In.Context().Value(ctxKey("role")).(string)
+				pr.Out.Header.Set(headerUserRole, role)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			status, msg := http.StatusBadGateway, "upstream unavailable"
+			var maxErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxErr):
+				status, msg = http.StatusRequestEntityTooLarge, "request body too large"
+			case errors.Is(err, context.Canceled):
+				// the client went away; nobody reads the response
+				return
+			case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+				status, msg = http.StatusGatewayTimeout, "upstream timed out"
+			}
+			slog.Error("upstream request failed", "method", req.Method, "path", req.URL.Path,
+				"upstream", r.Upstream.Host, "status", status, "error", err)
+			upstreamErrors.WithLabelValues(r.Upstream.Host, strconv.Itoa(status)).Inc()
+			writeJSONError(w, status, msg)
+		},
+		// the otelhttp transport injects traceparent for the upstream
+		Transport: otelhttp.NewTransport(&http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		}),
+	}
+}
+
+// upstreamChecks probe the /readyz of every distinct upstream, so the gateway
+// is only ready when it can serve all of its routes.
+func upstreamChecks(routes []Route) []Check {
+	client := &http.Client{Timeout: probeTimeout}
+	seen := map[string]bool{}
+	var checks []Check
+	for _, route := range routes {
+		target := route.Upstream.JoinPath("/readyz").String()
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		checks = append(checks, Check{Name: route.Upstream.Host, Run: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("%s answered %d", target, resp.StatusCode)
+			}
+			return nil
+		}})
+	}
+	return checks
+}
+
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// forward hands the request to the route's proxy, passing the identity
+// established by authenticate along in the request context.
+func forward(route Route, maxBody int64) gin.HandlerFunc {
+	proxy := route.Proxy()
+	return func(c *gin.Context) {
+		if internalPaths[c.Param("path")] {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "no route for " + c.Request.URL.Path})
+			return
+		}
+		if c.Request.ContentLength > maxBody {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+		ctx := context.WithValue(c.Request.Context(), ctxKey("userID"), c.GetString("userID"))
+		ctx = context.WithValue(ctx, ctxKey("role"), c.GetString("role"))
+		proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForwardStripsPrefixAndIdentityHeaders(t *testing.T) {
+	reached := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached <- r
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	route := Route{Prefix: "/api/school", Upstream: target}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	signedIn := func(c *gin.Context) {
+		if id := c.Query("as"); id != "" {
+			c.Set("userID", id)
+			c.Set("role", "roditelj")
+		}
+	}
+	r.Any(route.Prefix+"/*path", signedIn, forward(route, 1<<20))
+	// a real server, since the reverse proxy needs more than a ResponseRecorder
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+	var got *http.Request // what the upstream received from the last send
+	send := func(path string) int {
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL+path, nil)
+		req.Header.Set(headerUserID, "spoofed")
+		req.Header.Set(headerUserRole, "admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		select {
+		case got = <-reached:
+		default:
+			got = nil
+		}
+		return resp.StatusCode
+	}
+
+	if code := send("/api/school/students"); code != http.StatusOK || got == nil {
+		t.Fatalf("status %d, upstream reached: %v", code, got != nil)
+	}
+	if got.URL.Path != "/students" {
+		t.Errorf("upstream path %q, want /students", got.URL.Path)
+	}
+	if got.Header.Get(headerUserID) != "" || got.Header.Get(headerUserRole) != "" {
+		t.Errorf("client-sent identity reached the upstream: %q %q", got.Header.Get(headerUserID), got.Header.Get(headerUserRole))
+	}
+
+	send("/api/school/students?as=u1")
+	if got.Header.Get(headerUserID) != "u1" || got.Header.Get(headerUserRole) != "roditelj" {
+		t.Errorf("upstream got identity %q %q, want u1 roditelj", got.Header.Get(headerUserID), got.Header.Get(headerUserRole))
+	}
+
+	if code := send("/api/school/metrics"); code != http.StatusNotFound || got != nil {
+		t.Errorf("/metrics: status %d, upstream reached: %v; want 404 at the gateway", code, got != nil)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type bucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+// RateLimiter is a set of token buckets keyed by client address or user.
+// Buckets idle long enough to be full again are dropped.
+type RateLimiter struct {
+	Rate  float64 // tokens per second
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := &RateLimiter{Rate: rate, Burst: burst, buckets: map[string]*bucket{}}
+	go l.sweep()
+	return l
+}
+
+// Allow takes a token for key. When the bucket is empty it reports how long
+// until the next token.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), seen: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.seen).Seconds()*l.Rate)
+	b.seen = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *RateLimiter) sweep() {
+	full := time.Duration(float64(l.Burst)/l.Rate*float64(time.Second)) + time.Minute
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		for k, b := range l.buckets {
+			if time.Since(b.seen) > full {
+				delete(l.buckets, k)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// rateLimit charges one token from the bucket named by key; an empty key
+// (no signed-in user) is not limited here. name labels rejections in metrics.
+func rateLimit(l *RateLimiter, name string, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+		if ok, wait := l.Allow(k); !ok {
+			rateLimited.WithLabelValues(name).Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func clientIPKey(c *gin.Context) string { return "ip:" + c.ClientIP() }
+
+func userKey(c *gin.Context) string {
+	if userID := c.GetString("userID"); userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
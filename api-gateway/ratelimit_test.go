@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestLimiter is a RateLimiter without the sweeping goroutine.
+func newTestLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{Rate: rate, Burst: burst, buckets: map[string]*bucket{}}
+}
+
+// allowed takes up to n tokens for key and returns how many it got.
+func allowed(l *RateLimiter, key string, n int) int {
+	got := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := l.Allow(key); ok {
+			got++
+		}
+	}
+	return got
+}
+
+// age moves the last use of key's bucket into the past, as if d had passed.
+func age(l *RateLimiter, key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[key].seen = l.buckets[key].seen.Add(-d)
+}
+
+func TestRateLimiterRefillsBudget(t *testing.T) {
+	l := newTestLimiter(2, 3)
+	if got := allowed(l, "ip:a", 5); got != 3 {
+		t.Fatalf("first burst: %d allowed, want 3", got)
+	}
+	ok, wait := l.Allow("ip:a")
+	if ok || wait <= 0 || wait > 500*time.Millisecond {
+		t.Errorf("empty bucket: Allow = %v, %v; want false and at most 500ms to wait", ok, wait)
+	}
+
+	age(l, "ip:a", time.Second)
+	if got := allowed(l, "ip:a", 5); got != 2 {
+		t.Errorf("after 1s at 2/s: %d allowed, want 2", got)
+	}
+	// a bucket never holds more than Burst
+	age(l, "ip:a", time.Hour)
+	if got := allowed(l, "ip:a", 5); got != 3 {
+		t.Errorf("after an hour: %d allowed, want 3", got)
+	}
+	if got := allowed(l, "ip:b", 5); got != 3 {
+		t.Errorf("another key: %d allowed, want its own 3", got)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", rateLimit(newTestLimiter(0.5, 1), "test", func(c *gin.Context) string { return c.Query("key") }),
+		func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?key="+key, nil))
+		return w
+	}
+
+	if w := get("u1"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", w.Code)
+	}
+	w := get("u1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request: status %d, Retry-After %q; want 429 and 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 3; i++ {
+		if w := get(""); w.Code != http.StatusOK {
+			t.Errorf("request without a key: status %d, want 200", w.Code)
+		}
+	}
+}
@@ -4,3 +4,12 @@ const authApi = axios.create({ baseURL: '/api/sso' })
 
 export const register = (data) => authApi.post('/register', data)
 export const login = (data) => authApi.post('/login', data)
+export const refresh = (refreshToken) => authApi.post('/refresh', { refresh_token: refreshToken })
+export const logout = (token) =>
+  authApi.post('/logout', {}, { headers: { Authorization: `Bearer ${token}` } })
+export const loginMfa = (data) => authApi.post('/login/mfa', data)
+export const loginMfaEnroll = (mfaToken) => authApi.post('/login/mfa/enroll', { mfa_token: mfaToken })
+export const loginMfaConfirm = (data) => authApi.post('/login/mfa/enroll/confirm', data)
+export const forgotPassword = (email) => authApi.post('/password/forgot', { email })
+export const resetPassword = (data) => authApi.post('/password/reset', data)
+export const verifyEmail = (token) => authApi.post('/email/verify', { token })
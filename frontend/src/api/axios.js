@@ -1,4 +1,5 @@
 import axios from 'axios'
+import { refresh } from './auth'
 
 const api = axios.create({
   baseURL: '/api',
@@ -12,11 +13,45 @@ api.interceptors.request.use((config) => {
   return config
 })
 
+// jedan zajednički refresh za sve zahteve koji istovremeno dobiju 401
+let refreshing = null
+
+function refreshAccessToken() {
+  const refreshToken = localStorage.getItem('refresh_token')
+  if (!refreshToken) {
+    return Promise.reject(new Error('no refresh token'))
+  }
+  if (!refreshing) {
+    refreshing = refresh(refreshToken)
+      .then((res) => {
+        localStorage.setItem('token', res.data.token)
+        localStorage.setItem('refresh_token', res.data.refresh_token)
+        return res.data.token
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
 api.interceptors.response.use(
   (res) => res,
-  (err) => {
+  async (err) => {
+    const original = err.config
+    if (err.response?.status === 401 && original && !original._retry) {
+      original._retry = true
+      try {
+        const token = await refreshAccessToken()
+        original.headers.Authorization = `Bearer ${token}`
+        return api(original)
+      } catch {
+        // refresh nije uspeo, korisnik mora ponovo da se prijavi
+      }
+    }
     if (err.response?.status === 401) {
       localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
       window.location.href = '/login'
     }
     return Promise.reject(err)
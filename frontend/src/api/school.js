@@ -5,6 +5,7 @@ export const createEnrollment = (data) => api.post('/school/enrollments', data)
 export const listEnrollments = () => api.get('/school/enrollments')
 export const getEnrollment = (id) => api.get(`/school/enrollments/${id}`)
 export const updateEnrollmentStatus = (id, data) => api.patch(`/school/enrollments/${id}/status`, data)
+export const attachHealthCertificate = (id, healthCertId) => api.put(`/school/enrollments/${id}/health-certificate`, { health_cert_id: healthCertId })
 
 // Documents
 export const createDocument = (data) => api.post('/school/documents', data)
@@ -30,6 +31,10 @@ export const createAbsence = (data) => api.post('/school/absences', data)
 export const listAbsences = () => api.get('/school/absences')
 export const updateAbsenceStatus = (id, data) => api.patch(`/school/absences/${id}/status`, data)
 
+// Notifications
+export const listNotifications = (params) => api.get('/school/notifications', { params })
+export const markNotificationRead = (id) => api.patch(`/school/notifications/${id}/read`)
+
 // Students / Classes / Subjects
 export const createStudent = (data) => api.post('/school/students', data)
 export const listStudents = () => api.get('/school/students')
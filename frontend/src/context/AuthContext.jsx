@@ -1,4 +1,5 @@
 import React, { createContext, useContext, useState, useEffect } from 'react'
+import { refresh as apiRefresh, logout as apiLogout } from '../api/auth'
 
 const AuthContext = createContext(null)
 
@@ -12,8 +13,14 @@ export function AuthProvider({ children }) {
       try {
         const payload = JSON.parse(atob(token.split('.')[1]))
         if (payload.exp && payload.exp * 1000 < Date.now()) {
+          const refreshToken = localStorage.getItem('refresh_token')
           localStorage.removeItem('token')
           setToken(null)
+          if (refreshToken) {
+            apiRefresh(refreshToken)
+              .then((res) => login(res.data.token, res.data.refresh_token))
+              .catch(() => localStorage.removeItem('refresh_token'))
+          }
         } else {
           setUser({ id: payload.sub, role: payload.role, email: payload.email, firstName: payload.first_name, lastName: payload.last_name })
         }
@@ -25,13 +32,16 @@ export function AuthProvider({ children }) {
     setLoading(false)
   }, [token])
 
-  const login = (newToken) => {
+  const login = (newToken, refreshToken) => {
     try {
       const payload = JSON.parse(atob(newToken.split('.')[1]))
       if (payload.exp && payload.exp * 1000 < Date.now()) {
         return
       }
       localStorage.setItem('token', newToken)
+      if (refreshToken) {
+        localStorage.setItem('refresh_token', refreshToken)
+      }
       setToken(newToken)
       setUser({ id: payload.sub, role: payload.role, email: payload.email, firstName: payload.first_name, lastName: payload.last_name })
     } catch {
@@ -40,7 +50,11 @@ export function AuthProvider({ children }) {
   }
 
   const logout = () => {
+    if (token) {
+      apiLogout(token).catch(() => {})
+    }
     localStorage.removeItem('token')
+    localStorage.removeItem('refresh_token')
     setToken(null)
     setUser(null)
   }
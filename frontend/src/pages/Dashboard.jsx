@@ -1,7 +1,8 @@
-import React from 'react'
+import React, { useEffect, useState } from 'react'
 import { Link } from 'react-router-dom'
 import { useAuth } from '../context/AuthContext'
 import Layout from '../components/Layout'
+import { listNotifications, markNotificationRead } from '../api/school'
 
 const schoolCards = [
   { to: '/school/enrollments', icon: '📋', title: 'Upis u školu', desc: 'Podnošenje i praćenje zahtjeva za upis' },
@@ -46,6 +47,22 @@ const roleLabel = {
 export default function Dashboard() {
   const { user } = useAuth()
   const cards = roleGroups[user?.role] || []
+  const [notifications, setNotifications] = useState([])
+
+  // obaveštenja školskog servisa, npr. izostanak opravdan lekarskim uverenjem
+  useEffect(() => {
+    if (!cards.includes(schoolCards[0])) return
+    listNotifications({ unread: true })
+      .then((res) => setNotifications(res.data || []))
+      .catch(() => { /* school service optional */ })
+  }, [user?.role])
+
+  const handleRead = async (id) => {
+    try {
+      await markNotificationRead(id)
+      setNotifications(notifications.filter((n) => n.id !== id))
+    } catch { /* ostaje nepročitano */ }
+  }
 
   return (
     <Layout>
@@ -58,6 +75,18 @@ export default function Dashboard() {
         </div>
       </div>
 
+      {notifications.length > 0 && (
+        <div className="card">
+          <div className="card-title">Obaveštenja</div>
+          {notifications.map((n) => (
+            <div key={n.id} style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', gap: 12, padding: '6px 0' }}>
+              <span>{n.message}</span>
+              <button className="btn btn-secondary btn-sm" onClick={() => handleRead(n.id)}>Pročitano</button>
+            </div>
+          ))}
+        </div>
+      )}
+
       {cards.length === 0 ? (
         <div className="alert alert-info">
           Vaš nalog ({user?.role}) nije pridružen ni jednom servisu. Kontaktirajte administratora.
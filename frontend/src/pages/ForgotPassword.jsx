@@ -0,0 +1,61 @@
+import React, { useState } from 'react'
+import { Link } from 'react-router-dom'
+import { forgotPassword } from '../api/auth'
+
+export default function ForgotPassword() {
+  const [email, setEmail] = useState('')
+  const [error, setError] = useState('')
+  const [sent, setSent] = useState(false)
+  const [loading, setLoading] = useState(false)
+
+  const handleSubmit = async (e) => {
+    e.preventDefault()
+    setError('')
+    setLoading(true)
+    try {
+      await forgotPassword(email)
+      setSent(true)
+    } catch (err) {
+      setError(err.response?.data?.error || 'Greška pri slanju zahteva.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="auth-page">
+      <div className="auth-card">
+        <div className="auth-logo">
+          <h1>e<span>Uprava</span></h1>
+          <p>Republika Srbija — Portal građana</p>
+        </div>
+        <h2 className="auth-title">Zaboravljena lozinka</h2>
+        {error && <div className="alert alert-error">{error}</div>}
+        {sent ? (
+          <div className="alert alert-success">
+            Ako nalog sa ovom adresom postoji, poslali smo link za promenu lozinke.
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit}>
+            <div className="form-group">
+              <label>Email adresa</label>
+              <input
+                type="email"
+                placeholder="ime@primer.rs"
+                value={email}
+                onChange={(e) => setEmail(e.target.value)}
+                required
+              />
+            </div>
+            <button className="btn btn-primary" style={{ width: '100%', justifyContent: 'center' }} disabled={loading}>
+              {loading ? 'Slanje...' : 'Pošalji link'}
+            </button>
+          </form>
+        )}
+        <div className="auth-footer">
+          <Link to="/login">Nazad na prijavu</Link>
+        </div>
+      </div>
+    </div>
+  )
+}
@@ -1,6 +1,6 @@
 import React, { useState } from 'react'
 import { useNavigate, Link } from 'react-router-dom'
-import { login as apiLogin } from '../api/auth'
+import { login as apiLogin, loginMfa, loginMfaEnroll, loginMfaConfirm } from '../api/auth'
 import { useAuth } from '../context/AuthContext'
 
 export default function Login() {
@@ -9,6 +9,10 @@ export default function Login() {
   const [form, setForm] = useState({ email: '', password: '' })
   const [error, setError] = useState('')
   const [loading, setLoading] = useState(false)
+  // drugi korak prijave: { token, enroll, secret, uri }
+  const [mfa, setMfa] = useState(null)
+  const [code, setCode] = useState('')
+  const [recoveryCodes, setRecoveryCodes] = useState(null)
 
   const handleSubmit = async (e) => {
     e.preventDefault()
@@ -16,7 +20,17 @@ export default function Login() {
     setLoading(true)
     try {
       const res = await apiLogin(form)
-      login(res.data.token)
+      if (res.data.mfa_required) {
+        const step = { token: res.data.mfa_token, enroll: res.data.enroll }
+        if (step.enroll) {
+          const enr = await loginMfaEnroll(step.token)
+          step.secret = enr.data.secret
+          step.uri = enr.data.otpauth_uri
+        }
+        setMfa(step)
+        return
+      }
+      login(res.data.token, res.data.refresh_token)
       navigate('/')
     } catch (err) {
       setError(err.response?.data?.error || 'Greška pri prijavi.')
@@ -25,6 +39,80 @@ export default function Login() {
     }
   }
 
+  const handleMfa = async (e) => {
+    e.preventDefault()
+    setError('')
+    setLoading(true)
+    try {
+      if (mfa.enroll) {
+        const res = await loginMfaConfirm({ mfa_token: mfa.token, code })
+        login(res.data.token, res.data.refresh_token)
+        setRecoveryCodes(res.data.recovery_codes)
+      } else {
+        const res = await loginMfa({ mfa_token: mfa.token, code })
+        login(res.data.token, res.data.refresh_token)
+        navigate('/')
+      }
+    } catch (err) {
+      setError(err.response?.data?.error || 'Pogrešan kod.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  if (recoveryCodes) {
+    return (
+      <div className="auth-page">
+        <div className="auth-card">
+          <h2 className="auth-title">Rezervni kodovi</h2>
+          <div className="alert alert-info">
+            Sačuvajte ove kodove na sigurnom mestu. Svaki kod možete iskoristiti jednom ako izgubite pristup aplikaciji za autentifikaciju.
+          </div>
+          <pre>{recoveryCodes.join('\n')}</pre>
+          <button className="btn btn-primary" style={{ width: '100%', justifyContent: 'center' }} onClick={() => navigate('/')}>
+            Sačuvao sam kodove
+          </button>
+        </div>
+      </div>
+    )
+  }
+
+  if (mfa) {
+    return (
+      <div className="auth-page">
+        <div className="auth-card">
+          <h2 className="auth-title">Dvofaktorska autentifikacija</h2>
+          {error && <div className="alert alert-error">{error}</div>}
+          {mfa.enroll && (
+            <div className="alert alert-info">
+              Za vaš nalog je obavezna dvofaktorska autentifikacija. Dodajte nalog u aplikaciju za autentifikaciju
+              (Google Authenticator, Authy...) pomoću ključa ispod, pa unesite prikazani kod.
+              <pre>{mfa.secret}</pre>
+              <a href={mfa.uri}>Otvori u aplikaciji</a>
+            </div>
+          )}
+          <form onSubmit={handleMfa}>
+            <div className="form-group">
+              <label>{mfa.enroll ? 'Kod iz aplikacije' : 'Kod iz aplikacije ili rezervni kod'}</label>
+              <input
+                type="text"
+                inputMode="numeric"
+                autoComplete="one-time-code"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                required
+                autoFocus
+              />
+            </div>
+            <button className="btn btn-primary" style={{ width: '100%', justifyContent: 'center' }} disabled={loading}>
+              {loading ? 'Provera...' : 'Potvrdi'}
+            </button>
+          </form>
+        </div>
+      </div>
+    )
+  }
+
   return (
     <div className="auth-page">
       <div className="auth-card">
@@ -59,6 +147,9 @@ export default function Login() {
             {loading ? 'Prijava...' : 'Prijavi se'}
           </button>
         </form>
+        <div className="auth-footer">
+          <Link to="/forgot-password">Zaboravili ste lozinku?</Link>
+        </div>
         <div className="auth-footer">
           Nemate nalog? <Link to="/register">Registrujte se</Link>
         </div>
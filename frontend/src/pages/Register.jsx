@@ -27,8 +27,8 @@ export default function Register() {
     setLoading(true)
     try {
       await apiRegister(form)
-      setSuccess('Nalog je kreiran! Preusmjeravamo na prijavu...')
-      setTimeout(() => navigate('/login'), 1500)
+      setSuccess('Nalog je kreiran! Na email smo poslali link za potvrdu adrese. Preusmjeravamo na prijavu...')
+      setTimeout(() => navigate('/login'), 2500)
     } catch (err) {
       setError(err.response?.data?.error || 'Greška pri registraciji.')
     } finally {
@@ -0,0 +1,60 @@
+import React, { useState } from 'react'
+import { useNavigate, useSearchParams, Link } from 'react-router-dom'
+import { resetPassword } from '../api/auth'
+
+export default function ResetPassword() {
+  const navigate = useNavigate()
+  const [params] = useSearchParams()
+  const [password, setPassword] = useState('')
+  const [error, setError] = useState('')
+  const [success, setSuccess] = useState('')
+  const [loading, setLoading] = useState(false)
+
+  const handleSubmit = async (e) => {
+    e.preventDefault()
+    setError('')
+    setLoading(true)
+    try {
+      await resetPassword({ token: params.get('token'), password })
+      setSuccess('Lozinka je promenjena. Preusmjeravamo na prijavu...')
+      setTimeout(() => navigate('/login'), 1500)
+    } catch (err) {
+      setError(err.response?.data?.error || 'Link nije ispravan ili je istekao.')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  return (
+    <div className="auth-page">
+      <div className="auth-card">
+        <div className="auth-logo">
+          <h1>e<span>Uprava</span></h1>
+          <p>Republika Srbija — Portal građana</p>
+        </div>
+        <h2 className="auth-title">Nova lozinka</h2>
+        {error && <div className="alert alert-error">{error}</div>}
+        {success && <div className="alert alert-success">{success}</div>}
+        <form onSubmit={handleSubmit}>
+          <div className="form-group">
+            <label>Nova lozinka</label>
+            <input
+              type="password"
+              placeholder="Minimum 6 karaktera"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              required
+              minLength={6}
+            />
+          </div>
+          <button className="btn btn-primary" style={{ width: '100%', justifyContent: 'center' }} disabled={loading}>
+            {loading ? 'Čuvanje...' : 'Sačuvaj lozinku'}
+          </button>
+        </form>
+        <div className="auth-footer">
+          <Link to="/login">Nazad na prijavu</Link>
+        </div>
+      </div>
+    </div>
+  )
+}
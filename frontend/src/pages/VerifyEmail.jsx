@@ -0,0 +1,34 @@
+import React, { useEffect, useState } from 'react'
+import { useSearchParams, Link } from 'react-router-dom'
+import { verifyEmail } from '../api/auth'
+
+export default function VerifyEmail() {
+  const [params] = useSearchParams()
+  const [status, setStatus] = useState('pending')
+
+  useEffect(() => {
+    verifyEmail(params.get('token'))
+      .then(() => setStatus('ok'))
+      .catch(() => setStatus('error'))
+  }, [params])
+
+  return (
+    <div className="auth-page">
+      <div className="auth-card">
+        <div className="auth-logo">
+          <h1>e<span>Uprava</span></h1>
+          <p>Republika Srbija — Portal građana</p>
+        </div>
+        <h2 className="auth-title">Potvrda email adrese</h2>
+        {status === 'pending' && <div className="alert alert-info">Provera...</div>}
+        {status === 'ok' && (
+          <div className="alert alert-success">Email adresa je potvrđena. Prijavite se ponovo da biste dobili pun pristup.</div>
+        )}
+        {status === 'error' && <div className="alert alert-error">Link nije ispravan ili je istekao.</div>}
+        <div className="auth-footer">
+          <Link to="/login">Nazad na prijavu</Link>
+        </div>
+      </div>
+    </div>
+  )
+}
@@ -155,10 +155,15 @@ export default function Absences() {
                         if (a.document_url?.startsWith('http')) {
                           return <a href={a.document_url} target="_blank" rel="noreferrer">Prikaži</a>
                         }
+                        // potvrda koju osoblje ne vidi u zdravstvu, npr. bolovanje prijavljeno automatski
+                        if (a.document_url) return '🏥 Medicinska potvrda'
                         return '—'
                       })()}
                     </td>
-                    <td><span className={`badge badge-${a.status}`}>{STATUS_LABELS[a.status] || a.status}</span></td>
+                    <td>
+                      <span className={`badge badge-${a.status}`}>{STATUS_LABELS[a.status] || a.status}</span>
+                      {a.health_cert_id && <div style={{ fontSize: 12, color: '#64748b' }}>lekarskim uverenjem</div>}
+                    </td>
                     {isStaff && a.status === 'pending' && (
                       <td style={{ display: 'flex', gap: 6 }}>
                         <button className="btn btn-success btn-sm" onClick={() => handleStatus(a.id, 'approved')}>Opravdaj</button>
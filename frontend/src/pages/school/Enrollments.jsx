@@ -1,10 +1,13 @@
 import React, { useEffect, useState } from 'react'
 import Layout from '../../components/Layout'
 import { useAuth } from '../../context/AuthContext'
-import { createEnrollment, listEnrollments, updateEnrollmentStatus, createStudent, listClasses } from '../../api/school'
+import { createEnrollment, listEnrollments, updateEnrollmentStatus, attachHealthCertificate, listClasses } from '../../api/school'
 import { listMedicalCertificates, getMedicalCertificate } from '../../api/health'
 
-const STATUS_LABELS     = { pending: 'Na čekanju', approved: 'Odobreno', rejected: 'Odbijeno' }
+const STATUS_LABELS     = {
+  submitted: 'Podnet', documents_required: 'Potrebna dokumentacija', under_review: 'U obradi',
+  approved: 'Odobreno', rejected: 'Odbijeno', enrolled: 'Upisan',
+}
 const CERT_TYPE_LABELS  = { sport: 'Za fizičko', bolovanje: 'Bolovanje', opste: 'Opšti pregled', school: 'Za školu' }
 const emptyForm         = { first_name: '', last_name: '', date_of_birth: '', school_year: '', notes: '', health_cert_id: '' }
 
@@ -90,31 +93,15 @@ export default function Enrollments() {
     setTimeout(() => document.getElementById('approve-panel')?.scrollIntoView({ behavior: 'smooth', block: 'start' }), 50)
   }
 
-  // Potvrdi odobravanje
+  // Potvrdi odobravanje — server u istoj transakciji kreira učenika
   const handleApprove = async () => {
     setApproveError('')
-    if (!approveForm.user_id) { setApproveError('User ID učenika je obavezan.'); return }
+    if (!approveForm.user_id)  { setApproveError('User ID učenika je obavezan.'); return }
+    if (!approveForm.class_id) { setApproveError('Razred je obavezan.'); return }
     setApproveSaving(true)
     try {
-      await createStudent({
-        user_id:        approveForm.user_id,
-        first_name:     approvingEnr.first_name,
-        last_name:      approvingEnr.last_name,
-        date_of_birth:  approvingEnr.date_of_birth
-          ? new Date(approvingEnr.date_of_birth).toISOString().split('T')[0]
-          : '',
-        class_id:       approveForm.class_id,
-        parent_user_id: approvingEnr.parent_user_id || '',
-      })
-      // Ažuriraj status samo ako još nije odobren
-      if (approvingEnr.status !== 'approved') {
-        const payload = { status: 'approved' }
-        if (approvingEnr.health_cert_id) {
-          payload.health_cert_verified = true
-          payload.health_cert_id = approvingEnr.health_cert_id
-        }
-        await updateEnrollmentStatus(approvingEnr.id, payload)
-      }
+      // lekarski proverava health-service pri odobravanju
+      await updateEnrollmentStatus(approvingEnr.id, { status: 'approved', user_id: approveForm.user_id, class_id: approveForm.class_id })
       setApprovingEnr(null)
       load()
     } catch (err) {
@@ -122,10 +109,27 @@ export default function Enrollments() {
     } finally { setApproveSaving(false) }
   }
 
-  const handleReject = async (id) => {
-    try { await updateEnrollmentStatus(id, { status: 'rejected' }); load() }
-    catch { setError('Greška pri odbijanju.') }
+  // Ostali prelazi; odbijanje i traženje dokumentacije traže obrazloženje
+  const transition = async (id, status, askReason) => {
+    let reason = ''
+    if (askReason) {
+      reason = window.prompt(askReason) || ''
+      if (!reason.trim()) return
+    }
+    setError('')
+    try { await updateEnrollmentStatus(id, { status, reason }); load() }
+    catch (err) { setError(err.response?.data?.error || 'Greška pri promeni statusa.') }
+  }
+  const handleReject       = (id) => transition(id, 'rejected', 'Razlog odbijanja:')
+
+  // Podnosilac prilaže (novi) lekarski; server ga odmah proverava
+  const handleAttachCert = async (id, certId) => {
+    if (!certId) return
+    setError('')
+    try { await attachHealthCertificate(id, certId); load() }
+    catch (err) { setError(err.response?.data?.error || 'Greška pri prilaganju lekarskog.') }
   }
+  const handleRequireDocs  = (id) => transition(id, 'documents_required', 'Koja dokumentacija nedostaje?')
 
   return (
     <Layout>
@@ -254,14 +258,14 @@ export default function Enrollments() {
               </small>
             </div>
             <div className="form-group">
-              <label>Razred <span style={{ color: '#6b7280', fontSize: 12 }}>(opcionalno)</span></label>
+              <label>Razred <span style={{ color: '#dc2626' }}>*</span></label>
               {classes.length === 0 ? (
                 <div style={{ padding: '10px 12px', background: '#f3f4f6', borderRadius: 6, fontSize: 13, color: '#6b7280', border: '1px solid #e5e7eb' }}>
-                  Nema razreda — možete dodijeliti razred učeniku kasnije.
+                  Nema razreda — prvo kreirajte razred.
                 </div>
               ) : (
                 <select value={approveForm.class_id} onChange={(e) => setApproveForm({ ...approveForm, class_id: e.target.value })}>
-                  <option value="">— Bez razreda (dodijeliti kasnije) —</option>
+                  <option value="">— Odaberite razred —</option>
                   {classes.map((cl) => (
                     <option key={cl.id} value={cl.id}>{cl.name} (god. {cl.year})</option>
                   ))}
@@ -326,6 +330,19 @@ export default function Enrollments() {
                         ) : (
                           <span style={{ color: '#dc2626', fontSize: 13 }}>⚠ Nije priložen</span>
                         )}
+                        {enr.health_cert_verified ? (
+                          <div style={{ color: '#16a34a', fontSize: 12, marginTop: 4 }}>✔ Provereno</div>
+                        ) : enr.health_cert_problem ? (
+                          <div style={{ color: '#dc2626', fontSize: 12, marginTop: 4 }} title={enr.health_cert_problem}>✕ {enr.health_cert_problem}</div>
+                        ) : null}
+                        {canApply && !enr.health_cert_verified && ['submitted', 'documents_required', 'under_review'].includes(enr.status) && activeCerts.length > 0 && (
+                          <select style={{ marginTop: 6, fontSize: 12 }} value="" onChange={(e) => handleAttachCert(enr.id, e.target.value)}>
+                            <option value="">Priloži lekarski…</option>
+                            {activeCerts.map((c) => (
+                              <option key={c.id} value={c.id}>{c.patient_name} — {CERT_TYPE_LABELS[c.type] || c.type}</option>
+                            ))}
+                          </select>
+                        )}
                       </td>
                       <td>
                         <span className={`badge badge-${enr.status}`}>
@@ -334,29 +351,30 @@ export default function Enrollments() {
                       </td>
                       {isAdmin && (
                         <td>
-                          {enr.status === 'pending' ? (
-                            <div style={{ display: 'flex', gap: 6 }}>
-                              <button
-                                className="btn btn-success btn-sm"
-                                onClick={() => startApprove(enr)}
-                              >
-                                Odobri
-                              </button>
+                          {['submitted', 'documents_required', 'under_review'].includes(enr.status) ? (
+                            <div style={{ display: 'flex', gap: 6, flexWrap: 'wrap' }}>
+                              {enr.status === 'under_review' ? (
+                                <button className="btn btn-success btn-sm" onClick={() => startApprove(enr)}>
+                                  Odobri
+                                </button>
+                              ) : (
+                                <button className="btn btn-secondary btn-sm" onClick={() => transition(enr.id, 'under_review')}>
+                                  U obradu
+                                </button>
+                              )}
+                              {enr.status !== 'documents_required' && (
+                                <button className="btn btn-secondary btn-sm" onClick={() => handleRequireDocs(enr.id)}>
+                                  Traži dokumenta
+                                </button>
+                              )}
                               <button className="btn btn-danger btn-sm" onClick={() => handleReject(enr.id)}>
                                 Odbij
                               </button>
                             </div>
                           ) : enr.status === 'approved' ? (
-                            <div style={{ display: 'flex', flexDirection: 'column', gap: 4 }}>
-                              <span style={{ fontSize: 12, color: '#16a34a' }}>✔ Odobren</span>
-                              <button
-                                className="btn btn-secondary btn-sm"
-                                style={{ fontSize: 11 }}
-                                onClick={() => startApprove(enr)}
-                              >
-                                + Kreiraj učenika
-                              </button>
-                            </div>
+                            <button className="btn btn-success btn-sm" onClick={() => transition(enr.id, 'enrolled')}>
+                              ✔ Upiši
+                            </button>
                           ) : '—'}
                         </td>
                       )}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditSnapshot(t *testing.T) {
+	before := HealthRecord{ID: "r1", PatientID: "p1", DoctorID: "d1", Diagnosis: "J45.0 astma", Treatment: "salbutamol", RecordDate: time.Now()}
+	after := before
+	after.Treatment = "budesonid"
+
+	tests := []struct {
+		name          string
+		before, after any
+		want          string
+	}{
+		{"update", before, after, `["treatment"]`},
+		{"unchanged", before, before, `[]`},
+		{"create", nil, after, `["created_at","diagnosis","doctor_id","id","patient_id","record_date","treatment"]`},
+		{"delete", before, nil, `["created_at","diagnosis","doctor_id","id","patient_id","record_date","treatment"]`},
+	}
+	for _, tt := range tests {
+		changed, hash, err := auditSnapshot(tt.before, tt.after)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(changed) != tt.want || len(hash) != 64 {
+			t.Errorf("%s: changed %s, hash %q; want %s and a sha256", tt.name, changed, hash, tt.want)
+		}
+	}
+
+	_, h1, _ := auditSnapshot(before, after)
+	_, h2, _ := auditSnapshot(before, before)
+	if h1 == h2 {
+		t.Error("different changes have the same snapshot hash")
+	}
+}
+
+// TestAuditRecordRedactsClinicalText checks that the log keeps whole records,
+// so that a deleted one can be restored, without their clinical free text.
+func TestAuditRecordRedactsClinicalText(t *testing.T) {
+	record := HealthRecord{ID: "r1", PatientID: "p1", DoctorID: "d1", Diagnosis: "J45.0 astma", Treatment: "", RecordDate: time.Now()}
+	for _, v := range []any{record, &record} {
+		b, err := auditRecord(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got HealthRecord
+		if err = json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := record
+		want.Diagnosis = auditRedacted
+		if !got.RecordDate.Equal(want.RecordDate) || got.ID != want.ID || got.PatientID != want.PatientID ||
+			got.DoctorID != want.DoctorID || got.Diagnosis != want.Diagnosis || got.Treatment != "" {
+			t.Errorf("%T: recorded %s, want %+v", v, b, want)
+		}
+		if strings.Contains(string(b), "astma") {
+			t.Errorf("%T: recorded %s holds the diagnosis", v, b)
+		}
+	}
+
+	// records without clinical text are kept as they are
+	presc := Prescription{ID: "p1", Medication: "amoksicilin", Dosage: "500 mg"}
+	b, _ := auditRecord(presc)
+	if want, _ := json.Marshal(presc); string(b) != string(want) {
+		t.Errorf("recorded %s, want %s", b, want)
+	}
+	if b, err := auditRecord(nil); b != nil || err != nil {
+		t.Errorf("nil recorded as %s, %v", b, err)
+	}
+}
+
+// TestAuditSumOfOlderEntries checks that entries written before snapshot
+// hashes still verify, and that newer ones cover the changed fields.
+func TestAuditSumOfOlderEntries(t *testing.T) {
+	old := AuditEntry{At: time.Now(), Actor: "u1", Action: auditUpdate, Entity: "health_record", EntityID: "r1",
+		Before: json.RawMessage(`{"diagnosis":"J45.0"}`), After: json.RawMessage(`{"diagnosis":"J45.1"}`)}
+	withColumns := old
+	withColumns.Changed = json.RawMessage(`null`)
+	if old.sum() != withColumns.sum() {
+		t.Error("an older entry hashes differently once the new columns are read back")
+	}
+
+	e := AuditEntry{At: time.Now(), Actor: "u1", Action: auditUpdate, Entity: "health_record", EntityID: "r1",
+		Changed: json.RawMessage(`["diagnosis"]`), SnapshotHash: "abc"}
+	tampered := e
+	tampered.Changed = json.RawMessage(`["treatment"]`)
+	if e.sum() == tampered.sum() {
+		t.Error("the hash does not cover the changed fields")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event is a domain event as it travels between services. ID is given when
+// the event is written to the outbox and stays the same on every delivery,
+// so consumers use it to drop duplicates.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Events exchanged between school-service and health-service. Every service
+// on the bus can read an event, so its data holds only what the consumers
+// need, never the whole record.
+const (
+	eventCertificateIssued  = "certificate.issued"
+	eventEnrollmentApproved = "enrollment.approved"
+	eventAbsenceReviewed    = "absence.reviewed"
+)
+
+// Bus carries events from the service that publishes them to every other.
+type Bus interface {
+	// Publish stores e for all consumers; publishing an ID again is a no-op.
+	Publish(ctx context.Context, e Event) error
+	// Subscribe passes events to handle in publication order, starting after
+	// the last one consumer acknowledged. An event is acknowledged when handle
+	// returns nil. Subscribe returns when ctx ends, the bus fails or handle
+	// fails; the failed event is the first one of the next Subscribe.
+	Subscribe(ctx context.Context, consumer string, handle func(context.Context, Event) error) error
+	Close() error
+}
+
+// OutboxEvent is an event written in the transaction of the change it
+// reports; the relay publishes it once the transaction has committed.
+type OutboxEvent struct {
+	ID          int64           `gorm:"primaryKey"`
+	EventID     string          `gorm:"type:uuid;default:gen_random_uuid()"`
+	Type        string          `gorm:"not null"`
+	Data        json.RawMessage `gorm:"type:json;not null"`
+	OccurredAt  time.Time       `gorm:"not null"`
+	PublishedAt *time.Time
+}
+
+func (OutboxEvent) TableName() string { return "outbox" }
+
+// publishEvent writes an event to the outbox in tx, so that it is published
+// if and only if the change commits.
+func publishEvent(tx *gorm.DB, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEvent{Type: eventType, Data: raw, OccurredAt: time.Now().UTC()}).Error
+}
+
+// relayBatch bounds the events one relay transaction publishes.
+const relayBatch = 100
+
+// Relay publishes committed outbox events to the bus in outbox order.
+// Delivery is at least once: an event published just before a crash is
+// published again, and the bus and consumers drop it by ID.
+type Relay struct {
+	DB       *gorm.DB
+	Bus      Bus
+	Source   string
+	Interval time.Duration
+}
+
+// Run relays until ctx ends, draining the outbox every Interval.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.flush(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("outbox relay failed", "error", err)
+				}
+				break
+			}
+			if n < relayBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// flush publishes one batch and marks what was published. The rows stay
+// locked meanwhile, so replicas of the service relay disjoint batches.
+func (r *Relay) flush(ctx context.Context) (int, error) {
+	var published []int64
+	var pubErr error
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var batch []OutboxEvent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").Order("id").Limit(relayBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		for _, o := range batch {
+			e := Event{ID: o.EventID, Type: o.Type, Source: r.Source, OccurredAt: o.OccurredAt, Data: o.Data}
+			if pubErr = r.Bus.Publish(ctx, e); pubErr != nil {
+				break
+			}
+			eventsPublished.WithLabelValues(o.Type).Inc()
+			published = append(published, o.ID)
+		}
+		if len(published) == 0 {
+			return nil
+		}
+		return tx.Model(&OutboxEvent{}).Where("id IN ?", published).Update("published_at", time.Now()).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), pubErr
+}
+
+// startEvents runs the outbox relay and the given consumers in the
+// background. The returned stop is a shutdown cleanup: it waits for them to
+// finish and closes the bus.
+func startEvents(bus Bus, source string, interval time.Duration, consumers ...func(context.Context)) func(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := &Relay{DB: db, Bus: bus, Source: source, Interval: interval}
+	var wg sync.WaitGroup
+	for _, run := range append([]func(context.Context){relay.Run}, consumers...) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx)
+		}()
+	}
+	return func(sctx context.Context) error {
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-sctx.Done():
+		}
+		return bus.Close()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// guardianPatientIDs returns the patient profiles a parent may see: their
+// own and those of their children according to the sso-service guardianships.
+func guardianPatientIDs(c *gin.Context) ([]string, error) {
+	wards, err := sso.Wards(c)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []string{getUserID(c)}
+	for _, w := range wards {
+		userIDs = append(userIDs, w.ID)
+	}
+	var ids []string
+	result := dbFor(c).Model(&Patient{}).Where("user_id IN ?", userIDs).Pluck("id", &ids)
+	return ids, result.Error
+}
+
+// allowedPatients lists the patient profiles the granted scope covers, or
+// reports all when it covers every patient. On failure it writes the
+// response and returns ok false.
+func allowedPatients(c *gin.Context) (ids []string, all, ok bool) {
+	scope := grantedScope(c)
+	if scope.Has(All) {
+		return nil, true, true
+	}
+	var err error
+	switch {
+	case scope.Has(Wards):
+		if ids, err = guardianPatientIDs(c); err != nil {
+			upstreamError(c, "failed to load guardianships", err)
+			return nil, false, false
+		}
+	case scope.Has(Own):
+		if err = dbFor(c).Model(&Patient{}).Where("user_id = ?", getUserID(c)).Pluck("id", &ids).Error; err != nil {
+			serverError(c, err)
+			return nil, false, false
+		}
+	}
+	return ids, false, true
+}
+
+// patientScope restricts column, a patient ID, to the patients the granted
+// scope covers, or to the requested one of them. On failure it writes the
+// response and returns nil.
+func patientScope(c *gin.Context, column, patientID string) func(*gorm.DB) *gorm.DB {
+	ids, all, ok := allowedPatients(c)
+	if !ok {
+		return nil
+	}
+	if all {
+		return func(db *gorm.DB) *gorm.DB {
+			if patientID != "" {
+				return db.Where(column+" = ?", patientID)
+			}
+			return db
+		}
+	}
+	if patientID != "" {
+		if !containsID(ids, patientID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no access to this patient"})
+			return nil
+		}
+		ids = []string{patientID}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN ?", ids)
+	}
+}
+
+// canAccessPatient is patientScope for a single record; on false the
+// response has been written.
+func canAccessPatient(c *gin.Context, patientID string) bool {
+	ids, all, ok := allowedPatients(c)
+	if !ok {
+		return false
+	}
+	if !all && !containsID(ids, patientID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this patient"})
+		return false
+	}
+	return true
+}
+
+// doctorIDs are the doctor profiles of the current user, which an Assigned
+// grant covers.
+func doctorIDs(c *gin.Context) ([]string, error) {
+	var ids []string
+	err := dbFor(c).Model(&Doctor{}).Where("user_id = ?", getUserID(c)).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
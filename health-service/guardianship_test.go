@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scopedContext is a request of userID holding scope on its route.
+func scopedContext(userID string, scope Scope) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("userID", userID)
+	c.Set("scope", scope)
+	return c, w
+}
+
+// scopedSQL is the query scope makes of a listing of health records.
+func scopedSQL(scope func(*gorm.DB) *gorm.DB) string {
+	return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&HealthRecord{}).Scopes(scope).Find(&[]HealthRecord{})
+	})
+}
+
+// TestPatientScopeWithoutPatients covers what needs no rows: All is not
+// narrowed, and a user without a patient profile or wards sees nobody.
+func TestPatientScopeWithoutPatients(t *testing.T) {
+	dryRunDatabase(t)
+	fakeSSO(t, nil)
+
+	c, _ := scopedContext("u1", All)
+	if got := scopedSQL(patientScope(c, "patient_id", "")); strings.Contains(got, "WHERE") {
+		t.Errorf("All: got %s, want every patient", got)
+	}
+	if got := scopedSQL(patientScope(c, "patient_id", "p1")); !strings.Contains(got, `WHERE patient_id = 'p1'`) {
+		t.Errorf("All with a patient: got %s, want that patient", got)
+	}
+
+	for _, scope := range []Scope{Own, Wards, Own | Wards} {
+		c, _ := scopedContext("u1", scope)
+		if got := scopedSQL(patientScope(c, "patient_id", "")); !strings.Contains(got, `WHERE patient_id IN (NULL)`) {
+			t.Errorf("scope %d: got %s, want no patient", scope, got)
+		}
+		c, w := scopedContext("u1", scope)
+		if patientScope(c, "patient_id", "p1") != nil || w.Code != http.StatusForbidden {
+			t.Errorf("scope %d asking for a patient: status %d, want 403", scope, w.Code)
+		}
+	}
+}
+
+// TestRowLevelScopes lists patients, records and appointments as each role
+// and checks that only the rows the role's scope covers come back.
+func TestRowLevelScopes(t *testing.T) {
+	testDatabase(t)
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	r := setupRouter(jwks)
+
+	patientID := func(userID string) string {
+		p := Patient{UserID: userID, FirstName: "Ime", LastName: "Prezime", HealthCardNo: "card-" + userID}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+		return p.ID
+	}
+	parent := patientID("user-roditelj")
+	child := patientID("u-child")
+	self := patientID("user-pacijent")
+	other := patientID("u-other")
+	fakeSSO(t, map[string][]SSOWard{"user-roditelj": {{ID: "u-child", Relation: "roditelj"}}})
+
+	records := map[string]string{}
+	for _, p := range []string{parent, child, self, other} {
+		rec := HealthRecord{PatientID: p, DoctorID: "user-lekar", Diagnosis: "J06.9", RecordDate: time.Now()}
+		if err := db.Create(&rec).Error; err != nil {
+			t.Fatal(err)
+		}
+		records[p] = rec.ID
+	}
+
+	doctorID := func(userID string) string {
+		d := Doctor{UserID: userID, FirstName: "Ime", LastName: "Prezime"}
+		if err := db.Create(&d).Error; err != nil {
+			t.Fatal(err)
+		}
+		return d.ID
+	}
+	doctor, colleague := doctorID("user-lekar"), doctorID("u-colleague")
+	appointment := func(patient, doctor string) string {
+		a := HealthAppointment{PatientID: patient, DoctorID: doctor, DateTime: time.Now(), Type: "pregled"}
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		return a.ID
+	}
+	selfAtDoctor := appointment(self, doctor)
+	otherAtDoctor := appointment(other, doctor)
+	appointment(other, colleague)
+
+	ids := func(role, path string) []string {
+		w := request(r, http.MethodGet, path, sign(userClaims(role)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s as %s: status %d, want 200", path, role, w.Code)
+		}
+		var rows []struct{ ID string }
+		json.Unmarshal(w.Body.Bytes(), &rows)
+		var list []string
+		for _, row := range rows {
+			list = append(list, row.ID)
+		}
+		slices.Sort(list)
+		return list
+	}
+	sorted := func(list ...string) []string {
+		slices.Sort(list)
+		return list
+	}
+
+	tests := []struct {
+		role, path string
+		want       []string
+	}{
+		{"roditelj", "/patients", sorted(parent, child)},
+		{"pacijent", "/patients", sorted(self)},
+		{"lekar", "/patients", sorted(parent, child, self, other)},
+		{"roditelj", "/health-records", sorted(records[parent], records[child])},
+		{"pacijent", "/health-records", sorted(records[self])},
+		{"pacijent", "/appointments", sorted(selfAtDoctor)},
+		{"lekar", "/appointments", sorted(selfAtDoctor, otherAtDoctor)},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.role, tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("%s as %s: got %v, want %v", tt.path, tt.role, got, tt.want)
+		}
+	}
+
+	denied := []struct{ role, path string }{
+		{"roditelj", "/patients/" + other},
+		{"roditelj", "/health-records?patient_id=" + other},
+		{"pacijent", "/patients/" + child},
+		{"pacijent", "/lab-results?patient_id=" + parent},
+	}
+	for _, tt := range denied {
+		if w := request(r, http.MethodGet, tt.path, sign(userClaims(tt.role))); w.Code != http.StatusForbidden {
+			t.Errorf("%s as %s: status %d, want 403", tt.path, tt.role, w.Code)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 1. Elektronsko zakazivanje pregleda
@@ -28,29 +29,29 @@ func createHealthAppointment(c *gin.Context) {
 		return
 	}
 	var patient Patient
-	if result := db.Where("user_id = ?", getUserID(c)).First(&patient); result.Error != nil {
-		// auto-create patient profile from JWT claims
-		claims, _ := c.Get("claims")
-		firstName, lastName := "", ""
-		if m, ok := claims.(map[string]interface{}); ok {
-			if v, ok := m["first_name"].(string); ok {
-				firstName = v
-			}
-			if v, ok := m["last_name"].(string); ok {
-				lastName = v
-			}
+	if result := dbFor(c).Where("user_id = ?", getUserID(c)).First(&patient); result.Error != nil {
+		// auto-create patient profile from the SSO profile
+		me, err := sso.Me(c)
+		if err != nil {
+			upstreamError(c, "failed to load user profile", err)
+			return
 		}
+		firstName, lastName := me.FirstName, me.LastName
 		if firstName == "" {
 			firstName = "Pacijent"
 		}
 		if lastName == "" {
-			if email, ok := claims.(map[string]interface{})["email"].(string); ok {
-				lastName = email
-			}
+			lastName = me.Email
 		}
 		patient = Patient{UserID: getUserID(c), FirstName: firstName, LastName: lastName}
-		if err := db.Create(&patient).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create patient profile: " + err.Error()})
+		err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&patient).Error; err != nil {
+				return err
+			}
+			return audit(c, tx, auditCreate, "patient", patient.ID, nil, patient)
+		})
+		if err != nil {
+			serverError(c, err)
 			return
 		}
 	}
@@ -62,31 +63,37 @@ func createHealthAppointment(c *gin.Context) {
 		Status:    "pending",
 		Notes:     req.Notes,
 	}
-	if result := db.Create(&appt); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&appt).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "appointment", appt.ID, nil, appt)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, appt)
 }
 
 func listHealthAppointments(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var appts []HealthAppointment
-	query := db
-	if role == "pacijent" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		} else {
-			c.JSON(http.StatusOK, []HealthAppointment{})
+	query := dbFor(c)
+	if !grantedScope(c).Has(All) {
+		// the user's own appointments as a patient, and a doctor's bookings
+		patients, _, ok := allowedPatients(c)
+		if !ok {
 			return
 		}
-	} else if role == "lekar" {
-		var doctor Doctor
-		if result := db.Where("user_id = ?", userID).First(&doctor); result.Error == nil {
-			query = query.Where("doctor_id = ?", doctor.ID)
+		var doctors []string
+		if grantedScope(c).Has(Assigned) {
+			var err error
+			if doctors, err = doctorIDs(c); err != nil {
+				serverError(c, err)
+				return
+			}
 		}
+		query = query.Where("patient_id IN ? OR doctor_id IN ?", patients, doctors)
 	}
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
@@ -101,11 +108,6 @@ type UpdateHealthAppointmentStatusRequest struct {
 }
 
 func updateHealthAppointmentStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "administrator" && role != "medicinska_sestra" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdateHealthAppointmentStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -113,18 +115,38 @@ func updateHealthAppointmentStatus(c *gin.Context) {
 		return
 	}
 	var appt HealthAppointment
-	if result := db.First(&appt, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&appt, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
 		return
 	}
+	if !grantedScope(c).Has(All) {
+		doctors, err := doctorIDs(c)
+		if err != nil {
+			serverError(c, err)
+			return
+		}
+		if !containsID(doctors, appt.DoctorID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "appointment is booked with another doctor"})
+			return
+		}
+	}
 	updates := map[string]interface{}{"status": req.Status}
 	if req.Notes != "" {
 		updates["notes"] = req.Notes
 	}
-	if result := db.Model(&appt).Updates(updates); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	before := appt
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&appt).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&appt, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "appointment", id, before, appt)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
-	db.First(&appt, "id = ?", id)
 	c.JSON(http.StatusOK, appt)
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 5. Podnošenje zahteva za zdravstvenu knjižicu
@@ -20,7 +21,7 @@ func createHealthCardRequest(c *gin.Context) {
 		return
 	}
 	var patient Patient
-	if result := db.Where("user_id = ?", getUserID(c)).First(&patient); result.Error != nil {
+	if result := dbFor(c).Where("user_id = ?", getUserID(c)).First(&patient); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "patient profile not found"})
 		return
 	}
@@ -30,24 +31,26 @@ func createHealthCardRequest(c *gin.Context) {
 		Status:      "pending",
 		Notes:       req.Notes,
 	}
-	if result := db.Create(&hcr); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&hcr).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "health_card_request", hcr.ID, nil, hcr)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, hcr)
 }
 
 func listHealthCardRequests(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var requests []HealthCardRequest
-	query := db
-	if role == "pacijent" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		}
+	scope := patientScope(c, "patient_id", "")
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -61,23 +64,32 @@ type UpdateHealthCardStatusRequest struct {
 }
 
 func updateHealthCardRequestStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "administrator" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can update request status"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdateHealthCardStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result := db.Model(&HealthCardRequest{}).Where("id = ?", id).Updates(map[string]interface{}{
-		"status": req.Status,
-		"notes":  req.Notes,
+	var hcr HealthCardRequest
+	if result := dbFor(c).First(&hcr, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "health card request not found"})
+		return
+	}
+	before := hcr
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&hcr).Updates(map[string]interface{}{
+			"status": req.Status,
+			"notes":  req.Notes,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&hcr, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "health_card_request", id, before, hcr)
 	})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "status updated"})
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 4. Uvid u zdravstvene podatke i eKarton
@@ -17,11 +18,6 @@ type CreateHealthRecordRequest struct {
 }
 
 func createHealthRecord(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "medicinska_sestra" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateHealthRecordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -40,27 +36,26 @@ func createHealthRecord(c *gin.Context) {
 		Treatment:  req.Treatment,
 		RecordDate: recDate,
 	}
-	if result := db.Create(&record); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "health_record", record.ID, nil, record)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, record)
 }
 
 func listHealthRecords(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var records []HealthRecord
-	query := db
-	patientID := c.Query("patient_id")
-	if role == "pacijent" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		}
-	} else if patientID != "" {
-		query = query.Where("patient_id = ?", patientID)
+	scope := patientScope(c, "patient_id", c.Query("patient_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	query.Order("record_date desc").Scopes(paginate(c)).Find(&records)
 	c.JSON(http.StatusOK, records)
 }
@@ -75,11 +70,6 @@ type CreateLabResultRequest struct {
 }
 
 func createLabResult(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "medicinska_sestra" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateLabResultRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -98,27 +88,26 @@ func createLabResult(c *gin.Context) {
 		ResultDate: resDate,
 		DoctorID:   getUserID(c),
 	}
-	if result := db.Create(&labResult); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&labResult).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "lab_result", labResult.ID, nil, labResult)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, labResult)
 }
 
 func listLabResults(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var results []LabResult
-	query := db
-	patientID := c.Query("patient_id")
-	if role == "pacijent" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		}
-	} else if patientID != "" {
-		query = query.Where("patient_id = ?", patientID)
+	scope := patientScope(c, "patient_id", c.Query("patient_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	query.Order("result_date desc").Scopes(paginate(c)).Find(&results)
 	c.JSON(http.StatusOK, results)
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Medicinske potvrde (integracija sa školom)
@@ -19,11 +20,6 @@ type CreateMedicalCertificateRequest struct {
 }
 
 func createMedicalCertificate(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only doctors can issue medical certificates"})
-		return
-	}
 	var req CreateMedicalCertificateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -49,27 +45,29 @@ func createMedicalCertificate(c *gin.Context) {
 		Notes:       req.Notes,
 		IssuedAt:    time.Now(),
 	}
-	if result := db.Create(&cert); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cert).Error; err != nil {
+			return err
+		}
+		if err := publishEvent(tx, eventCertificateIssued, certificateIssued(tx, cert)); err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "medical_certificate", cert.ID, nil, cert)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, cert)
 }
 
 func listMedicalCertificates(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var certs []MedicalCertificate
-	query := db
-	patientID := c.Query("patient_id")
-	if role == "pacijent" || role == "ucenik" || role == "roditelj" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		}
-	} else if patientID != "" {
-		query = query.Where("patient_id = ?", patientID)
+	scope := patientScope(c, "patient_id", c.Query("patient_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if certType := c.Query("type"); certType != "" {
 		query = query.Where("type = ?", certType)
 	}
@@ -77,12 +75,68 @@ func listMedicalCertificates(c *gin.Context) {
 	c.JSON(http.StatusOK, certs)
 }
 
+// CertificateView is a certificate with whom it was issued to, which
+// school-service matches against the child being enrolled.
+type CertificateView struct {
+	MedicalCertificate
+	Patient CertificatePatient `json:"patient"`
+}
+
+type CertificatePatient struct {
+	UserID      string    `json:"user_id"`
+	FirstName   string    `json:"first_name"`
+	LastName    string    `json:"last_name"`
+	DateOfBirth time.Time `json:"date_of_birth"`
+}
+
+// CertificateIssued is the certificate.issued event. Every consumer of the
+// bus reads it, so it carries only what school-service needs to find the
+// student and the days to justify: no notes, doctor or free-text name.
+type CertificateIssued struct {
+	ID        string             `json:"id"`
+	PatientID string             `json:"patient_id"`
+	Type      string             `json:"type"`
+	ValidFrom time.Time          `json:"valid_from"`
+	ValidTo   time.Time          `json:"valid_to"`
+	Patient   CertificatePatient `json:"patient"`
+}
+
+func certificateIssued(tx *gorm.DB, cert MedicalCertificate) CertificateIssued {
+	return CertificateIssued{
+		ID:        cert.ID,
+		PatientID: cert.PatientID,
+		Type:      cert.Type,
+		ValidFrom: cert.ValidFrom,
+		ValidTo:   cert.ValidTo,
+		Patient:   certificateView(tx, cert).Patient,
+	}
+}
+
 func getMedicalCertificate(c *gin.Context) {
 	id := c.Param("id")
 	var cert MedicalCertificate
-	if result := db.First(&cert, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&cert, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "certificate not found"})
 		return
 	}
-	c.JSON(http.StatusOK, cert)
+	if !canAccessPatient(c, cert.PatientID) {
+		return
+	}
+	c.JSON(http.StatusOK, certificateView(dbFor(c), cert))
+}
+
+// certificateView adds the patient to cert; it is left empty if the patient
+// record is gone.
+func certificateView(tx *gorm.DB, cert MedicalCertificate) CertificateView {
+	view := CertificateView{MedicalCertificate: cert}
+	var patient Patient
+	if result := tx.First(&patient, "id = ?", cert.PatientID); result.Error == nil {
+		view.Patient = CertificatePatient{
+			UserID:      patient.UserID,
+			FirstName:   patient.FirstName,
+			LastName:    patient.LastName,
+			DateOfBirth: patient.DateOfBirth,
+		}
+	}
+	return view
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 3. Slanje i primanje poruka sa lekarom
@@ -25,8 +26,14 @@ func createMessage(c *gin.Context) {
 		Content:    req.Content,
 		IsRead:     false,
 	}
-	if result := db.Create(&msg); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "message", msg.ID, nil, msg)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, msg)
@@ -40,13 +47,13 @@ func listMessages(c *gin.Context) {
 		return
 	}
 	var msgs []Message
-	db.Where(
+	dbFor(c).Where(
 		"(sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)",
 		userID, otherUserID, otherUserID, userID,
 	).Order("created_at asc").Scopes(paginate(c)).Find(&msgs)
 
 	// Mark incoming messages as read
-	db.Model(&Message{}).
+	dbFor(c).Model(&Message{}).
 		Where("receiver_id = ? AND sender_id = ? AND is_read = false", userID, otherUserID).
 		Update("is_read", true)
 
@@ -57,7 +64,7 @@ func listConversations(c *gin.Context) {
 	userID := getUserID(c)
 	var msgs []Message
 	// Get the latest message per unique conversation partner
-	db.Raw(`
+	dbFor(c).Raw(`
 		SELECT DISTINCT ON (LEAST(sender_id, receiver_id), GREATEST(sender_id, receiver_id))
 		*
 		FROM messages
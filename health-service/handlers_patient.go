@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CreatePatientRequest struct {
@@ -33,8 +34,14 @@ func createPatient(c *gin.Context) {
 		DateOfBirth:  dob,
 		HealthCardNo: req.HealthCardNo,
 	}
-	if result := db.Create(&patient); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&patient).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "patient", patient.ID, nil, patient)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, patient)
@@ -42,12 +49,15 @@ func createPatient(c *gin.Context) {
 
 func getPatient(c *gin.Context) {
 	id := c.Param("id")
+	if id != "me" && !canAccessPatient(c, id) {
+		return
+	}
 	var patient Patient
 	var err error
 	if id == "me" {
-		err = db.Where("user_id = ?", getUserID(c)).First(&patient).Error
+		err = dbFor(c).Where("user_id = ?", getUserID(c)).First(&patient).Error
 	} else {
-		err = db.First(&patient, "id = ?", id).Error
+		err = dbFor(c).First(&patient, "id = ?", id).Error
 	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "patient not found"})
@@ -57,13 +67,12 @@ func getPatient(c *gin.Context) {
 }
 
 func listPatients(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "administrator" && role != "medicinska_sestra" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+	var patients []Patient
+	scope := patientScope(c, "id", "")
+	if scope == nil {
 		return
 	}
-	var patients []Patient
-	db.Scopes(paginate(c)).Find(&patients)
+	dbFor(c).Scopes(scope, paginate(c)).Find(&patients)
 	c.JSON(http.StatusOK, patients)
 }
 
@@ -74,11 +83,6 @@ type CreateDoctorRequest struct {
 }
 
 func createDoctor(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "administrator" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateDoctorRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -90,8 +94,14 @@ func createDoctor(c *gin.Context) {
 		LastName:  req.LastName,
 		Specialty: req.Specialty,
 	}
-	if result := db.Create(&doctor); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doctor).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "doctor", doctor.ID, nil, doctor)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, doctor)
@@ -99,7 +109,7 @@ func createDoctor(c *gin.Context) {
 
 func getMyDoctor(c *gin.Context) {
 	var doctor Doctor
-	if err := db.Where("user_id = ?", getUserID(c)).First(&doctor).Error; err != nil {
+	if err := dbFor(c).Where("user_id = ?", getUserID(c)).First(&doctor).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "doctor profile not found"})
 		return
 	}
@@ -108,7 +118,7 @@ func getMyDoctor(c *gin.Context) {
 
 func listDoctors(c *gin.Context) {
 	var doctors []Doctor
-	query := db
+	query := dbFor(c)
 	if specialty := c.Query("specialty"); specialty != "" {
 		query = query.Where("specialty ILIKE ?", "%"+specialty+"%")
 	}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 2. Pregled izdatih elektronskih recepata
@@ -17,11 +18,6 @@ type CreatePrescriptionRequest struct {
 }
 
 func createPrescription(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only doctors can issue prescriptions"})
-		return
-	}
 	var req CreatePrescriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -36,27 +32,26 @@ func createPrescription(c *gin.Context) {
 		Status:     "active",
 		IssuedAt:   time.Now(),
 	}
-	if result := db.Create(&presc); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&presc).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "prescription", presc.ID, nil, presc)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, presc)
 }
 
 func listPrescriptions(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var prescs []Prescription
-	query := db
-	patientID := c.Query("patient_id")
-	if role == "pacijent" {
-		var patient Patient
-		if result := db.Where("user_id = ?", userID).First(&patient); result.Error == nil {
-			query = query.Where("patient_id = ?", patient.ID)
-		}
-	} else if patientID != "" {
-		query = query.Where("patient_id = ?", patientID)
+	scope := patientScope(c, "patient_id", c.Query("patient_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -69,20 +64,29 @@ type UpdatePrescriptionStatusRequest struct {
 }
 
 func updatePrescriptionStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "lekar" && role != "administrator" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only doctors or admins can update prescription status"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdatePrescriptionStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result := db.Model(&Prescription{}).Where("id = ?", id).Update("status", req.Status)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var presc Prescription
+	if result := dbFor(c).First(&presc, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "prescription not found"})
+		return
+	}
+	before := presc
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&presc).Update("status", req.Status).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&presc, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "prescription", id, before, presc)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "prescription updated"})
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	jwksTTL         = 10 * time.Minute
+	jwksMinInterval = 10 * time.Second
+)
+
+type jwksKey struct {
+	alg string
+	pub crypto.PublicKey
+}
+
+// JWKS fetches and caches the public signing keys published by sso-service.
+// Unknown key IDs trigger a refetch, so key rotation needs no restart here.
+type JWKS struct {
+	URL    string
+	Client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]jwksKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func NewJWKS(url string) *JWKS {
+	return &JWKS{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Keyfunc is a jwt.Keyfunc that resolves the key by the token's kid header.
+func (j *JWKS) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid")
+	}
+	key, ok, stale := j.lookup(kid)
+	if !ok || stale {
+		if err := j.refresh(); err != nil {
+			log.Printf("[jwks] refresh failed: %v", err)
+		}
+		key, ok, _ = j.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if t.Method.Alg() != key.alg {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.pub, nil
+}
+
+// accessTokenType is the typ header of the access tokens sso-service issues
+// (RFC 9068); its id_tokens keep the plain JWT type.
+const accessTokenType = "at+jwt"
+
+// ParseAccessToken verifies an access token issued for audience. id_tokens
+// are refused, and so are tokens without a jti, which could not be revoked.
+func (j *JWKS) ParseAccessToken(token, audience string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	opts = append([]jwt.ParserOption{jwt.WithValidMethods([]string{"EdDSA", "RS256"}), jwt.WithAudience(audience)}, opts...)
+	tok, err := jwt.Parse(token, j.Keyfunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok || !tok.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+	if tok.Header["typ"] != accessTokenType {
+		return nil, errors.New("not an access token")
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, errors.New("token has no jti")
+	}
+	return claims, nil
+}
+
+func (j *JWKS) lookup(kid string) (key jwksKey, ok, stale bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok = j.keys[kid]
+	return key, ok, time.Since(j.fetchedAt) > jwksTTL
+}
+
+func (j *JWKS) refresh() error {
+	j.mu.Lock()
+	if time.Since(j.lastAttempt) < jwksMinInterval {
+		j.mu.Unlock()
+		return nil
+	}
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	resp, err := j.Client.Get(j.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: unexpected status %d", resp.StatusCode)
+	}
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]jwksKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		switch {
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keys[k.Kid] = jwksKey{alg: "EdDSA", pub: ed25519.PublicKey(x)}
+		case k.Kty == "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = jwksKey{alg: "RS256", pub: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}}
+		}
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	jmbgPattern  = regexp.MustCompile(`\b\d{13}\b`)
+)
+
+// sensitiveKeys name attributes that are never logged: free-text medical
+// and school fields, and credentials.
+var sensitiveKeys = map[string]bool{
+	"diagnosis": true, "treatment": true, "medication": true, "dosage": true,
+	"result": true, "notes": true, "content": true, "comment": true, "reason": true,
+	"jmbg": true, "password": true, "secret": true, "token": true, "authorization": true,
+}
+
+// initLogging writes JSON lines to stdout through the redacting handler. The
+// standard log package is routed through it as well, so log.Printf output is
+// structured and redacted too. LOG_LEVEL is debug, info, warn or error.
+func initLogging(service string) {
+	var level slog.Level
+	if v := getEnv("LOG_LEVEL", "info"); level.UnmarshalText([]byte(v)) != nil {
+		configError("LOG_LEVEL: %q is not debug, info, warn or error", v)
+	}
+	h := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr})
+	slog.SetDefault(slog.New(h).With("service", service))
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[redacted]")
+	}
+	switch v := a.Value.Any().(type) {
+	case string:
+		return slog.String(a.Key, redact(v))
+	case error:
+		return slog.String(a.Key, redact(v.Error()))
+	}
+	return a
+}
+
+// redact masks emails and JMBG-like numbers in free text, such as messages
+// and database errors that echo the offending value.
+func redact(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		local, domain, _ := strings.Cut(email, "@")
+		return local[:1] + "***@" + domain
+	})
+	return jmbgPattern.ReplaceAllString(s, "[jmbg]")
+}
+
+// reqLogger returns the default logger with the request's fields. User
+// fields are present once authentication has run.
+func reqLogger(c *gin.Context) *slog.Logger {
+	l := slog.With("request_id", c.GetString("requestID"), "route", c.FullPath())
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+		l = l.With("trace_id", sc.TraceID().String())
+	}
+	if userID := c.GetString("userID"); userID != "" {
+		l = l.With("user_id", userID)
+	}
+	if role := c.GetString("role"); role != "" {
+		l = l.With("role", role)
+	}
+	return l
+}
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"database/sql"
 	"log"
 	"os"
 	"strconv"
@@ -10,43 +11,48 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/opentelemetry/tracing"
 )
 
 var db *gorm.DB
 
 func main() {
-	initDB()
-
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "supersecretkey"
+	initLogging("health-service")
+	shutdown, err := initTracing(context.Background(), "health-service")
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
 	}
+	cfg := Load()
+
+	sqlDB := initDB(cfg)
+	registerMetrics()
 
-	r := setupRouter([]byte(jwtSecret))
+	jwks := NewJWKS(cfg.JWKSURL)
+	sso = NewSSOClient(cfg.SSOURL)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		log.Fatalf("migrations: %v", err)
 	}
-	log.Printf("Health service listening on :%s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal(err)
+	stopEvents := func(context.Context) error { return nil }
+	bus, err := openBus(context.Background(), cfg.EventBus, cfg.EventBusURL)
+	if err != nil {
+		log.Fatalf("event bus: %v", err)
 	}
-}
+	if bus != nil {
+		stopEvents = startEvents(bus, "health-service", cfg.RelayInterval)
+	}
+	// the outbox holds events while the bus is down, so it is no readiness check
+	r := setupRouter(jwks, Check{Name: "database", Run: sqlDB.PingContext}, migrator.ReadyCheck())
 
-func initDB() {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Europe/Belgrade",
-		getEnv("DB_HOST", "localhost"),
-		getEnv("DB_USER", "health_user"),
-		getEnv("DB_PASSWORD", "health_pass"),
-		getEnv("DB_NAME", "health_db"),
-		getEnv("DB_PORT", "5432"),
-	)
+	log.Printf("Health service listening on :%s", cfg.Port)
+	serve(r, cfg.Port, cfg.ShutdownTimeout, shutdown, stopEvents, func(context.Context) error { return sqlDB.Close() })
+}
 
+func initDB(cfg *Config) *sql.DB {
 	var err error
 	for i := 0; i < 10; i++ {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
 		if err == nil {
 			break
 		}
@@ -58,29 +64,36 @@ func initDB() {
 	}
 
 	log.Println("Connected to Health DB")
-	db.Exec("CREATE EXTENSION IF NOT EXISTS pgcrypto")
-
-	if err = db.AutoMigrate(
-		&Patient{},
-		&Doctor{},
-		&HealthAppointment{},
-		&Prescription{},
-		&Message{},
-		&HealthRecord{},
-		&LabResult{},
-		&HealthCardRequest{},
-		&MedicalCertificate{},
-	); err != nil {
-		log.Fatalf("AutoMigrate failed: %v", err)
+	// spans for every query, without bound values: they hold personal data
+	if err = db.Use(tracing.NewPlugin(tracing.WithoutQueryVariables(), tracing.WithoutMetrics())); err != nil {
+		log.Fatalf("Failed to enable DB tracing: %v", err)
 	}
-	log.Println("Health DB schema migrated")
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to get Health DB handle: %v", err)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(sqlDB, os.Args[2:])
+	}
+	if !cfg.MigrateOnStart {
+		return sqlDB
+	}
+	m, err := NewMigrator(sqlDB)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+	n, err := m.Up(context.Background())
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+	log.Printf("Health DB schema migrated (%d new migrations)", n)
+	return sqlDB
 }
 
-func getEnv(key, fallback string) string {
-	if val := os.Getenv(key); val != "" {
-		return val
-	}
-	return fallback
+// dbFor binds the database to the request context, so queries are traced
+// as part of the request.
+func dbFor(c *gin.Context) *gorm.DB {
+	return db.WithContext(c.Request.Context())
 }
 
 func paginate(c *gin.Context) func(*gorm.DB) *gorm.DB {
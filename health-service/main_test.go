@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// testSchema is recreated for every test that needs the database, so tests
+// start empty and never touch the service's own tables.
+const testSchema = "health_test"
+
+// testDatabase points db at a freshly migrated schema of the Postgres
+// database named by TEST_DATABASE_URL, and skips the test without one.
+func testDatabase(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := pgx.ConnectConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{`DROP SCHEMA IF EXISTS ` + testSchema + ` CASCADE`, `CREATE SCHEMA ` + testSchema} {
+		if _, err = conn.Exec(context.Background(), q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close(context.Background())
+
+	cfg.RuntimeParams["search_path"] = testSchema + ", public"
+	sqlDB := stdlib.OpenDB(*cfg)
+	m, err := NewMigrator(sqlDB)
+	if err == nil {
+		_, err = m.Up(context.Background())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	gdb, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = gdb
+	t.Cleanup(func() {
+		db = prev
+		sqlDB.Close()
+	})
+}
+
+// dryRunDatabase points db at a session that builds statements without
+// running them, so every lookup finds nothing.
+func dryRunDatabase(t *testing.T) {
+	t.Helper()
+	dry, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = dry
+	t.Cleanup(func() { db = prev })
+}
+
+// fakeSSO answers /users/me/wards with the wards of the token's subject.
+func fakeSSO(t *testing.T, wards map[string][]SSOWard) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/me/wards" {
+			http.NotFound(w, r)
+			return
+		}
+		claims := jwt.MapClaims{}
+		jwt.NewParser().ParseUnverified(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), claims)
+		sub, _ := claims["sub"].(string)
+		list := wards[sub]
+		if list == nil {
+			list = []SSOWard{}
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+	prev := sso
+	sso = NewSSOClient(srv.URL)
+	t.Cleanup(func() {
+		sso = prev
+		srv.Close()
+	})
+}
@@ -1,15 +1,23 @@
 package main
 
 import (
-	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
+// maxTokenLifetime bounds the tokens accepted here. They are verified without
+// asking the SSO, so a logout or account deactivation reaches this service
+// only when the token expires; the SSO refuses a longer JWT_TTL_MINUTES.
+const maxTokenLifetime = 15 * time.Minute
+
+// AuthMiddleware accepts user tokens and, on routes that name scopes, service
+// tokens holding one of them; either must be an access token for this
+// service. Service tokens set clientID and scopes instead of a user.
+func AuthMiddleware(jwks *JWKS, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authz := c.GetHeader("Authorization")
 		if !strings.HasPrefix(authz, "Bearer ") {
@@ -17,19 +25,27 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 			return
 		}
 		tokenStr := strings.TrimPrefix(authz, "Bearer ")
-		tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
-		if err != nil || !tok.Valid {
+		claims, err := jwks.ParseAccessToken(tokenStr, serviceName, jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
-		claims, ok := tok.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
+		if !withinLifetime(claims) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token lifetime too long"})
+			return
+		}
+		if clientID, ok := claims["client_id"].(string); ok {
+			scope, _ := claims["scope"].(string)
+			granted := strings.Fields(scope)
+			if !grantsAny(granted, scopes) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "service token not accepted for this route"})
+				return
+			}
+			c.Set("clientID", clientID)
+			c.Set("scopes", granted)
+			c.Set("claims", claims)
+			reqLogger(c).Info("audit", "method", c.Request.Method, "path", c.Request.URL.Path, "client_id", clientID)
+			c.Next()
 			return
 		}
 		sub, ok := claims["sub"].(string)
@@ -40,12 +56,96 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 		c.Set("userID", sub)
 		if role, ok := claims["role"].(string); ok {
 			c.Set("role", role)
+			c.Set("roles", []string{role})
+		}
+		if list, ok := claims["roles"].([]interface{}); ok {
+			roles := make([]string, 0, len(list))
+			for _, r := range list {
+				if s, ok := r.(string); ok {
+					roles = append(roles, s)
+				}
+			}
+			c.Set("roles", roles)
+		}
+		if ial, ok := claims["ial"].(float64); ok {
+			c.Set("ial", int(ial))
+		}
+		// tokens issued under a delegation name the principal in sub and the
+		// delegate in act; handlers work with the principal
+		if act, ok := claims["act"].(map[string]interface{}); ok {
+			actor, _ := act["sub"].(string)
+			if actor == "" || !delegatedService(claims) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "delegation does not cover this service"})
+				return
+			}
+			c.Set("actorID", actor)
+			reqLogger(c).Info("audit", "method", c.Request.Method, "path", c.Request.URL.Path,
+				"actor_id", actor, "delegation_id", claims["delegation_id"])
 		}
 		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
+// withinLifetime reports whether the token was issued for at most
+// maxTokenLifetime.
+func withinLifetime(claims jwt.MapClaims) bool {
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return false
+	}
+	exp, err := claims.GetExpirationTime()
+	return err == nil && exp.Sub(iat.Time) <= maxTokenLifetime
+}
+
+// identityVerified is the "ial" claim of accounts whose identity was checked
+// against an ID document at a counter.
+const identityVerified = 2
+
+// RequireVerifiedIdentity guards operations on medical and school records,
+// which must not be reachable by a self-registered account alone.
+func RequireVerifiedIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if getIAL(c) < identityVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "verified identity required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func getIAL(c *gin.Context) int {
+	ial, _ := c.Get("ial")
+	if ial == nil {
+		return 0
+	}
+	return ial.(int)
+}
+
+// serviceName is how token audiences and delegations refer to this service.
+const serviceName = "health"
+
+func delegatedService(claims jwt.MapClaims) bool {
+	list, _ := claims["services"].([]interface{})
+	for _, s := range list {
+		if s == serviceName {
+			return true
+		}
+	}
+	return false
+}
+
+func grantsAny(granted, wanted []string) bool {
+	for _, g := range granted {
+		for _, w := range wanted {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getUserID(c *gin.Context) string {
 	id, _ := c.Get("userID")
 	if id == nil {
@@ -53,11 +153,3 @@ func getUserID(c *gin.Context) string {
 	}
 	return id.(string)
 }
-
-func getRole(c *gin.Context) string {
-	role, _ := c.Get("role")
-	if role == nil {
-		return ""
-	}
-	return role.(string)
-}
\ No newline at end of file
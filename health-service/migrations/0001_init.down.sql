@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS medical_certificates;
+DROP TABLE IF EXISTS health_card_requests;
+DROP TABLE IF EXISTS lab_results;
+DROP TABLE IF EXISTS health_records;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS prescriptions;
+DROP TABLE IF EXISTS health_appointments;
+DROP TABLE IF EXISTS doctors;
+DROP TABLE IF EXISTS patients;
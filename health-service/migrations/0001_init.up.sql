@@ -0,0 +1,107 @@
+-- početna šema, ista kao ona koju je ranije pravio gorm AutoMigrate,
+-- tako da se postojeće baze preuzimaju bez izmena
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS patients (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id VARCHAR(36) NOT NULL,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	date_of_birth TIMESTAMPTZ,
+	health_card_no TEXT,
+	doctor_id UUID,
+	created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_user_id ON patients(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_patients_health_card_no ON patients(health_card_no);
+
+CREATE TABLE IF NOT EXISTS doctors (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id VARCHAR(36) NOT NULL,
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	specialty TEXT,
+	created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_doctors_user_id ON doctors(user_id);
+
+CREATE TABLE IF NOT EXISTS health_appointments (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	doctor_id UUID NOT NULL,
+	date_time TIMESTAMPTZ NOT NULL,
+	type TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	notes TEXT,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_health_appointments_patient_id ON health_appointments(patient_id);
+
+CREATE TABLE IF NOT EXISTS prescriptions (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	doctor_id UUID NOT NULL,
+	medication TEXT NOT NULL,
+	dosage TEXT NOT NULL,
+	duration TEXT,
+	status TEXT NOT NULL DEFAULT 'active',
+	issued_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_prescriptions_patient_id ON prescriptions(patient_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	sender_id VARCHAR(36) NOT NULL,
+	receiver_id VARCHAR(36) NOT NULL,
+	content TEXT NOT NULL,
+	is_read BOOLEAN DEFAULT false,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_messages_sender_id ON messages(sender_id);
+CREATE INDEX IF NOT EXISTS idx_messages_receiver_id ON messages(receiver_id);
+
+CREATE TABLE IF NOT EXISTS health_records (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	doctor_id VARCHAR(36) NOT NULL,
+	diagnosis TEXT NOT NULL,
+	treatment TEXT,
+	record_date TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_health_records_patient_id ON health_records(patient_id);
+
+CREATE TABLE IF NOT EXISTS lab_results (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	test_name TEXT NOT NULL,
+	result TEXT NOT NULL,
+	result_date TIMESTAMPTZ NOT NULL,
+	doctor_id VARCHAR(36),
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_lab_results_patient_id ON lab_results(patient_id);
+
+CREATE TABLE IF NOT EXISTS health_card_requests (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	request_type TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	notes TEXT,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_health_card_requests_patient_id ON health_card_requests(patient_id);
+
+CREATE TABLE IF NOT EXISTS medical_certificates (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	patient_id UUID NOT NULL,
+	patient_name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	valid_from TIMESTAMPTZ NOT NULL,
+	valid_to TIMESTAMPTZ NOT NULL,
+	doctor_id VARCHAR(36) NOT NULL,
+	notes TEXT,
+	issued_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_medical_certificates_patient_id ON medical_certificates(patient_id);
@@ -0,0 +1,12 @@
+-- događaji za druge servise, upisani u istoj transakciji kao i izmena;
+-- relay ih objavljuje na magistralu događaja i beleži vreme objave
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_id UUID NOT NULL DEFAULT gen_random_uuid() UNIQUE,
+	type TEXT NOT NULL,
+	data JSON NOT NULL,
+	occurred_at TIMESTAMPTZ NOT NULL,
+	published_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
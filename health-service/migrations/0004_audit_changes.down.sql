@@ -0,0 +1,2 @@
+ALTER TABLE audit_log DROP COLUMN IF EXISTS snapshot_hash;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS changed;
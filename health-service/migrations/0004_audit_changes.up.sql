@@ -0,0 +1,5 @@
+-- dnevnik ne čuva zapise pre i posle izmene, u kojima su lični i medicinski
+-- podaci, već samo nazive izmenjenih polja i heš oba zapisa; stari redovi
+-- zadržavaju before i after da bi lanac i dalje mogao da se proveri
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS changed JSON;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS snapshot_hash TEXT NOT NULL DEFAULT '';
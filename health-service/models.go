@@ -32,7 +32,7 @@ type HealthAppointment struct {
 	DateTime  time.Time `gorm:"not null" json:"date_time"`
 	Type      string    `gorm:"not null" json:"type"`
 	Status    string    `gorm:"not null;default:'pending'" json:"status"`
-	Notes     string    `json:"notes"`
+	Notes     string    `json:"notes" audit:"redact"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
@@ -54,7 +54,7 @@ type Message struct {
 	ID         string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	SenderID   string    `gorm:"type:varchar(36);not null;index" json:"sender_id"`
 	ReceiverID string    `gorm:"type:varchar(36);not null;index" json:"receiver_id"`
-	Content    string    `gorm:"type:text;not null" json:"content"`
+	Content    string    `gorm:"type:text;not null" json:"content" audit:"redact"`
 	IsRead     bool      `gorm:"default:false" json:"is_read"`
 	CreatedAt  time.Time `json:"created_at"`
 }
@@ -64,8 +64,8 @@ type HealthRecord struct {
 	ID         string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	PatientID  string    `gorm:"type:uuid;not null;index" json:"patient_id"`
 	DoctorID   string    `gorm:"type:varchar(36);not null" json:"doctor_id"`
-	Diagnosis  string    `gorm:"type:text;not null" json:"diagnosis"`
-	Treatment  string    `gorm:"type:text" json:"treatment"`
+	Diagnosis  string    `gorm:"type:text;not null" json:"diagnosis" audit:"redact"`
+	Treatment  string    `gorm:"type:text" json:"treatment" audit:"redact"`
 	RecordDate time.Time `gorm:"not null" json:"record_date"`
 	CreatedAt  time.Time `json:"created_at"`
 }
@@ -75,7 +75,7 @@ type LabResult struct {
 	ID         string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	PatientID  string    `gorm:"type:uuid;not null;index" json:"patient_id"`
 	TestName   string    `gorm:"not null" json:"test_name"`
-	Result     string    `gorm:"type:text;not null" json:"result"`
+	Result     string    `gorm:"type:text;not null" json:"result" audit:"redact"`
 	ResultDate time.Time `gorm:"not null" json:"result_date"`
 	DoctorID   string    `gorm:"type:varchar(36)" json:"doctor_id"`
 	CreatedAt  time.Time `json:"created_at"`
@@ -100,6 +100,6 @@ type MedicalCertificate struct {
 	ValidFrom   time.Time `gorm:"not null" json:"valid_from"`
 	ValidTo     time.Time `gorm:"not null" json:"valid_to"`
 	DoctorID    string    `gorm:"type:varchar(36);not null" json:"doctor_id"`
-	Notes       string    `json:"notes"`
+	Notes       string    `json:"notes" audit:"redact"`
 	IssuedAt    time.Time `json:"issued_at"`
 }
\ No newline at end of file
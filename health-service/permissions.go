@@ -0,0 +1,38 @@
+package main
+
+// policy is who may do what in health-service. Every user can be a patient,
+// so patient-side permissions go to anyRole with Own, which covers the
+// user's own patient profile. Wards adds the profiles of the user's
+// children; Assigned is the doctor an appointment was booked with. "admin"
+// is the platform administrator, "administrator" the health office.
+var policy = Rules{
+	"patients:create": {anyRole: Own},
+	"patients:read":   {anyRole: Own, "roditelj": Wards, "lekar": All, "medicinska_sestra": All, "administrator": All, "admin": All},
+	"doctors:create":  {"lekar": Own, "administrator": All, "admin": All},
+	"doctors:read":    {anyRole: All},
+
+	"appointments:create": {anyRole: Own},
+	"appointments:read":   {anyRole: Own, "lekar": Assigned, "medicinska_sestra": All, "administrator": All, "admin": All},
+	"appointments:review": {"lekar": Assigned, "medicinska_sestra": All, "administrator": All, "admin": All},
+
+	"prescriptions:create": {"lekar": All},
+	"prescriptions:read":   {anyRole: Own, "roditelj": Wards, "lekar": All, "medicinska_sestra": All, "administrator": All, "admin": All},
+	"prescriptions:review": {"lekar": All, "administrator": All, "admin": All},
+
+	"messages:send": {anyRole: Own},
+	"messages:read": {anyRole: Own},
+
+	"health-records:create": {"lekar": All, "medicinska_sestra": All},
+	"health-records:read":   {anyRole: Own, "roditelj": Wards, "lekar": All, "medicinska_sestra": All},
+	"lab-results:create":    {"lekar": All, "medicinska_sestra": All},
+	"lab-results:read":      {anyRole: Own, "roditelj": Wards, "lekar": All, "medicinska_sestra": All},
+
+	"health-cards:create": {anyRole: Own},
+	"health-cards:read":   {anyRole: Own, "roditelj": Wards, "administrator": All, "admin": All},
+	"health-cards:review": {"administrator": All, "admin": All},
+
+	"certificates:create": {"lekar": All},
+	"certificates:read":   {anyRole: Own, "roditelj": Wards, "lekar": All, "medicinska_sestra": All},
+
+	"audit:read": {"administrator": All, "admin": All},
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var roles = []string{"pacijent", "roditelj", "lekar", "medicinska_sestra", "administrator", "admin"}
+
+// patient is the want map of a permission granted to anyRole with s, plus
+// what the staff roles hold on top.
+func patient(s Scope, staff map[string]Scope) map[string]Scope {
+	want := map[string]Scope{}
+	for _, role := range roles {
+		want[role] = s | staff[role]
+	}
+	return want
+}
+
+// routeTests is who can do what on every route: the permission the route
+// requires and the scope each role holds it with. Roles left out are denied.
+var routeTests = []struct {
+	method, path, perm string
+	want               map[string]Scope
+}{
+	{"GET", "/medical-certificates/:id", "certificates:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All})},
+
+	{"POST", "/patients", "patients:create", patient(Own, nil)},
+	{"GET", "/patients", "patients:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All, "administrator": All, "admin": All})},
+	{"GET", "/patients/:id", "patients:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All, "administrator": All, "admin": All})},
+	{"POST", "/doctors", "doctors:create", map[string]Scope{"lekar": Own, "administrator": All, "admin": All}},
+	{"GET", "/doctors/me", "doctors:read", patient(All, nil)},
+	{"GET", "/doctors", "doctors:read", patient(All, nil)},
+
+	{"POST", "/appointments", "appointments:create", patient(Own, nil)},
+	{"GET", "/appointments", "appointments:read", patient(Own, map[string]Scope{"lekar": Assigned, "medicinska_sestra": All, "administrator": All, "admin": All})},
+	{"PATCH", "/appointments/:id/status", "appointments:review", map[string]Scope{"lekar": Assigned, "medicinska_sestra": All, "administrator": All, "admin": All}},
+
+	{"POST", "/prescriptions", "prescriptions:create", map[string]Scope{"lekar": All}},
+	{"GET", "/prescriptions", "prescriptions:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All, "administrator": All, "admin": All})},
+	{"PATCH", "/prescriptions/:id/status", "prescriptions:review", map[string]Scope{"lekar": All, "administrator": All, "admin": All}},
+
+	{"POST", "/messages", "messages:send", patient(Own, nil)},
+	{"GET", "/messages", "messages:read", patient(Own, nil)},
+	{"GET", "/conversations", "messages:read", patient(Own, nil)},
+
+	{"POST", "/health-records", "health-records:create", map[string]Scope{"lekar": All, "medicinska_sestra": All}},
+	{"GET", "/health-records", "health-records:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All})},
+	{"POST", "/lab-results", "lab-results:create", map[string]Scope{"lekar": All, "medicinska_sestra": All}},
+	{"GET", "/lab-results", "lab-results:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All})},
+
+	{"POST", "/health-card-requests", "health-cards:create", patient(Own, nil)},
+	{"GET", "/health-card-requests", "health-cards:read", patient(Own, map[string]Scope{"roditelj": Wards, "administrator": All, "admin": All})},
+	{"PATCH", "/health-card-requests/:id/status", "health-cards:review", map[string]Scope{"administrator": All, "admin": All}},
+
+	{"POST", "/medical-certificates", "certificates:create", map[string]Scope{"lekar": All}},
+	{"GET", "/medical-certificates", "certificates:read", patient(Own, map[string]Scope{"roditelj": Wards, "lekar": All, "medicinska_sestra": All})},
+
+	{"GET", "/audit", "audit:read", map[string]Scope{"administrator": All, "admin": All}},
+	{"GET", "/audit/verify", "audit:read", map[string]Scope{"administrator": All, "admin": All}},
+}
+
+func TestPolicyScopes(t *testing.T) {
+	for _, tt := range routeTests {
+		for _, role := range roles {
+			if got := policy.Scope([]string{role}, tt.perm); got != tt.want[role] {
+				t.Errorf("%s %s: %s holds %s with scope %d, want %d", tt.method, tt.path, role, tt.perm, got, tt.want[role])
+			}
+		}
+	}
+}
+
+func TestPolicyCombinesRoles(t *testing.T) {
+	got := policy.Scope([]string{"lekar", "roditelj"}, "prescriptions:read")
+	if got != Own|Wards|All {
+		t.Errorf("doctor who is a parent: scope %d, want Own|Wards|All", got)
+	}
+	if got := policy.Scope(nil, "prescriptions:create"); got != 0 {
+		t.Errorf("no roles: scope %d, want denied", got)
+	}
+}
+
+// TestRoutesRequirePermission sends each route a request from every role
+// the table denies, and checks that the router refuses it for the listed
+// permission before any handler runs.
+func TestRoutesRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	r := setupRouter(jwks)
+
+	for _, tt := range routeTests {
+		for _, role := range roles {
+			if tt.want[role] != 0 {
+				continue
+			}
+			w := request(r, tt.method, tt.path, sign(userClaims(role)))
+
+			var body struct{ Error string }
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusForbidden || body.Error != "missing permission "+tt.perm {
+				t.Errorf("%s %s as %s: %d %q, want 403 for %s", tt.method, tt.path, role, w.Code, body.Error, tt.perm)
+			}
+		}
+	}
+}
+
+// TestServiceTokens checks that a service token only reaches the route that
+// names its scope, and is granted All there.
+func TestServiceTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	r := setupRouter(jwks)
+
+	tests := []struct {
+		method, path, scope string
+		want                int
+	}{
+		{"GET", "/medical-certificates/:id", "school:documents:read", http.StatusForbidden},
+		{"GET", "/patients", "health:certificates:read", http.StatusForbidden},
+		{"POST", "/prescriptions", "health:certificates:read", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := request(r, tt.method, tt.path, sign(jwt.MapClaims{"client_id": "school-service", "scope": tt.scope}))
+		if w.Code != tt.want {
+			t.Errorf("%s %s with %q: %d, want %d", tt.method, tt.path, tt.scope, w.Code, tt.want)
+		}
+	}
+
+	e := gin.New()
+	e.GET("/", AuthMiddleware(jwks, "health:certificates:read"), RequirePermission("certificates:read"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"scope": grantedScope(c)})
+	})
+	w := request(e, "GET", "/", sign(jwt.MapClaims{"client_id": "school-service", "scope": "health:certificates:read"}))
+	var body struct{ Scope Scope }
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || body.Scope != All {
+		t.Errorf("service token with its scope: %d scope %d, want 200 with All", w.Code, body.Scope)
+	}
+}
+
+// TestTokenLifetime checks that tokens issued for longer than the SSO may
+// issue them are refused, since a deactivation only takes effect on expiry.
+func TestTokenLifetime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	e := gin.New()
+	e.GET("/", AuthMiddleware(jwks), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		iat, exp any
+		want     int
+	}{
+		{"15 minutes", now.Unix(), now.Add(maxTokenLifetime).Unix(), http.StatusOK},
+		{"a day", now.Unix(), now.Add(24 * time.Hour).Unix(), http.StatusUnauthorized},
+		{"issued long ago", now.Add(-time.Hour).Unix(), now.Add(time.Minute).Unix(), http.StatusUnauthorized},
+		{"no iat", nil, now.Add(time.Minute).Unix(), http.StatusUnauthorized},
+		{"no exp", now.Unix(), nil, http.StatusUnauthorized},
+		{"expired", now.Add(-20 * time.Minute).Unix(), now.Add(-10 * time.Minute).Unix(), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		claims := userClaims("pacijent")
+		claims["iat"], claims["exp"] = tt.iat, tt.exp
+		if w := request(e, "GET", "/", sign(claims)); w.Code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+// TestAccessTokensOnly checks that only access tokens issued for this
+// service get in: not id_tokens, nor tokens for another audience or without
+// a jti, which the SSO could not revoke.
+func TestAccessTokensOnly(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	e := gin.New()
+	e.GET("/", AuthMiddleware(jwks), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		change jwt.MapClaims
+		want   int
+	}{
+		{"portal token", jwt.MapClaims{"aud": []string{"sso", "school", "health"}}, http.StatusOK},
+		{"id_token", jwt.MapClaims{"typ": "JWT", "aud": "client-1"}, http.StatusUnauthorized},
+		{"id_token for this service", jwt.MapClaims{"typ": "JWT"}, http.StatusUnauthorized},
+		{"OIDC client token", jwt.MapClaims{"aud": []string{"userinfo"}, "azp": "client-1"}, http.StatusUnauthorized},
+		{"another service", jwt.MapClaims{"aud": []string{"school"}}, http.StatusUnauthorized},
+		{"no audience", jwt.MapClaims{"aud": nil}, http.StatusUnauthorized},
+		{"no jti", jwt.MapClaims{"jti": nil}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		claims := userClaims("pacijent")
+		for k, v := range tt.change {
+			claims[k] = v
+		}
+		if w := request(e, "GET", "/", sign(claims)); w.Code != tt.want {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+// TestEveryRouteHasPolicy keeps routeTests in step with the router.
+func TestEveryRouteHasPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	listed := map[string]bool{}
+	for _, tt := range routeTests {
+		listed[tt.method+" "+tt.path] = true
+	}
+	for _, route := range setupRouter(&JWKS{}).Routes() {
+		switch route.Path {
+		case "/metrics", "/livez", "/readyz", "/health":
+			continue
+		}
+		if !listed[route.Method+" "+route.Path] {
+			t.Errorf("%s %s is missing from routeTests", route.Method, route.Path)
+		}
+	}
+}
+
+func request(h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// userClaims are those of a verified user holding one role.
+func userClaims(role string) jwt.MapClaims {
+	return jwt.MapClaims{"sub": "user-" + role, "role": role, "roles": []string{role}, "ial": identityVerified}
+}
+
+// testJWKS trusts a fresh key and returns a signer for access tokens that
+// are short-lived and for this service unless the claims say otherwise; nil
+// claims are left out, and a typ claim becomes the typ header.
+func testJWKS(t *testing.T) (*JWKS, func(jwt.MapClaims) string) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := &JWKS{keys: map[string]jwksKey{"test": {alg: "EdDSA", pub: pub}}, fetchedAt: time.Now()}
+	return jwks, func(claims jwt.MapClaims) string {
+		if _, ok := claims["iat"]; !ok {
+			claims["iat"] = time.Now().Unix()
+		}
+		if _, ok := claims["exp"]; !ok {
+			claims["exp"] = time.Now().Add(time.Minute).Unix()
+		}
+		if _, ok := claims["aud"]; !ok {
+			claims["aud"] = []string{serviceName}
+		}
+		if _, ok := claims["jti"]; !ok {
+			claims["jti"] = "jti-1"
+		}
+		typ := any(accessTokenType)
+		if v, ok := claims["typ"]; ok {
+			typ = v
+			delete(claims, "typ")
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(claims, k)
+			}
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		tok.Header["kid"], tok.Header["typ"] = "test", typ
+		s, err := tok.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+}
@@ -1,58 +1,66 @@
 package main
 
 import (
-	"net/http"
-
 	"github.com/gin-gonic/gin"
 )
 
-func setupRouter(jwtSecret []byte) *gin.Engine {
-	r := gin.Default()
+func setupRouter(jwks *JWKS, checks ...Check) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), traceRequests("health-service"), requestLog(), measureRequests())
+
+	r.GET("/metrics", metricsHandler())
+	r.GET("/livez", livez("health-service"))
+	r.GET("/readyz", readyz("health-service", checks...))
+	// /health predates the split and answers like /readyz
+	r.GET("/health", readyz("health-service", checks...))
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "health-service"})
-	})
+	// školski servis proverava medicinske potvrde svojim servisnim tokenom
+	r.GET("/medical-certificates/:id", AuthMiddleware(jwks, "health:certificates:read"), RequirePermission("certificates:read"), getMedicalCertificate)
 
-	api := r.Group("", AuthMiddleware(jwtSecret))
+	api := r.Group("", AuthMiddleware(jwks))
+	verified := RequireVerifiedIdentity()
 	{
 		// Profili pacijenata i lekara
-		api.POST("/patients", createPatient)
-		api.GET("/patients", listPatients)
-		api.GET("/patients/:id", getPatient)
-		api.POST("/doctors", createDoctor)
-		api.GET("/doctors/me", getMyDoctor)
-		api.GET("/doctors", listDoctors)
+		api.POST("/patients", RequirePermission("patients:create"), createPatient)
+		api.GET("/patients", RequirePermission("patients:read"), listPatients)
+		api.GET("/patients/:id", RequirePermission("patients:read"), getPatient)
+		api.POST("/doctors", RequirePermission("doctors:create"), createDoctor)
+		api.GET("/doctors/me", RequirePermission("doctors:read"), getMyDoctor)
+		api.GET("/doctors", RequirePermission("doctors:read"), listDoctors)
 
 		// 1. Elektronsko zakazivanje pregleda
-		api.POST("/appointments", createHealthAppointment)
-		api.GET("/appointments", listHealthAppointments)
-		api.PATCH("/appointments/:id/status", updateHealthAppointmentStatus)
+		api.POST("/appointments", RequirePermission("appointments:create"), createHealthAppointment)
+		api.GET("/appointments", RequirePermission("appointments:read"), listHealthAppointments)
+		api.PATCH("/appointments/:id/status", RequirePermission("appointments:review"), updateHealthAppointmentStatus)
 
 		// 2. Pregled izdatih elektronskih recepata
-		api.POST("/prescriptions", createPrescription)
-		api.GET("/prescriptions", listPrescriptions)
-		api.PATCH("/prescriptions/:id/status", updatePrescriptionStatus)
+		api.POST("/prescriptions", verified, RequirePermission("prescriptions:create"), createPrescription)
+		api.GET("/prescriptions", RequirePermission("prescriptions:read"), listPrescriptions)
+		api.PATCH("/prescriptions/:id/status", RequirePermission("prescriptions:review"), updatePrescriptionStatus)
 
 		// 3. Slanje i primanje poruka sa lekarom
-		api.POST("/messages", createMessage)
-		api.GET("/messages", listMessages)
-		api.GET("/conversations", listConversations)
+		api.POST("/messages", RequirePermission("messages:send"), createMessage)
+		api.GET("/messages", RequirePermission("messages:read"), listMessages)
+		api.GET("/conversations", RequirePermission("messages:read"), listConversations)
 
 		// 4. Uvid u zdravstvene podatke i eKarton
-		api.POST("/health-records", createHealthRecord)
-		api.GET("/health-records", listHealthRecords)
-		api.POST("/lab-results", createLabResult)
-		api.GET("/lab-results", listLabResults)
+		api.POST("/health-records", verified, RequirePermission("health-records:create"), createHealthRecord)
+		api.GET("/health-records", verified, RequirePermission("health-records:read"), listHealthRecords)
+		api.POST("/lab-results", verified, RequirePermission("lab-results:create"), createLabResult)
+		api.GET("/lab-results", verified, RequirePermission("lab-results:read"), listLabResults)
 
 		// 5. Zahtev za zdravstvenu knjižicu
-		api.POST("/health-card-requests", createHealthCardRequest)
-		api.GET("/health-card-requests", listHealthCardRequests)
-		api.PATCH("/health-card-requests/:id/status", updateHealthCardRequestStatus)
+		api.POST("/health-card-requests", verified, RequirePermission("health-cards:create"), createHealthCardRequest)
+		api.GET("/health-card-requests", RequirePermission("health-cards:read"), listHealthCardRequests)
+		api.PATCH("/health-card-requests/:id/status", RequirePermission("health-cards:review"), updateHealthCardRequestStatus)
 
 		// Medicinske potvrde (integracija zdravstvo ↔ škola)
-		api.POST("/medical-certificates", createMedicalCertificate)
-		api.GET("/medical-certificates", listMedicalCertificates)
-		api.GET("/medical-certificates/:id", getMedicalCertificate)
+		api.POST("/medical-certificates", verified, RequirePermission("certificates:create"), createMedicalCertificate)
+		api.GET("/medical-certificates", RequirePermission("certificates:read"), listMedicalCertificates)
+
+		// Dnevnik izmena
+		api.GET("/audit", verified, RequirePermission("audit:read"), listAuditEntries)
+		api.GET("/audit/verify", RequirePermission("audit:read"), verifyAuditChain)
 	}
 
 	return r
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerRequestID carries the correlation ID; it is taken from the caller
+// when present, so the gateway's ID follows the request into every service.
+const headerRequestID = "X-Request-ID"
+
+// initTracing installs the global tracer provider. OTEL_TRACES_EXPORTER picks
+// the exporter: "otlp" sends spans over HTTP to OTEL_EXPORTER_OTLP_ENDPOINT,
+// "stdout" prints them for local runs and "none" only propagates context.
+// The returned function flushes buffered spans.
+func initTracing(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch kind := getEnv("OTEL_TRACES_EXPORTER", "none"); kind {
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	case "stdout", "console":
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (use otlp, stdout or none)", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", service)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	slog.Info("exporting spans", "exporter", getEnv("OTEL_TRACES_EXPORTER", "none"))
+	return tp.Shutdown, nil
+}
+
+// probePaths are polled by the container runtime and are not traced.
+var probePaths = map[string]bool{"/health": true, "/livez": true, "/readyz": true}
+
+// traceRequests starts a span per request, continuing the caller's trace
+// from the traceparent header.
+func traceRequests(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+		return !probePaths[r.URL.Path]
+	}))
+}
+
+// requestLog replaces gin's access log with a line that carries the request
+// and trace IDs, so one request can be followed through every service.
+func requestLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		sc := trace.SpanContextFromContext(c.Request.Context())
+		id := c.GetHeader(headerRequestID)
+		if id == "" {
+			id = newRequestID(sc)
+			c.Request.Header.Set(headerRequestID, id)
+		}
+		c.Header(headerRequestID, id)
+		c.Set("requestID", id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("http.request_id", id))
+
+		c.Next()
+
+		reqLogger(c).Info("request", "method", c.Request.Method, "path", c.Request.URL.Path,
+			"status", c.Writer.Status(), "duration_ms", time.Since(start).Milliseconds(), "ip", c.ClientIP())
+	}
+}
+
+// newRequestID reuses the trace ID when there is one, so either ID finds the
+// same request in the logs.
+func newRequestID(sc trace.SpanContext) string {
+	if sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracedTransport propagates the trace context on outgoing calls and records
+// a client span for each.
+func tracedTransport() http.RoundTripper {
+	return otelhttp.NewTransport(http.DefaultTransport)
+}
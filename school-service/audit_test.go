@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestDeletedGradeRestoresFromAudit checks that the log keeps a deleted
+// grade whole, so it can be put back, and that the chain still verifies.
+func TestDeletedGradeRestoresFromAudit(t *testing.T) {
+	testDatabase(t)
+	student := enrolledStudent(t, "user-ucenik", "Ana", "Anić", date("2010-03-04"))
+	subject := Subject{Name: "Matematika", ClassID: student.ClassID}
+	if err := db.Create(&subject).Error; err != nil {
+		t.Fatal(err)
+	}
+	grade := Grade{StudentID: student.ID, SubjectID: subject.ID, Value: 5, GradeDate: date("2026-10-01"),
+		TeacherID: classTeacher, Comment: "pismeni zadatak"}
+	if err := db.Create(&grade).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := scopedContext(classTeacher, All)
+	c.Params = gin.Params{{Key: "id", Value: grade.ID}}
+	deleteGrade(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, %s", w.Code, w.Body)
+	}
+
+	var e AuditEntry
+	if err := db.Where("entity = ? AND entity_id = ?", "grade", grade.ID).First(&e).Error; err != nil {
+		t.Fatal(err)
+	}
+	if e.Action != auditDelete || e.Actor != classTeacher {
+		t.Errorf("entry %+v, want a deletion by %s", e, classTeacher)
+	}
+	var restored Grade
+	if err := json.Unmarshal(e.Before, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&restored).Error; err != nil {
+		t.Fatalf("restoring %s: %v", e.Before, err)
+	}
+	var got Grade
+	if err := db.First(&got, "id = ?", grade.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != grade.Value || got.Comment != grade.Comment || got.TeacherID != grade.TeacherID ||
+		!got.GradeDate.Equal(grade.GradeDate) || !got.CreatedAt.Equal(grade.CreatedAt.Truncate(time.Microsecond)) {
+		t.Errorf("restored %+v, want %+v", got, grade)
+	}
+
+	if v, err := verifyAuditLog(c.Request.Context(), db); err != nil || !v.OK {
+		t.Errorf("chain: %+v, %v", v, err)
+	}
+}
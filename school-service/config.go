@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Config struct {
+	Port string
+	// Database connection; the password may also come from DB_PASSWORD_FILE.
+	DBHost     string
+	DBPort     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	JWKSURL    string
+	SSOURL     string
+	// SSOClientID and SSOClientSecret are the service's own credentials at
+	// sso-service, used to ask health-service for medical certificates.
+	// They are required, since no enrollment is approved without a checked
+	// certificate; the defaults are those of the compose file.
+	SSOClientID     string
+	SSOClientSecret string
+	HealthURL       string
+	// HealthTimeout bounds one call to health-service and HealthAttempts the
+	// tries of a call that timed out or failed with a server error.
+	HealthTimeout  time.Duration
+	HealthAttempts int
+	// CertTypes are the medical certificate types accepted for enrollment.
+	CertTypes []string
+	// SickLeaveTypes are the certificate types that excuse a student from
+	// school; issuing one files an absence justification.
+	SickLeaveTypes []string
+	// EventBus is postgres, memory or off. The postgres bus is the database
+	// at EventBusURL, shared by the services; memory connects nothing and is
+	// for running the service alone. While it is off, events wait in the
+	// outbox.
+	EventBus    string
+	EventBusURL string
+	// RelayInterval is how often committed outbox events are published.
+	RelayInterval time.Duration
+	// MigrateOnStart applies pending migrations before serving; turn it off
+	// when migrations are run separately with "school-service migrate up".
+	MigrateOnStart bool
+	// ShutdownTimeout bounds draining in-flight requests after SIGTERM; the
+	// default stays under Docker's 10s grace period before SIGKILL.
+	ShutdownTimeout time.Duration
+}
+
+func Load() *Config {
+	cfg := &Config{
+		Port:            getEnv("PORT", "8080"),
+		DBHost:          getEnv("DB_HOST", "localhost"),
+		DBPort:          getEnv("DB_PORT", "5432"),
+		DBUser:          getEnv("DB_USER", "school_user"),
+		DBPassword:      getSecret("DB_PASSWORD", "school_pass"),
+		DBName:          getEnv("DB_NAME", "school_db"),
+		JWKSURL:         getEnv("SSO_JWKS_URL", "http://sso-service:8080/.well-known/jwks.json"),
+		SSOURL:          getEnv("SSO_URL", "http://sso-service:8080"),
+		SSOClientID:     getEnv("SSO_CLIENT_ID", "school-service"),
+		SSOClientSecret: getSecret("SSO_CLIENT_SECRET", "dev-school-secret"),
+		HealthURL:       getEnv("HEALTH_URL", "http://health-service:8080"),
+		HealthTimeout:   getDurationEnv("HEALTH_TIMEOUT", 5*time.Second),
+		HealthAttempts:  getIntEnv("HEALTH_ATTEMPTS", 3),
+		CertTypes:       getListEnv("ENROLLMENT_CERT_TYPES", "school"),
+		SickLeaveTypes:  getListEnv("ABSENCE_CERT_TYPES", "bolovanje"),
+		EventBus:        getEnv("EVENT_BUS", "off"),
+		EventBusURL:     getSecret("EVENT_BUS_URL", ""),
+		RelayInterval:   getDurationEnv("EVENT_RELAY_INTERVAL", time.Second),
+		MigrateOnStart:  getBoolEnv("MIGRATE_ON_START", true),
+		ShutdownTimeout: getDurationEnv("SHUTDOWN_TIMEOUT", 8*time.Second),
+	}
+	if cfg.SSOClientID == "" || cfg.SSOClientSecret == "" {
+		configError("SSO_CLIENT_ID and SSO_CLIENT_SECRET are required to check health certificates")
+	}
+	switch cfg.EventBus {
+	case "postgres":
+		if cfg.EventBusURL == "" {
+			configError("EVENT_BUS_URL is required with EVENT_BUS=postgres")
+		}
+	case "memory", "off":
+	default:
+		configError("EVENT_BUS: unknown bus %q, use postgres, memory or off", cfg.EventBus)
+	}
+	finishConfig()
+	return cfg
+}
+
+func (c *Config) DSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Europe/Belgrade",
+		c.DBHost, c.DBUser, c.DBPassword, c.DBName, c.DBPort,
+	)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// enrollmentCertTypes are the medical certificate types accepted for
+// enrollment, from ENROLLMENT_CERT_TYPES.
+var enrollmentCertTypes = []string{"school"}
+
+var errHealthUnavailable = errors.New("health certificate verification is not configured")
+
+// verifyHealthCertificate asks health-service about certID and records on e
+// whether it qualifies for the enrollment, with the time of the check. A
+// certificate that does not qualify is a recorded result, not an error;
+// errors mean health-service or the database could not be reached.
+func verifyHealthCertificate(c *gin.Context, e *Enrollment, certID string) error {
+	if health == nil {
+		return errHealthUnavailable
+	}
+	var problem string
+	now := time.Now()
+	cert, err := health.Certificate(c, certID)
+	if errors.Is(err, ErrCertificateNotFound) || errors.Is(err, ErrInvalidCertificateID) {
+		problem = err.Error()
+	} else if err != nil {
+		return err
+	} else {
+		problem = certificateProblem(*e, cert, now)
+	}
+	// the holder of a verified certificate matches the child by name and
+	// date of birth only, which a namesake can too; it is recorded so that
+	// approval can refuse a holder who is a student already, but the new
+	// student is linked to a patient only by account, on a later certificate
+	var patientID *string
+	if problem == "" && cert.PatientID != "" {
+		patientID = &cert.PatientID
+	}
+	before := *e
+	return dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(e).Updates(map[string]interface{}{
+			"health_cert_id":         certID,
+			"health_cert_verified":   problem == "",
+			"health_cert_checked_at": now,
+			"health_cert_problem":    problem,
+			"health_patient_id":      patientID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.First(e, "id = ?", e.ID).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "enrollment", e.ID, before, *e)
+	})
+}
+
+// certificateProblem says why cert does not qualify for e on the given day,
+// or "" if it does: it must be of an accepted type, valid that day and issued
+// to the child named in the enrollment. Approval checks again, so the day is
+// the enrollment date of every approved enrollment.
+func certificateProblem(e Enrollment, cert HealthCertificate, on time.Time) string {
+	if !slices.Contains(enrollmentCertTypes, cert.Type) {
+		return fmt.Sprintf("certificate type %q is not accepted for enrollment", cert.Type)
+	}
+	day := dateOf(on)
+	if day < dateOf(cert.ValidFrom) || day > dateOf(cert.ValidTo) {
+		return "certificate is not valid on " + day
+	}
+	p := cert.Patient
+	if p.DateOfBirth.IsZero() {
+		return "patient record of the certificate has no date of birth"
+	}
+	if !sameName(p.FirstName, e.FirstName) || !sameName(p.LastName, e.LastName) || dateOf(p.DateOfBirth) != dateOf(e.DateOfBirth) {
+		return "certificate was issued to someone other than the child being enrolled"
+	}
+	return ""
+}
+
+// dateOf is the calendar date of t; dates are stored as midnight UTC.
+func dateOf(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+type AttachHealthCertRequest struct {
+	HealthCertID string `json:"health_cert_id"`
+}
+
+// attachHealthCertificate sets the certificate of an open enrollment and
+// checks it at once; without health_cert_id it checks the current one
+// again. Applicants use it to answer documents_required.
+func attachHealthCertificate(c *gin.Context) {
+	id := c.Param("id")
+	var req AttachHealthCertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var enrollment Enrollment
+	if result := dbFor(c).First(&enrollment, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "enrollment not found"})
+		return
+	}
+	if !ownsRecord(c, enrollment.ParentUserID, "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this enrollment"})
+		return
+	}
+	switch enrollment.Status {
+	case enrollmentSubmitted, enrollmentDocumentsRequired, enrollmentUnderReview:
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "enrollment is already " + enrollment.Status})
+		return
+	}
+	certID := req.HealthCertID
+	if certID == "" {
+		certID = enrollment.HealthCertID
+	}
+	if certID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "health_cert_id is required"})
+		return
+	}
+	if !healthCertChecked(c, &enrollment, certID) {
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// healthCertChecked runs verifyHealthCertificate and answers the request
+// when the check could not be made.
+func healthCertChecked(c *gin.Context, e *Enrollment, certID string) bool {
+	err := verifyHealthCertificate(c, e, certID)
+	if errors.Is(err, errHealthUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return false
+	} else if err != nil {
+		upstreamError(c, "failed to verify health certificate", err)
+		return false
+	}
+	return true
+}
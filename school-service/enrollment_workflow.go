@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Enrollment statuses. A parent or student submits an application, the
+// school office may ask for more documents before reviewing it, and an
+// approved application becomes a student who is then enrolled.
+const (
+	enrollmentSubmitted         = "submitted"
+	enrollmentDocumentsRequired = "documents_required"
+	enrollmentUnderReview       = "under_review"
+	enrollmentApproved          = "approved"
+	enrollmentRejected          = "rejected"
+	enrollmentEnrolled          = "enrolled"
+)
+
+// enrollmentTransitions lists the statuses each status may move to.
+// Rejected and enrolled are final.
+var enrollmentTransitions = map[string][]string{
+	enrollmentSubmitted:         {enrollmentDocumentsRequired, enrollmentUnderReview, enrollmentRejected},
+	enrollmentDocumentsRequired: {enrollmentUnderReview, enrollmentRejected},
+	enrollmentUnderReview:       {enrollmentDocumentsRequired, enrollmentApproved, enrollmentRejected},
+	enrollmentApproved:          {enrollmentEnrolled},
+}
+
+// enrollmentGuards are the conditions for entering a status, checked after
+// the transition itself is allowed. e already reflects a health certificate
+// verified by the same request.
+var enrollmentGuards = map[string]func(e Enrollment, req UpdateEnrollmentStatusRequest) error{
+	enrollmentDocumentsRequired: func(e Enrollment, req UpdateEnrollmentStatusRequest) error {
+		if strings.TrimSpace(req.Reason) == "" {
+			return errors.New("reason must name the missing documents")
+		}
+		return nil
+	},
+	enrollmentApproved: func(e Enrollment, req UpdateEnrollmentStatusRequest) error {
+		if !e.HealthCertVerified && e.HealthCertProblem != "" {
+			return errors.New("approval requires a verified health certificate: " + e.HealthCertProblem)
+		} else if !e.HealthCertVerified {
+			return errors.New("approval requires a verified health certificate")
+		}
+		if req.UserID == "" || req.ClassID == "" {
+			return errors.New("user_id and class_id of the new student are required for approval")
+		}
+		return nil
+	},
+	enrollmentRejected: func(e Enrollment, req UpdateEnrollmentStatusRequest) error {
+		if strings.TrimSpace(req.Reason) == "" {
+			return errors.New("reason is required for rejection")
+		}
+		return nil
+	},
+	enrollmentEnrolled: func(e Enrollment, req UpdateEnrollmentStatusRequest) error {
+		if e.StudentID == nil {
+			return errors.New("enrollment has no student record")
+		}
+		return nil
+	},
+}
+
+// TransitionError is a status change the state machine does not allow.
+type TransitionError struct {
+	From, To string
+	Allowed  []string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("enrollment cannot move from %s to %s", e.From, e.To)
+}
+
+// canMove reports whether the state machine has an edge from one status to
+// another, regardless of guards.
+func canMove(from, to string) bool {
+	return slices.Contains(enrollmentTransitions[from], to)
+}
+
+// checkTransition reports whether e may move to status: a *TransitionError
+// when the state machine has no such edge, or the guard's error.
+func checkTransition(e Enrollment, status string, req UpdateEnrollmentStatusRequest) error {
+	if !canMove(e.Status, status) {
+		return &TransitionError{From: e.Status, To: status, Allowed: enrollmentTransitions[e.Status]}
+	}
+	if guard := enrollmentGuards[status]; guard != nil {
+		return guard(e, req)
+	}
+	return nil
+}
+
+// recordEnrollmentStatus appends to the status history in tx; from is empty
+// for a new enrollment.
+func recordEnrollmentStatus(c *gin.Context, tx *gorm.DB, enrollmentID, from, to, reason string) error {
+	return tx.Create(&EnrollmentStatusChange{
+		EnrollmentID: enrollmentID,
+		FromStatus:   from,
+		ToStatus:     to,
+		Reason:       strings.TrimSpace(reason),
+		ChangedBy:    getUserID(c),
+		ChangedAt:    time.Now(),
+	}).Error
+}
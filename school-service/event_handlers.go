@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EventHandler applies an event from another service in tx.
+type EventHandler func(ctx context.Context, tx *gorm.DB, e Event) error
+
+// eventHandlers are the events school-service consumes; others are
+// acknowledged without being looked at.
+var eventHandlers = map[string]EventHandler{
+	eventCertificateIssued: receiveSickLeave,
+}
+
+// ProcessedEvent records a consumed event, so that a redelivery is skipped.
+type ProcessedEvent struct {
+	EventID     string `gorm:"type:uuid;primaryKey"`
+	Type        string
+	ProcessedAt time.Time
+}
+
+// resubscribeDelay is the pause before an event whose handler failed is
+// tried again.
+const resubscribeDelay = 5 * time.Second
+
+// handleEvent runs the handler of e, if any. The event is handled in one
+// transaction with its ProcessedEvent row, so it takes effect once however
+// often it is delivered.
+func handleEvent(ctx context.Context, e Event) error {
+	h := eventHandlers[e.Type]
+	if h == nil {
+		return nil
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&ProcessedEvent{EventID: e.ID, Type: e.Type, ProcessedAt: time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return h(ctx, tx, e)
+	})
+	if err != nil {
+		eventsConsumed.WithLabelValues(e.Type, "error").Inc()
+		slog.Error("event handler failed", "event", e.ID, "type", e.Type, "source", e.Source, "error", err)
+		return err
+	}
+	eventsConsumed.WithLabelValues(e.Type, "ok").Inc()
+	return nil
+}
+
+// consume runs handleEvent on events from the bus until ctx ends. Events are
+// handled in order: one that keeps failing holds back those after it, and
+// the error is logged on every try.
+func consume(bus Bus, consumer string) func(context.Context) {
+	return func(ctx context.Context) {
+		for {
+			err := bus.Subscribe(ctx, consumer, handleEvent)
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("event subscription stopped, resubscribing", "consumer", consumer, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resubscribeDelay):
+			}
+		}
+	}
+}
+
+// auditFunc records a change made in tx; auditRequest and auditEvent name
+// who made it.
+type auditFunc func(tx *gorm.DB, action, entity, entityID string, before, after any) error
+
+func auditRequest(c *gin.Context) auditFunc {
+	return func(tx *gorm.DB, action, entity, entityID string, before, after any) error {
+		return audit(c, tx, action, entity, entityID, before, after)
+	}
+}
+
+// auditEvent records changes made by an event handler, with the service
+// that published the event as the actor.
+func auditEvent(e Event) auditFunc {
+	return func(tx *gorm.DB, action, entity, entityID string, before, after any) error {
+		entry := AuditEntry{
+			Actor:     e.Source,
+			Role:      "service",
+			Action:    action,
+			Entity:    entity,
+			EntityID:  entityID,
+			RequestID: "event:" + e.ID,
+		}
+		return appendAudit(tx, entry, before, after)
+	}
+}
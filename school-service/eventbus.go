@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// openBus connects the bus named by EVENT_BUS; it is nil when events are off.
+func openBus(ctx context.Context, kind, url string) (Bus, error) {
+	switch kind {
+	case "postgres":
+		return OpenPostgresBus(ctx, url)
+	case "memory":
+		return NewMemoryBus(), nil
+	case "off":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown event bus %q", kind)
+}
+
+// MemoryBus keeps events in the process. It connects no services and is
+// meant for tests and for running one service on its own.
+type MemoryBus struct {
+	mu      sync.Mutex
+	events  []Event
+	ids     map[string]bool
+	cursors map[string]int
+	changed chan struct{} // closed and replaced by every publish
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{ids: map[string]bool{}, cursors: map[string]int{}, changed: make(chan struct{})}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, e Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ids[e.ID] {
+		return nil
+	}
+	b.ids[e.ID] = true
+	b.events = append(b.events, e)
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, consumer string, handle func(context.Context, Event) error) error {
+	for {
+		b.mu.Lock()
+		next, pending, changed := b.cursors[consumer], b.events[b.cursors[consumer]:], b.changed
+		b.mu.Unlock()
+		for i, e := range pending {
+			if err := handle(ctx, e); err != nil {
+				return err
+			}
+			b.mu.Lock()
+			b.cursors[consumer] = next + i + 1
+			b.mu.Unlock()
+		}
+		if len(pending) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (b *MemoryBus) Close() error { return nil }
+
+// busSchema is created by whichever service connects first. Events are
+// numbered in commit order, since publishers take turns (see Publish), so a
+// consumer's cursor is the number of the last event it acknowledged.
+const busSchema = `
+SELECT pg_advisory_xact_lock(hashtext('event bus'));
+CREATE TABLE IF NOT EXISTS events (
+    seq         BIGSERIAL PRIMARY KEY,
+    id          UUID NOT NULL UNIQUE,
+    type        TEXT NOT NULL,
+    source      TEXT NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    data        JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS event_cursors (
+    consumer TEXT PRIMARY KEY,
+    seq      BIGINT NOT NULL
+);`
+
+const (
+	// busBatch bounds the events read per query.
+	busBatch = 100
+	// busPoll is how long a subscriber waits for a notification before
+	// looking for events anyway, in case one was missed while reconnecting.
+	busPoll = 30 * time.Second
+)
+
+// PostgresBus keeps events in a database shared by the services, separate
+// from their own. Publishing notifies the "events" channel and subscribers
+// LISTEN on it, so events arrive without polling; they stay in the table
+// for consumers that were down.
+type PostgresBus struct {
+	pool *pgxpool.Pool
+}
+
+func OpenPostgresBus(ctx context.Context, url string) (*PostgresBus, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	err = pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, busSchema)
+		return err
+	})
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("event bus schema: %w", err)
+	}
+	return &PostgresBus{pool: pool}, nil
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, e Event) error {
+	return pgx.BeginFunc(ctx, b.pool, func(tx pgx.Tx) error {
+		// one publisher at a time, so that seq order is commit order and no
+		// subscriber moves its cursor past an event still being written
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('event bus'))`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO events (id, type, source, occurred_at, data)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO NOTHING`,
+			e.ID, e.Type, e.Source, e.OccurredAt, []byte(e.Data))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `NOTIFY events`)
+		return err
+	})
+}
+
+func (b *PostgresBus) Subscribe(ctx context.Context, consumer string, handle func(context.Context, Event) error) error {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection keeps listening, so it does not go back to the pool
+	listener := conn.Hijack()
+	defer listener.Close(context.Background())
+	if _, err = listener.Exec(ctx, `LISTEN events`); err != nil {
+		return err
+	}
+
+	var seq int64
+	err = b.pool.QueryRow(ctx, `SELECT seq FROM event_cursors WHERE consumer = $1`, consumer).Scan(&seq)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	for {
+		rows, _ := b.pool.Query(ctx, `SELECT seq, id::text, type, source, occurred_at, data
+			FROM events WHERE seq > $1 ORDER BY seq LIMIT $2`, seq, busBatch)
+		var seqs []int64
+		var batch []Event
+		var s int64
+		var e Event
+		_, err = pgx.ForEachRow(rows, []any{&s, &e.ID, &e.Type, &e.Source, &e.OccurredAt, &e.Data}, func() error {
+			seqs, batch = append(seqs, s), append(batch, e)
+			e = Event{} // Data would share its buffer with the next row
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, e := range batch {
+			if err = handle(ctx, e); err != nil {
+				return err
+			}
+			seq = seqs[i]
+			_, err = b.pool.Exec(ctx, `INSERT INTO event_cursors (consumer, seq) VALUES ($1, $2)
+				ON CONFLICT (consumer) DO UPDATE SET seq = EXCLUDED.seq`, consumer, seq)
+			if err != nil {
+				return err
+			}
+		}
+		if len(batch) == busBatch {
+			continue
+		}
+		wait, cancel := context.WithTimeout(ctx, busPoll)
+		_, err = listener.WaitForNotification(wait)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+	}
+}
+
+func (b *PostgresBus) Close() error {
+	b.pool.Close()
+	return nil
+}
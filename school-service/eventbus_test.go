@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// busTestSchema holds the tables of the Postgres bus under test, apart from
+// the service's own test schema.
+const busTestSchema = "school_bus_test"
+
+// testBuses runs test on a memory bus and on a Postgres bus; the latter is
+// skipped without TEST_DATABASE_URL.
+func testBuses(t *testing.T, test func(t *testing.T, bus Bus)) {
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryBus()) })
+	t.Run("postgres", func(t *testing.T) { test(t, testPostgresBus(t)) })
+}
+
+// testPostgresBus opens a Postgres bus on an empty busTestSchema of the
+// database named by TEST_DATABASE_URL.
+func testPostgresBus(t *testing.T) Bus {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{`DROP SCHEMA IF EXISTS ` + busTestSchema + ` CASCADE`, `CREATE SCHEMA ` + busTestSchema} {
+		if _, err = conn.Exec(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close(ctx)
+
+	// the URL may be a postgres:// URL or key=value settings
+	switch {
+	case !strings.Contains(url, "://"):
+		url += " search_path=" + busTestSchema
+	case strings.Contains(url, "?"):
+		url += "&search_path=" + busTestSchema
+	default:
+		url += "?search_path=" + busTestSchema
+	}
+	bus, err := OpenPostgresBus(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+// eventIDs are the IDs of the events the tests publish by name; the
+// Postgres bus keeps IDs as UUIDs.
+var eventIDs = map[string]string{
+	"a":    "7f1c2a9e-0b4d-4c6e-9a1f-3d5b7c9e1a01",
+	"b":    "7f1c2a9e-0b4d-4c6e-9a1f-3d5b7c9e1a02",
+	"c":    "7f1c2a9e-0b4d-4c6e-9a1f-3d5b7c9e1a03",
+	"late": "7f1c2a9e-0b4d-4c6e-9a1f-3d5b7c9e1a04",
+}
+
+// named returns the IDs of the named events.
+func named(names ...string) []string {
+	ids := make([]string, len(names))
+	for i, name := range names {
+		ids[i] = eventIDs[name]
+	}
+	return ids
+}
+
+// collect subscribes consumer and returns the IDs of the events it receives
+// until handle has seen n of them or fails.
+func collect(t *testing.T, bus Bus, consumer string, n int, fail string) ([]string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got []string
+	errDone := errors.New("done")
+	err := bus.Subscribe(ctx, consumer, func(_ context.Context, e Event) error {
+		if e.ID == fail {
+			return errors.New("handler failed")
+		}
+		got = append(got, e.ID)
+		if len(got) == n {
+			return errDone
+		}
+		return nil
+	})
+	if errors.Is(err, errDone) {
+		err = nil
+	}
+	return got, err
+}
+
+// publish publishes events of the given names, stopping the test on error.
+func publish(t *testing.T, bus Bus, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		e := Event{ID: eventIDs[name], Type: eventCertificateIssued, Source: "health-service",
+			OccurredAt: time.Now(), Data: []byte(`{}`)}
+		if err := bus.Publish(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBusDeliversInOrderOnce(t *testing.T) {
+	testBuses(t, func(t *testing.T, bus Bus) {
+		publish(t, bus, "a", "b", "a", "c")
+		got, err := collect(t, bus, "school-service", 3, "")
+		if want := named("a", "b", "c"); err != nil || !slices.Equal(got, want) {
+			t.Errorf("got %v, %v; want %v", got, err, want)
+		}
+		// another consumer starts from the beginning
+		got, err = collect(t, bus, "other", 1, "")
+		if want := named("a"); err != nil || !slices.Equal(got, want) {
+			t.Errorf("second consumer got %v, %v; want %v", got, err, want)
+		}
+	})
+}
+
+func TestBusRedeliversFailedEvent(t *testing.T) {
+	testBuses(t, func(t *testing.T, bus Bus) {
+		publish(t, bus, "a", "b", "c")
+		got, err := collect(t, bus, "school-service", 3, eventIDs["b"])
+		if want := named("a"); err == nil || !slices.Equal(got, want) {
+			t.Fatalf("got %v, %v; want %v and the handler's error", got, err, want)
+		}
+		// a is acknowledged; b comes again
+		got, err = collect(t, bus, "school-service", 2, "")
+		if want := named("b", "c"); err != nil || !slices.Equal(got, want) {
+			t.Errorf("after failure got %v, %v; want %v", got, err, want)
+		}
+	})
+}
+
+func TestBusWaitsForEvents(t *testing.T) {
+	testBuses(t, func(t *testing.T, bus Bus) {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			e := Event{ID: eventIDs["late"], Type: eventCertificateIssued, OccurredAt: time.Now(), Data: []byte(`{}`)}
+			bus.Publish(context.Background(), e)
+		}()
+		got, err := collect(t, bus, "school-service", 1, "")
+		if want := named("late"); err != nil || !slices.Equal(got, want) {
+			t.Errorf("got %v, %v; want %v", got, err, want)
+		}
+	})
+}
+
+// TestRelayPublishesCommittedEventsOnce checks that the relay publishes the
+// outbox events of committed transactions only, and that publishing them
+// again, as after a crash before they were marked, delivers nothing new.
+func TestRelayPublishesCommittedEventsOnce(t *testing.T) {
+	testDatabase(t)
+	testBuses(t, func(t *testing.T, bus Bus) {
+		if err := db.Exec(`DELETE FROM outbox`).Error; err != nil {
+			t.Fatal(err)
+		}
+		db.Transaction(func(tx *gorm.DB) error {
+			if err := publishEvent(tx, eventCertificateIssued, map[string]string{"id": "rolled back"}); err != nil {
+				t.Fatal(err)
+			}
+			return errors.New("rollback")
+		})
+		for _, id := range []string{"c1", "c2"} {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return publishEvent(tx, eventCertificateIssued, map[string]string{"id": id})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		relay := &Relay{DB: db, Bus: bus, Source: "school-service", Interval: time.Hour}
+		ctx := context.Background()
+		for i, want := range []int{2, 0} {
+			if n, err := relay.flush(ctx); err != nil || n != want {
+				t.Fatalf("flush %d: published %d, %v; want %d", i+1, n, err, want)
+			}
+		}
+		var outbox []OutboxEvent
+		if err := db.Order("id").Find(&outbox).Error; err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, o := range outbox {
+			if o.PublishedAt == nil {
+				t.Errorf("outbox event %d is not marked published", o.ID)
+			}
+			want = append(want, o.EventID)
+		}
+		got, err := collect(t, bus, "school-service", 2, "")
+		if err != nil || !slices.Equal(got, want) {
+			t.Fatalf("got %v, %v; want %v", got, err, want)
+		}
+
+		if err := db.Model(&OutboxEvent{}).Where("true").Update("published_at", nil).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n, err := relay.flush(ctx); err != nil || n != 2 {
+			t.Fatalf("flush after crash: published %d, %v; want 2", n, err)
+		}
+		if got, _ := collect(t, bus, "school-service", 1, ""); len(got) != 0 {
+			t.Errorf("republished events delivered again: %v", got)
+		}
+	})
+}
+
+// TestAbsenceReviewedEvent checks that reviewing an absence publishes the
+// decision without the reason the parent gave.
+func TestAbsenceReviewedEvent(t *testing.T) {
+	testDatabase(t)
+	student := enrolledStudent(t, "user-ucenik", "Ana", "Anić", date("2010-03-04"))
+	absence := AbsenceJustification{StudentID: student.ID, StartDate: date("2026-10-05"), EndDate: date("2026-10-06"),
+		Reason: "upala pluća", Status: "pending"}
+	if err := db.Create(&absence).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c, w := scopedContext(classTeacher, All)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"status":"approved"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: absence.ID}}
+	updateAbsenceStatus(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("review: status %d, %s", w.Code, w.Body)
+	}
+
+	var o OutboxEvent
+	if err := db.Where("type = ?", eventAbsenceReviewed).First(&o).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got AbsenceReviewed
+	if err := json.Unmarshal(o.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.AbsenceID != absence.ID || got.StudentID != student.ID || got.Status != "approved" ||
+		!got.StartDate.Equal(absence.StartDate) || !got.EndDate.Equal(absence.EndDate) || got.ReviewedAt.IsZero() {
+		t.Errorf("event %s", o.Data)
+	}
+	if strings.Contains(string(o.Data), "upala") {
+		t.Errorf("event %s holds the reason", o.Data)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// wardStudentIDs returns the students a parent may act for: their children
+// according to the sso-service guardianships, and students that still name
+// the parent in parent_user_id from before guardianships existed.
+func wardStudentIDs(c *gin.Context) ([]string, error) {
+	wards, err := sso.Wards(c)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]string, 0, len(wards))
+	for _, w := range wards {
+		userIDs = append(userIDs, w.ID)
+	}
+	var ids []string
+	query := dbFor(c).Model(&Student{}).Where("parent_user_id = ?", getUserID(c))
+	if len(userIDs) > 0 {
+		query = query.Or("user_id IN ?", userIDs)
+	}
+	result := query.Pluck("id", &ids)
+	return ids, result.Error
+}
+
+// allowedStudents lists the students the granted scope covers, or reports
+// all when it covers every student. On failure it writes the response and
+// returns ok false.
+func allowedStudents(c *gin.Context) (ids []string, all, ok bool) {
+	scope := grantedScope(c)
+	if scope.Has(All) {
+		return nil, true, true
+	}
+	if scope.Has(Wards) {
+		wards, err := wardStudentIDs(c)
+		if err != nil {
+			upstreamError(c, "failed to load guardianships", err)
+			return nil, false, false
+		}
+		ids = append(ids, wards...)
+	}
+	if scope.Has(Own) {
+		var own []string
+		if err := dbFor(c).Model(&Student{}).Where("user_id = ?", getUserID(c)).Pluck("id", &own).Error; err != nil {
+			serverError(c, err)
+			return nil, false, false
+		}
+		ids = append(ids, own...)
+	}
+	return ids, false, true
+}
+
+// studentScope restricts column, a student ID, to the students the granted
+// scope covers, or to the requested one of them. On failure it writes the
+// response and returns nil.
+func studentScope(c *gin.Context, column, studentID string) func(*gorm.DB) *gorm.DB {
+	ids, all, ok := allowedStudents(c)
+	if !ok {
+		return nil
+	}
+	if all {
+		return func(db *gorm.DB) *gorm.DB {
+			if studentID != "" {
+				return db.Where(column+" = ?", studentID)
+			}
+			return db
+		}
+	}
+	if studentID != "" {
+		if !containsID(ids, studentID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "no access to this student"})
+			return nil
+		}
+		ids = []string{studentID}
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(column+" IN ?", ids)
+	}
+}
+
+// canAccessStudent is studentScope for a single record; on false the
+// response has been written.
+func canAccessStudent(c *gin.Context, studentID string) bool {
+	ids, all, ok := allowedStudents(c)
+	if !ok {
+		return false
+	}
+	if !all && !containsID(ids, studentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this student"})
+		return false
+	}
+	return true
+}
+
+// userScope restricts records linked to users by column: ownColumn names
+// the user an Own grant covers, assignedColumn the staff member an Assigned
+// grant covers.
+func userScope(c *gin.Context, ownColumn, assignedColumn string) func(*gorm.DB) *gorm.DB {
+	scope, userID := grantedScope(c), getUserID(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if scope.Has(All) {
+			return db
+		}
+		var conds []string
+		var args []interface{}
+		if scope.Has(Own) && ownColumn != "" {
+			conds, args = append(conds, ownColumn+" = ?"), append(args, userID)
+		}
+		if scope.Has(Assigned) && assignedColumn != "" {
+			conds, args = append(conds, assignedColumn+" = ?"), append(args, userID)
+		}
+		if len(conds) == 0 {
+			return db.Where("1 = 0")
+		}
+		return db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+}
+
+// ownsRecord is userScope for a single record.
+func ownsRecord(c *gin.Context, ownerID, assigneeID string) bool {
+	scope, userID := grantedScope(c), getUserID(c)
+	return scope.Has(All) ||
+		scope.Has(Own) && ownerID == userID ||
+		scope.Has(Assigned) && assigneeID == userID
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
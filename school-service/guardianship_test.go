@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scopedContext is a request of userID holding scope on its route.
+func scopedContext(userID string, scope Scope) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("userID", userID)
+	c.Set("scope", scope)
+	return c, w
+}
+
+// scopedSQL is the query scope makes of a listing of students.
+func scopedSQL(scope func(*gorm.DB) *gorm.DB) string {
+	return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&Student{}).Scopes(scope).Find(&[]Student{})
+	})
+}
+
+func TestOwnsRecord(t *testing.T) {
+	tests := []struct {
+		scope           Scope
+		owner, assignee string
+		want            bool
+	}{
+		{Own, "u1", "u2", true},
+		{Own, "u2", "u1", false},
+		{Assigned, "u2", "u1", true},
+		{Assigned, "u1", "u2", false},
+		{Own | Assigned, "u2", "u1", true},
+		{Own | Assigned, "u2", "u3", false},
+		{Wards, "u1", "u1", false},
+		{All, "u2", "u3", true},
+	}
+	for _, tt := range tests {
+		c, _ := scopedContext("u1", tt.scope)
+		if got := ownsRecord(c, tt.owner, tt.assignee); got != tt.want {
+			t.Errorf("scope %d, owner %s, assignee %s: got %v, want %v", tt.scope, tt.owner, tt.assignee, got, tt.want)
+		}
+	}
+}
+
+func TestUserScope(t *testing.T) {
+	dryRunDatabase(t)
+	tests := []struct {
+		scope Scope
+		want  string
+	}{
+		{Own, `WHERE (requester_id = 'u1')`},
+		{Assigned, `WHERE (staff_id = 'u1')`},
+		{Own | Assigned, `WHERE (requester_id = 'u1' OR staff_id = 'u1')`},
+		{Wards, `WHERE 1 = 0`},
+		{All, ``},
+	}
+	for _, tt := range tests {
+		c, _ := scopedContext("u1", tt.scope)
+		got := scopedSQL(userScope(c, "requester_id", "staff_id"))
+		if tt.want == "" && strings.Contains(got, "WHERE") || !strings.Contains(got, tt.want) {
+			t.Errorf("scope %d: got %s, want %s", tt.scope, got, tt.want)
+		}
+	}
+}
+
+// TestStudentScopeWithoutStudents covers what needs no rows: All is not
+// narrowed, and a user who is no student and has no wards sees nobody.
+func TestStudentScopeWithoutStudents(t *testing.T) {
+	dryRunDatabase(t)
+	fakeSSO(t, nil)
+
+	c, _ := scopedContext("u1", All)
+	if got := scopedSQL(studentScope(c, "id", "")); strings.Contains(got, "WHERE") {
+		t.Errorf("All: got %s, want every student", got)
+	}
+	if got := scopedSQL(studentScope(c, "id", "s1")); !strings.Contains(got, `WHERE id = 's1'`) {
+		t.Errorf("All with a student: got %s, want that student", got)
+	}
+
+	for _, scope := range []Scope{Own, Wards, Own | Wards} {
+		c, _ := scopedContext("u1", scope)
+		if got := scopedSQL(studentScope(c, "id", "")); !strings.Contains(got, `WHERE id IN (NULL)`) {
+			t.Errorf("scope %d: got %s, want no student", scope, got)
+		}
+		c, w := scopedContext("u1", scope)
+		if studentScope(c, "id", "s1") != nil || w.Code != http.StatusForbidden {
+			t.Errorf("scope %d asking for a student: status %d, want 403", scope, w.Code)
+		}
+	}
+}
+
+// TestRowLevelScopes lists students and appointments as each role and
+// checks that only the rows the role's scope covers come back.
+func TestRowLevelScopes(t *testing.T) {
+	testDatabase(t)
+	gin.SetMode(gin.TestMode)
+	jwks, sign := testJWKS(t)
+	r := setupRouter(jwks)
+
+	class := Class{Name: "I-1", Year: 1}
+	if err := db.Create(&class).Error; err != nil {
+		t.Fatal(err)
+	}
+	student := func(userID, parentID string) string {
+		s := Student{UserID: userID, FirstName: "Ime", LastName: "Prezime", ParentUserID: parentID, ClassID: class.ID}
+		if err := db.Create(&s).Error; err != nil {
+			t.Fatal(err)
+		}
+		return s.ID
+	}
+	ward := student("u-child", "")
+	legacyWard := student("u-older-child", "user-roditelj")
+	self := student("user-ucenik", "")
+	other := student("u-other", "someone-else")
+	fakeSSO(t, map[string][]SSOWard{"user-roditelj": {{ID: "u-child", Relation: "roditelj"}}})
+
+	appointment := func(requester, staff string) string {
+		a := SchoolAppointment{RequesterID: requester, StaffID: staff, DateTime: time.Now(), Type: "razgovor"}
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		return a.ID
+	}
+	parentsMeeting := appointment("user-roditelj", "user-nastavnik")
+	studentsMeeting := appointment("u-other", "user-nastavnik")
+	appointment("u-other", "another-teacher")
+
+	ids := func(role, path string) []string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+sign(role))
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s as %s: status %d, want 200", path, role, w.Code)
+		}
+		var rows []struct{ ID string }
+		json.Unmarshal(w.Body.Bytes(), &rows)
+		var list []string
+		for _, row := range rows {
+			list = append(list, row.ID)
+		}
+		slices.Sort(list)
+		return list
+	}
+	sorted := func(list ...string) []string {
+		slices.Sort(list)
+		return list
+	}
+
+	tests := []struct {
+		role, path string
+		want       []string
+	}{
+		{"roditelj", "/students", sorted(ward, legacyWard)},
+		{"ucenik", "/students", sorted(self)},
+		{"nastavnik", "/students", sorted(ward, legacyWard, self, other)},
+		{"roditelj", "/appointments", sorted(parentsMeeting)},
+		{"nastavnik", "/appointments", sorted(parentsMeeting, studentsMeeting)},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.role, tt.path); !slices.Equal(got, tt.want) {
+			t.Errorf("%s as %s: got %v, want %v", tt.path, tt.role, got, tt.want)
+		}
+	}
+
+	denied := []struct{ role, path string }{
+		{"roditelj", "/students/" + other},
+		{"roditelj", "/grades?student_id=" + self},
+		{"ucenik", "/students/" + ward},
+		{"ucenik", "/attendance?student_id=" + other},
+	}
+	for _, tt := range denied {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+sign(tt.role))
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s as %s: status %d, want 403", tt.path, tt.role, w.Code)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 5. Digitalno opravdavanje izostanaka
@@ -47,23 +48,18 @@ func createAbsenceJustification(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid end_date"})
 		return
 	}
-	// auto-resolve student_id from JWT if not provided
+	// a student, or a parent of a single child, need not name the student
 	studentID := req.StudentID
 	if studentID == "" {
-		role := getRole(c)
-		userID := getUserID(c)
-		if role == "ucenik" || role == "roditelj" {
-			var student Student
-			query := db
-			if role == "ucenik" {
-				query = query.Where("user_id = ?", userID)
-			} else {
-				query = query.Where("parent_user_id = ?", userID)
-			}
-			if result := query.First(&student); result.Error == nil {
-				studentID = student.ID
-			}
+		ids, all, ok := allowedStudents(c)
+		if !ok {
+			return
 		}
+		if !all && len(ids) == 1 {
+			studentID = ids[0]
+		}
+	} else if !canAccessStudent(c, studentID) {
+		return
 	}
 	if studentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "student_id is required"})
@@ -77,36 +73,26 @@ func createAbsenceJustification(c *gin.Context) {
 		DocumentURL: req.DocumentURL,
 		Status:      "pending",
 	}
-	if result := db.Create(&absence); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&absence).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "absence", absence.ID, nil, absence)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, absence)
 }
 
 func listAbsenceJustifications(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var absences []AbsenceJustification
-	query := db
-	studentID := c.Query("student_id")
-	if role == "ucenik" {
-		var student Student
-		if result := db.Where("user_id = ?", userID).First(&student); result.Error == nil {
-			query = query.Where("student_id = ?", student.ID)
-		}
-	} else if role == "roditelj" {
-		if studentID != "" {
-			query = query.Where("student_id = ?", studentID)
-		} else {
-			var student Student
-			if result := db.Where("parent_user_id = ?", userID).First(&student); result.Error == nil {
-				query = query.Where("student_id = ?", student.ID)
-			}
-		}
-	} else if studentID != "" {
-		query = query.Where("student_id = ?", studentID)
+	scope := studentScope(c, "student_id", c.Query("student_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -119,11 +105,6 @@ type UpdateAbsenceStatusRequest struct {
 }
 
 func updateAbsenceStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "nastavnik" && role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdateAbsenceStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -131,17 +112,51 @@ func updateAbsenceStatus(c *gin.Context) {
 		return
 	}
 	var absence AbsenceJustification
-	if result := db.First(&absence, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&absence, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "absence not found"})
 		return
 	}
-	if result := db.Model(&absence).Updates(map[string]interface{}{
-		"status":      req.Status,
-		"reviewed_by": getUserID(c),
-	}); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	before := absence
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&absence).Updates(map[string]interface{}{
+			"status":      req.Status,
+			"reviewed_by": getUserID(c),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&absence, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := publishEvent(tx, eventAbsenceReviewed, absenceReviewed(absence)); err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "absence", id, before, absence)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
-	db.First(&absence, "id = ?", id)
 	c.JSON(http.StatusOK, absence)
-}
\ No newline at end of file
+}
+
+// AbsenceReviewed is the absence.reviewed event. It carries the decision
+// and the days it covers, not the reason the parent gave.
+type AbsenceReviewed struct {
+	AbsenceID  string    `json:"absence_id"`
+	StudentID  string    `json:"student_id"`
+	Status     string    `json:"status"`
+	StartDate  time.Time `json:"start_date"`
+	EndDate    time.Time `json:"end_date"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+func absenceReviewed(a AbsenceJustification) AbsenceReviewed {
+	return AbsenceReviewed{
+		AbsenceID:  a.ID,
+		StudentID:  a.StudentID,
+		Status:     a.Status,
+		StartDate:  a.StartDate,
+		EndDate:    a.EndDate,
+		ReviewedAt: time.Now().UTC(),
+	}
+}
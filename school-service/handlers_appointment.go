@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 4. Zakazivanje termina
@@ -35,23 +36,22 @@ func createSchoolAppointment(c *gin.Context) {
 		Status:      "pending",
 		Notes:       req.Notes,
 	}
-	if result := db.Create(&appt); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&appt).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "appointment", appt.ID, nil, appt)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, appt)
 }
 
 func listSchoolAppointments(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var appts []SchoolAppointment
-	query := db
-	if role == "roditelj" || role == "ucenik" {
-		query = query.Where("requester_id = ?", userID)
-	} else if role == "nastavnik" {
-		query = query.Where("staff_id = ?", userID)
-	}
+	query := dbFor(c).Scopes(userScope(c, "requester_id", "staff_id"))
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -65,11 +65,6 @@ type UpdateSchoolAppointmentStatusRequest struct {
 }
 
 func updateSchoolAppointmentStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "nastavnik" && role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdateSchoolAppointmentStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -77,18 +72,31 @@ func updateSchoolAppointmentStatus(c *gin.Context) {
 		return
 	}
 	var appt SchoolAppointment
-	if result := db.First(&appt, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&appt, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "appointment not found"})
 		return
 	}
+	if !ownsRecord(c, appt.RequesterID, appt.StaffID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "appointment is assigned to someone else"})
+		return
+	}
 	updates := map[string]interface{}{"status": req.Status}
 	if req.Notes != "" {
 		updates["notes"] = req.Notes
 	}
-	if result := db.Model(&appt).Updates(updates); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	before := appt
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&appt).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&appt, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditUpdate, "appointment", id, before, appt)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
-	db.First(&appt, "id = ?", id)
 	c.JSON(http.StatusOK, appt)
 }
\ No newline at end of file
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 3. Elektronski dnevnik - prisustvo
@@ -17,11 +18,6 @@ type CreateAttendanceRequest struct {
 }
 
 func createAttendance(c *gin.Context) {
-	role := getRole(c)
-	if role != "nastavnik" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only teachers can record attendance"})
-		return
-	}
 	var req CreateAttendanceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -39,36 +35,30 @@ func createAttendance(c *gin.Context) {
 		Status:    req.Status,
 		TeacherID: getUserID(c),
 	}
-	if result := db.Create(&att); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&att).Error; err != nil {
+			return err
+		}
+		if err := audit(c, tx, auditCreate, "attendance", att.ID, nil, att); err != nil {
+			return err
+		}
+		// an absence during a sick leave the school already knows of
+		return justifyAttendance(tx, att, auditRequest(c))
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, att)
 }
 
 func listAttendance(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var records []Attendance
-	query := db
-	studentID := c.Query("student_id")
-	if role == "ucenik" {
-		var student Student
-		if result := db.Where("user_id = ?", userID).First(&student); result.Error == nil {
-			query = query.Where("student_id = ?", student.ID)
-		}
-	} else if role == "roditelj" {
-		if studentID != "" {
-			query = query.Where("student_id = ?", studentID)
-		} else {
-			var student Student
-			if result := db.Where("parent_user_id = ?", userID).First(&student); result.Error == nil {
-				query = query.Where("student_id = ?", student.ID)
-			}
-		}
-	} else if studentID != "" {
-		query = query.Where("student_id = ?", studentID)
+	scope := studentScope(c, "student_id", c.Query("student_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if dateFrom := c.Query("date_from"); dateFrom != "" {
 		if d, err := time.Parse("2006-01-02", dateFrom); err == nil {
 			query = query.Where("date >= ?", d)
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 2. Pregled i preuzimanje dokumenata
@@ -15,11 +16,6 @@ type CreateDocumentRequest struct {
 }
 
 func createDocument(c *gin.Context) {
-	role := getRole(c)
-	if role != "admin" && role != "administracija" && role != "nastavnik" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateDocumentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -31,36 +27,26 @@ func createDocument(c *gin.Context) {
 		Content:   req.Content,
 		IssuedBy:  getUserID(c),
 	}
-	if result := db.Create(&doc); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doc).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "document", doc.ID, nil, doc)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, doc)
 }
 
 func listDocuments(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var docs []SchoolDocument
-	query := db
-	studentID := c.Query("student_id")
-	if role == "ucenik" {
-		var student Student
-		if result := db.Where("user_id = ?", userID).First(&student); result.Error == nil {
-			query = query.Where("student_id = ?", student.ID)
-		}
-	} else if role == "roditelj" {
-		if studentID != "" {
-			query = query.Where("student_id = ?", studentID)
-		} else {
-			var student Student
-			if result := db.Where("parent_user_id = ?", userID).First(&student); result.Error == nil {
-				query = query.Where("student_id = ?", student.ID)
-			}
-		}
-	} else if studentID != "" {
-		query = query.Where("student_id = ?", studentID)
+	scope := studentScope(c, "student_id", c.Query("student_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if docType := c.Query("type"); docType != "" {
 		query = query.Where("type = ?", docType)
 	}
@@ -71,9 +57,12 @@ func listDocuments(c *gin.Context) {
 func getDocument(c *gin.Context) {
 	id := c.Param("id")
 	var doc SchoolDocument
-	if result := db.First(&doc, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&doc, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
 		return
 	}
+	if !canAccessStudent(c, doc.StudentID) {
+		return
+	}
 	c.JSON(http.StatusOK, doc)
 }
\ No newline at end of file
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 1. Elektronska prijava i evidencija učenika
@@ -35,25 +37,35 @@ func createEnrollment(c *gin.Context) {
 		DateOfBirth:  dob,
 		ParentUserID: getUserID(c),
 		SchoolYear:   req.SchoolYear,
-		Status:       "pending",
+		Status:       enrollmentSubmitted,
 		Notes:        req.Notes,
 		HealthCertID: req.HealthCertID,
 	}
-	if result := db.Create(&enrollment); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err = dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&enrollment).Error; err != nil {
+			return err
+		}
+		if err := recordEnrollmentStatus(c, tx, enrollment.ID, "", enrollmentSubmitted, ""); err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "enrollment", enrollment.ID, nil, enrollment)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
+	// the office can run the check again if health-service is unavailable now
+	if enrollment.HealthCertID != "" && health != nil {
+		if err := verifyHealthCertificate(c, &enrollment, enrollment.HealthCertID); err != nil {
+			reqLogger(c).Warn("health certificate not checked", "enrollment_id", enrollment.ID, "error", err)
+		}
+	}
 	c.JSON(http.StatusCreated, enrollment)
 }
 
 func listEnrollments(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var enrollments []Enrollment
-	query := db
-	if role == "roditelj" || role == "ucenik" {
-		query = query.Where("parent_user_id = ?", userID)
-	}
+	query := dbFor(c).Scopes(userScope(c, "parent_user_id", ""))
 	if status := c.Query("status"); status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -64,26 +76,55 @@ func listEnrollments(c *gin.Context) {
 func getEnrollment(c *gin.Context) {
 	id := c.Param("id")
 	var enrollment Enrollment
-	if result := db.First(&enrollment, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&enrollment, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "enrollment not found"})
 		return
 	}
+	if !ownsRecord(c, enrollment.ParentUserID, "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this enrollment"})
+		return
+	}
 	c.JSON(http.StatusOK, enrollment)
 }
 
+// listEnrollmentHistory returns the status changes of an enrollment, oldest
+// first, to whoever may read the enrollment.
+func listEnrollmentHistory(c *gin.Context) {
+	id := c.Param("id")
+	var enrollment Enrollment
+	if result := dbFor(c).First(&enrollment, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "enrollment not found"})
+		return
+	}
+	if !ownsRecord(c, enrollment.ParentUserID, "") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to this enrollment"})
+		return
+	}
+	history := []EnrollmentStatusChange{}
+	if result := dbFor(c).Where("enrollment_id = ?", id).Order("id").Find(&history); result.Error != nil {
+		serverError(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
 type UpdateEnrollmentStatusRequest struct {
-	Status             string `json:"status" binding:"required"`
-	Notes              string `json:"notes"`
-	HealthCertVerified bool   `json:"health_cert_verified"`
-	HealthCertID       string `json:"health_cert_id"`
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason"`
+	Notes  string `json:"notes"`
+	// the new student's account and class, on approval
+	UserID  string `json:"user_id"`
+	ClassID string `json:"class_id"`
 }
 
+// errEnrollmentChanged aborts a transition when another request moved the
+// enrollment first.
+var errEnrollmentChanged = errors.New("enrollment status changed meanwhile, reload and try again")
+
+// updateEnrollmentStatus moves an enrollment along the workflow in
+// enrollment_workflow.go. Approval creates the student in the same
+// transaction, so an approved enrollment always has one.
 func updateEnrollmentStatus(c *gin.Context) {
-	role := getRole(c)
-	if role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can update enrollment status"})
-		return
-	}
 	id := c.Param("id")
 	var req UpdateEnrollmentStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -91,7 +132,7 @@ func updateEnrollmentStatus(c *gin.Context) {
 		return
 	}
 	var enrollment Enrollment
-	if result := db.First(&enrollment, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&enrollment, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "enrollment not found"})
 		return
 	}
@@ -99,14 +140,113 @@ func updateEnrollmentStatus(c *gin.Context) {
 	if req.Notes != "" {
 		updates["notes"] = req.Notes
 	}
-	if req.HealthCertVerified {
-		updates["health_cert_verified"] = true
-		updates["health_cert_id"] = req.HealthCertID
+	// review relies on a checked certificate, and approval checks it again
+	// so that it is valid on the day of enrollment
+	recheck := req.Status == enrollmentApproved ||
+		req.Status == enrollmentUnderReview && !enrollment.HealthCertVerified
+	if recheck && enrollment.HealthCertID != "" && canMove(enrollment.Status, req.Status) {
+		if !healthCertChecked(c, &enrollment, enrollment.HealthCertID) {
+			return
+		}
+	}
+	var transErr *TransitionError
+	if err := checkTransition(enrollment, req.Status, req); errors.As(err, &transErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "allowed": transErr.Allowed})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var student Student
+	if req.Status == enrollmentApproved {
+		var class Class
+		if result := dbFor(c).First(&class, "id = ?", req.ClassID); result.Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "class not found"})
+			return
+		}
+		var existing int64
+		dbFor(c).Model(&Student{}).Where("user_id = ?", req.UserID).Count(&existing)
+		if existing > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "user_id already belongs to a student"})
+			return
+		}
+		if enrollment.HealthPatientID != nil {
+			dbFor(c).Model(&Student{}).Where("health_patient_id = ?", *enrollment.HealthPatientID).Count(&existing)
+			if existing > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "the certificate holder is already a student"})
+				return
+			}
+		}
+		student = Student{
+			UserID:       req.UserID,
+			FirstName:    enrollment.FirstName,
+			LastName:     enrollment.LastName,
+			DateOfBirth:  enrollment.DateOfBirth,
+			ParentUserID: enrollment.ParentUserID,
+			ClassID:      class.ID,
+		}
 	}
-	if result := db.Model(&enrollment).Updates(updates); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+
+	before := enrollment
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if req.Status == enrollmentApproved {
+			if err := tx.Create(&student).Error; err != nil {
+				return err
+			}
+			if err := audit(c, tx, auditCreate, "student", student.ID, nil, student); err != nil {
+				return err
+			}
+			updates["student_id"] = student.ID
+		}
+		// the status condition makes concurrent transitions of the same
+		// enrollment fail instead of both passing the checks above
+		result := tx.Model(&enrollment).Where("status = ?", before.Status).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errEnrollmentChanged
+		}
+		if err := recordEnrollmentStatus(c, tx, id, before.Status, req.Status, req.Reason); err != nil {
+			return err
+		}
+		if err := tx.First(&enrollment, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if req.Status == enrollmentApproved {
+			if err := publishEvent(tx, eventEnrollmentApproved, approvalEvent(enrollment, student)); err != nil {
+				return err
+			}
+		}
+		return audit(c, tx, auditUpdate, "enrollment", id, before, enrollment)
+	})
+	if errors.Is(err, errEnrollmentChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		serverError(c, err)
 		return
 	}
-	db.First(&enrollment, "id = ?", id)
 	c.JSON(http.StatusOK, enrollment)
-}
\ No newline at end of file
+}
+
+// EnrollmentApproved is the enrollment.approved event. It names the
+// enrollment and the student it created, without the child's details.
+type EnrollmentApproved struct {
+	EnrollmentID string    `json:"enrollment_id"`
+	StudentID    string    `json:"student_id"`
+	ClassID      string    `json:"class_id"`
+	Status       string    `json:"status"`
+	ApprovedAt   time.Time `json:"approved_at"`
+}
+
+func approvalEvent(e Enrollment, s Student) EnrollmentApproved {
+	return EnrollmentApproved{
+		EnrollmentID: e.ID,
+		StudentID:    s.ID,
+		ClassID:      s.ClassID,
+		Status:       e.Status,
+		ApprovedAt:   time.Now().UTC(),
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // 3. Elektronski dnevnik - ocene
@@ -18,11 +19,6 @@ type CreateGradeRequest struct {
 }
 
 func createGrade(c *gin.Context) {
-	role := getRole(c)
-	if role != "nastavnik" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only teachers can add grades"})
-		return
-	}
 	var req CreateGradeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -42,37 +38,27 @@ func createGrade(c *gin.Context) {
 		TeacherID: getUserID(c),
 		Comment:   req.Comment,
 	}
-	if result := db.Create(&grade); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&grade).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "grade", grade.ID, nil, grade)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, grade)
 }
 
 func listGrades(c *gin.Context) {
-	role := getRole(c)
-	userID := getUserID(c)
 	var grades []Grade
-	query := db
-	studentID := c.Query("student_id")
 	subjectID := c.Query("subject_id")
-	if role == "ucenik" {
-		var student Student
-		if result := db.Where("user_id = ?", userID).First(&student); result.Error == nil {
-			query = query.Where("student_id = ?", student.ID)
-		}
-	} else if role == "roditelj" {
-		if studentID != "" {
-			query = query.Where("student_id = ?", studentID)
-		} else {
-			var student Student
-			if result := db.Where("parent_user_id = ?", userID).First(&student); result.Error == nil {
-				query = query.Where("student_id = ?", student.ID)
-			}
-		}
-	} else if studentID != "" {
-		query = query.Where("student_id = ?", studentID)
+	scope := studentScope(c, "student_id", c.Query("student_id"))
+	if scope == nil {
+		return
 	}
+	query := dbFor(c).Scopes(scope)
 	if subjectID != "" {
 		query = query.Where("subject_id = ?", subjectID)
 	}
@@ -81,14 +67,20 @@ func listGrades(c *gin.Context) {
 }
 
 func deleteGrade(c *gin.Context) {
-	role := getRole(c)
-	if role != "nastavnik" && role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+	id := c.Param("id")
+	var grade Grade
+	if result := dbFor(c).First(&grade, "id = ?", id); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "grade not found"})
 		return
 	}
-	id := c.Param("id")
-	if result := db.Delete(&Grade{}, "id = ?", id); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&grade).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditDelete, "grade", id, grade, nil)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "grade deleted"})
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CreateStudentRequest struct {
@@ -17,11 +18,6 @@ type CreateStudentRequest struct {
 }
 
 func createStudent(c *gin.Context) {
-	role := getRole(c)
-	if role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateStudentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -41,8 +37,14 @@ func createStudent(c *gin.Context) {
 		ParentUserID: req.ParentUserID,
 		ClassID:      req.ClassID,
 	}
-	if result := db.Create(&student); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&student).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "student", student.ID, nil, student)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, student)
@@ -50,7 +52,11 @@ func createStudent(c *gin.Context) {
 
 func listStudents(c *gin.Context) {
 	var students []Student
-	query := db
+	scope := studentScope(c, "id", "")
+	if scope == nil {
+		return
+	}
+	query := dbFor(c).Scopes(scope)
 	if classID := c.Query("class_id"); classID != "" {
 		query = query.Where("class_id = ?", classID)
 	}
@@ -66,8 +72,11 @@ func listStudents(c *gin.Context) {
 
 func getStudent(c *gin.Context) {
 	id := c.Param("id")
+	if !canAccessStudent(c, id) {
+		return
+	}
 	var student Student
-	if result := db.First(&student, "id = ?", id); result.Error != nil {
+	if result := dbFor(c).First(&student, "id = ?", id); result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "student not found"})
 		return
 	}
@@ -81,11 +90,6 @@ type CreateClassRequest struct {
 }
 
 func createClass(c *gin.Context) {
-	role := getRole(c)
-	if role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateClassRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -96,8 +100,14 @@ func createClass(c *gin.Context) {
 		Year:      req.Year,
 		TeacherID: req.TeacherID,
 	}
-	if result := db.Create(&class); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&class).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "class", class.ID, nil, class)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, class)
@@ -105,7 +115,7 @@ func createClass(c *gin.Context) {
 
 func listClasses(c *gin.Context) {
 	var classes []Class
-	db.Scopes(paginate(c)).Find(&classes)
+	dbFor(c).Scopes(paginate(c)).Find(&classes)
 	c.JSON(http.StatusOK, classes)
 }
 
@@ -116,11 +126,6 @@ type CreateSubjectRequest struct {
 }
 
 func createSubject(c *gin.Context) {
-	role := getRole(c)
-	if role != "admin" && role != "administracija" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
-		return
-	}
 	var req CreateSubjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -131,8 +136,14 @@ func createSubject(c *gin.Context) {
 		ClassID:   req.ClassID,
 		TeacherID: req.TeacherID,
 	}
-	if result := db.Create(&subject); result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subject).Error; err != nil {
+			return err
+		}
+		return audit(c, tx, auditCreate, "subject", subject.ID, nil, subject)
+	})
+	if err != nil {
+		serverError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, subject)
@@ -140,7 +151,7 @@ func createSubject(c *gin.Context) {
 
 func listSubjects(c *gin.Context) {
 	var subjects []Subject
-	query := db
+	query := dbFor(c)
 	if classID := c.Query("class_id"); classID != "" {
 		query = query.Where("class_id = ?", classID)
 	}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCertificateNotFound  = errors.New("health certificate not found")
+	ErrInvalidCertificateID = errors.New("health certificate id must be a UUID")
+)
+
+// HealthCertificate is the part of a health-service MedicalCertificate the
+// school needs to accept it for enrollment.
+type HealthCertificate struct {
+	ID          string    `json:"id"`
+	PatientID   string    `json:"patient_id"`
+	PatientName string    `json:"patient_name"`
+	Type        string    `json:"type"`
+	ValidFrom   time.Time `json:"valid_from"`
+	ValidTo     time.Time `json:"valid_to"`
+	// Patient is whom health-service issued the certificate to.
+	Patient struct {
+		UserID      string    `json:"user_id"`
+		FirstName   string    `json:"first_name"`
+		LastName    string    `json:"last_name"`
+		DateOfBirth time.Time `json:"date_of_birth"`
+	} `json:"patient"`
+}
+
+// HealthClient calls health-service with this service's own token, not the
+// user's: school staff have no access to medical records.
+type HealthClient struct {
+	URL    string
+	Tokens *ServiceTokens
+	Client *http.Client
+	// Attempts bounds the tries per call. Timeouts, 5xx and 429 answers are
+	// retried after Backoff, doubled for every further try.
+	Attempts int
+	Backoff  time.Duration
+}
+
+// health is nil when no service client is configured.
+var health *HealthClient
+
+func NewHealthClient(url string, tokens *ServiceTokens, timeout time.Duration, attempts int) *HealthClient {
+	return &HealthClient{
+		URL:      strings.TrimSuffix(url, "/"),
+		Tokens:   tokens,
+		Client:   &http.Client{Timeout: timeout, Transport: tracedTransport()},
+		Attempts: attempts,
+		Backoff:  200 * time.Millisecond,
+	}
+}
+
+// Certificate fetches a medical certificate. The id comes from applicants,
+// so it must be a UUID before it becomes part of the path.
+func (h *HealthClient) Certificate(c *gin.Context, id string) (HealthCertificate, error) {
+	var cert HealthCertificate
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return cert, ErrInvalidCertificateID
+	}
+	err = h.get(c, "/medical-certificates/"+url.PathEscape(parsed.String()), &cert, ErrCertificateNotFound)
+	return cert, err
+}
+
+// get decodes a 200 answer into out and maps 404 to notFound.
+func (h *HealthClient) get(c *gin.Context, path string, out any, notFound error) error {
+	ctx := c.Request.Context()
+	for attempt := 1; ; attempt++ {
+		retry, err := h.try(ctx, path, out, notFound)
+		if !retry || attempt >= h.Attempts {
+			return err
+		}
+		reqLogger(c).Warn("health-service call failed, retrying", "path", path, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(h.Backoff << (attempt - 1)):
+		}
+	}
+}
+
+func (h *HealthClient) try(ctx context.Context, path string, out any, notFound error) (retry bool, err error) {
+	token, err := h.Tokens.Token(ctx)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return false, json.NewDecoder(resp.Body).Decode(out)
+	case resp.StatusCode == http.StatusNotFound:
+		return false, notFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		// the cached token was revoked or signed with a retired key
+		h.Tokens.Invalidate()
+		return true, fmt.Errorf("health %s: token rejected", path)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("health %s: unexpected status %d", path, resp.StatusCode)
+	default:
+		return false, fmt.Errorf("health %s: unexpected status %d", path, resp.StatusCode)
+	}
+}
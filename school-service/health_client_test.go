@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCertificateIDMustBeUUID(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.Write([]byte(`{"id":"7d0a4c8e-1d2b-4f3a-9c5e-2b8f6a1e9d40","type":"school"}`))
+	}))
+	defer srv.Close()
+	tokens := &ServiceTokens{token: "t", expires: time.Now().Add(time.Minute)}
+	h := &HealthClient{URL: srv.URL, Tokens: tokens, Client: srv.Client(), Attempts: 1}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for _, id := range []string{"", "../patients", "x?y=1", "7d0a4c8e-1d2b-4f3a-9c5e-2b8f6a1e9d40/../../patients"} {
+		if _, err := h.Certificate(c, id); !errors.Is(err, ErrInvalidCertificateID) {
+			t.Errorf("Certificate(%q): error %v, want ErrInvalidCertificateID", id, err)
+		}
+	}
+	if len(paths) != 0 {
+		t.Errorf("invalid ids reached health-service as %v", paths)
+	}
+
+	cert, err := h.Certificate(c, "7D0A4C8E-1D2B-4F3A-9C5E-2B8F6A1E9D40")
+	if err != nil || cert.Type != "school" {
+		t.Fatalf("Certificate: %+v, %v", cert, err)
+	}
+	if want := "/medical-certificates/7d0a4c8e-1d2b-4f3a-9c5e-2b8f6a1e9d40"; len(paths) != 1 || paths[0] != want {
+		t.Errorf("requested %v, want %s", paths, want)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_published_total",
+		Help: "Outbox events published to the event bus, by type.",
+	}, []string{"type"})
+	eventsConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_consumed_total",
+		Help: "Events from other services handled, by type and result.",
+	}, []string{"type", "result"})
+)
+
+// measureRequests counts requests under their route pattern rather than the
+// raw path, so IDs in URLs do not create a series each.
+func measureRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		httpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// registerMetrics exposes the connection pool and the backlogs that grow when
+// staff fall behind or the event bus is unreachable; the counts are read
+// from the database on each scrape.
+func registerMetrics() {
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("metrics: %v", err)
+	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(sqlDB, "school"))
+	countGauge("school_pending_enrollments", "Enrollment applications waiting for a decision.", &Enrollment{},
+		"status IN ?", []string{enrollmentSubmitted, enrollmentDocumentsRequired, enrollmentUnderReview})
+	pendingGauge("school_pending_absence_justifications", "Absence justifications waiting for review.", &AbsenceJustification{})
+	pendingGauge("school_pending_appointments", "Appointment requests waiting for confirmation.", &SchoolAppointment{})
+	countGauge("school_outbox_unpublished_events", "Outbox events not yet published to the event bus.", &OutboxEvent{}, "published_at IS NULL")
+}
+
+func pendingGauge(name, help string, model interface{}) {
+	countGauge(name, help, model, "status = ?", "pending")
+}
+
+func countGauge(name, help string, model interface{}, query string, args ...interface{}) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var n int64
+		if err := db.WithContext(ctx).Model(model).Where(query, args...).Count(&n).Error; err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS school_documents;
+DROP TABLE IF EXISTS absence_justifications;
+DROP TABLE IF EXISTS school_appointments;
+DROP TABLE IF EXISTS attendances;
+DROP TABLE IF EXISTS grades;
+DROP TABLE IF EXISTS subjects;
+DROP TABLE IF EXISTS classes;
+DROP TABLE IF EXISTS students;
+DROP TABLE IF EXISTS enrollments;
@@ -0,0 +1,100 @@
+-- početna šema, ista kao ona koju je ranije pravio gorm AutoMigrate,
+-- tako da se postojeće baze preuzimaju bez izmena
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS enrollments (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	date_of_birth TIMESTAMPTZ,
+	parent_user_id VARCHAR(36),
+	school_year TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	health_cert_verified BOOLEAN DEFAULT false,
+	health_cert_id TEXT,
+	notes TEXT,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS students (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id VARCHAR(36),
+	first_name TEXT NOT NULL,
+	last_name TEXT NOT NULL,
+	date_of_birth TIMESTAMPTZ,
+	parent_user_id VARCHAR(36),
+	class_id UUID,
+	created_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_students_user_id ON students(user_id);
+
+CREATE TABLE IF NOT EXISTS classes (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name TEXT NOT NULL,
+	year BIGINT NOT NULL,
+	teacher_id VARCHAR(36),
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS subjects (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	name TEXT NOT NULL,
+	class_id UUID,
+	teacher_id VARCHAR(36)
+);
+
+CREATE TABLE IF NOT EXISTS grades (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	student_id UUID NOT NULL,
+	subject_id UUID NOT NULL,
+	value BIGINT NOT NULL,
+	grade_date TIMESTAMPTZ NOT NULL,
+	teacher_id VARCHAR(36) NOT NULL,
+	comment TEXT,
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_grades_student_id ON grades(student_id);
+
+CREATE TABLE IF NOT EXISTS attendances (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	student_id UUID NOT NULL,
+	date TIMESTAMPTZ NOT NULL,
+	period BIGINT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'present',
+	teacher_id VARCHAR(36) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_attendances_student_id ON attendances(student_id);
+
+CREATE TABLE IF NOT EXISTS school_appointments (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	requester_id VARCHAR(36) NOT NULL,
+	staff_id VARCHAR(36) NOT NULL,
+	date_time TIMESTAMPTZ NOT NULL,
+	type TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	notes TEXT,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS absence_justifications (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	student_id UUID NOT NULL,
+	start_date TIMESTAMPTZ NOT NULL,
+	end_date TIMESTAMPTZ NOT NULL,
+	reason TEXT NOT NULL,
+	document_url TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	reviewed_by VARCHAR(36),
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_absence_justifications_student_id ON absence_justifications(student_id);
+
+CREATE TABLE IF NOT EXISTS school_documents (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	student_id UUID NOT NULL,
+	type TEXT NOT NULL,
+	content TEXT,
+	issued_by VARCHAR(36),
+	created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_school_documents_student_id ON school_documents(student_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS enrollment_status_history;
+ALTER TABLE enrollments DROP CONSTRAINT IF EXISTS enrollments_status_check;
+UPDATE enrollments SET status = 'pending' WHERE status IN ('submitted', 'documents_required', 'under_review');
+UPDATE enrollments SET status = 'approved' WHERE status = 'enrolled';
+ALTER TABLE enrollments ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE enrollments DROP COLUMN IF EXISTS student_id;
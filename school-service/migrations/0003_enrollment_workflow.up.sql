@@ -0,0 +1,21 @@
+-- prijave prolaze kroz submitted → documents_required → under_review →
+-- approved/rejected → enrolled; stari 'pending' je sada 'submitted'
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS student_id UUID;
+ALTER TABLE enrollments ALTER COLUMN status SET DEFAULT 'submitted';
+UPDATE enrollments SET status = 'submitted' WHERE status = 'pending';
+UPDATE enrollments SET status = 'under_review'
+	WHERE status NOT IN ('submitted', 'documents_required', 'under_review', 'approved', 'rejected', 'enrolled');
+ALTER TABLE enrollments DROP CONSTRAINT IF EXISTS enrollments_status_check;
+ALTER TABLE enrollments ADD CONSTRAINT enrollments_status_check
+	CHECK (status IN ('submitted', 'documents_required', 'under_review', 'approved', 'rejected', 'enrolled'));
+
+CREATE TABLE IF NOT EXISTS enrollment_status_history (
+	id BIGSERIAL PRIMARY KEY,
+	enrollment_id UUID NOT NULL REFERENCES enrollments(id) ON DELETE CASCADE,
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	changed_by VARCHAR(36) NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_enrollment_status_history_enrollment_id ON enrollment_status_history(enrollment_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE enrollments DROP COLUMN IF EXISTS health_cert_problem;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS health_cert_checked_at;
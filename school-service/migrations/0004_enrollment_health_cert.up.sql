@@ -0,0 +1,4 @@
+-- ishod provere lekarskog uverenja u health-service; ranije ručno
+-- potvrđena uverenja ostaju potvrđena, bez vremena provere
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS health_cert_checked_at TIMESTAMPTZ;
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS health_cert_problem TEXT NOT NULL DEFAULT '';
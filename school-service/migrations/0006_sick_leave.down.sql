@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS notifications;
+DROP INDEX IF EXISTS idx_absence_justifications_health_cert_id;
+ALTER TABLE absence_justifications DROP COLUMN IF EXISTS health_cert_id;
+DROP TABLE IF EXISTS sick_leaves;
+DROP INDEX IF EXISTS idx_students_health_patient_id;
+ALTER TABLE students DROP COLUMN IF EXISTS health_patient_id;
+ALTER TABLE enrollments DROP COLUMN IF EXISTS health_patient_id;
@@ -0,0 +1,31 @@
+-- veza učenika sa pacijentom u health-service, preko uverenja za upis ili
+-- prvog bolovanja koje se poklopi sa učenikom
+ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS health_patient_id UUID;
+ALTER TABLE students ADD COLUMN IF NOT EXISTS health_patient_id UUID;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_students_health_patient_id ON students(health_patient_id);
+
+-- bolovanja primljena od health-service; izostanci u tom periodu se
+-- opravdavaju i kada budu upisani kasnije
+CREATE TABLE IF NOT EXISTS sick_leaves (
+	certificate_id UUID PRIMARY KEY,
+	student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+	valid_from TIMESTAMPTZ NOT NULL,
+	valid_to TIMESTAMPTZ NOT NULL,
+	received_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_sick_leaves_student_id ON sick_leaves(student_id);
+
+ALTER TABLE absence_justifications ADD COLUMN IF NOT EXISTS health_cert_id UUID;
+CREATE INDEX IF NOT EXISTS idx_absence_justifications_health_cert_id ON absence_justifications(health_cert_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id VARCHAR(36) NOT NULL,
+	kind TEXT NOT NULL,
+	message TEXT NOT NULL,
+	entity TEXT,
+	entity_id TEXT,
+	created_at TIMESTAMPTZ,
+	read_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, created_at);
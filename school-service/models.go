@@ -10,13 +10,32 @@ type Enrollment struct {
 	DateOfBirth        time.Time `json:"date_of_birth"`
 	ParentUserID       string    `gorm:"type:varchar(36)" json:"parent_user_id"`
 	SchoolYear         string    `gorm:"not null" json:"school_year"`
-	Status             string    `gorm:"not null;default:'pending'" json:"status"`
+	Status             string    `gorm:"not null;default:'submitted'" json:"status"`
 	HealthCertVerified bool      `gorm:"default:false" json:"health_cert_verified"`
 	HealthCertID       string    `json:"health_cert_id"`
-	Notes              string    `json:"notes"`
-	CreatedAt          time.Time `json:"created_at"`
+	// result of the last check against health-service; the problem is
+	// empty once the certificate is verified
+	HealthCertCheckedAt *time.Time `json:"health_cert_checked_at,omitempty"`
+	HealthCertProblem   string     `json:"health_cert_problem,omitempty"`
+	HealthPatientID     *string    `gorm:"type:uuid" json:"health_patient_id,omitempty"`
+	StudentID           *string    `gorm:"type:uuid" json:"student_id,omitempty"` // set on approval
+	Notes               string     `json:"notes"`
+	CreatedAt           time.Time  `json:"created_at"`
 }
 
+// EnrollmentStatusChange - istorija statusa prijave za upis
+type EnrollmentStatusChange struct {
+	ID           int64     `gorm:"primaryKey" json:"id"`
+	EnrollmentID string    `gorm:"type:uuid;not null;index" json:"enrollment_id"`
+	FromStatus   string    `gorm:"not null" json:"from_status"`
+	ToStatus     string    `gorm:"not null" json:"to_status"`
+	Reason       string    `json:"reason"`
+	ChangedBy    string    `gorm:"type:varchar(36);not null" json:"changed_by"`
+	ChangedAt    time.Time `gorm:"not null" json:"changed_at"`
+}
+
+func (EnrollmentStatusChange) TableName() string { return "enrollment_status_history" }
+
 // Student - upisani učenik
 type Student struct {
 	ID           string    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
@@ -27,6 +46,9 @@ type Student struct {
 	ParentUserID string    `gorm:"type:varchar(36)" json:"parent_user_id"`
 	ClassID      string    `gorm:"type:uuid" json:"class_id"`
 	CreatedAt    time.Time `json:"created_at"`
+	// patient record in health-service, from the first sick-leave
+	// certificate whose patient has the student's account
+	HealthPatientID *string `gorm:"type:uuid;uniqueIndex" json:"health_patient_id,omitempty"`
 }
 
 // Class - školsko odeljenje
@@ -91,6 +113,8 @@ type AbsenceJustification struct {
 	Status      string    `gorm:"not null;default:'pending'" json:"status"`
 	ReviewedBy  string    `gorm:"type:varchar(36)" json:"reviewed_by"`
 	CreatedAt   time.Time `json:"created_at"`
+	// sick-leave certificate that justified the absence
+	HealthCertID *string `gorm:"type:uuid;index" json:"health_cert_id,omitempty"`
 }
 
 // SchoolDocument - školska dokumenta (potvrde, svedočanstva)
@@ -101,4 +125,25 @@ type SchoolDocument struct {
 	Content   string    `gorm:"type:text" json:"content"`
 	IssuedBy  string    `gorm:"type:varchar(36)" json:"issued_by"`
 	CreatedAt time.Time `json:"created_at"`
+}
+
+// SickLeave - bolovanje učenika po lekarskom uverenju iz health-service
+type SickLeave struct {
+	CertificateID string    `gorm:"type:uuid;primaryKey" json:"certificate_id"`
+	StudentID     string    `gorm:"type:uuid;not null;index" json:"student_id"`
+	ValidFrom     time.Time `gorm:"not null" json:"valid_from"`
+	ValidTo       time.Time `gorm:"not null" json:"valid_to"`
+	ReceivedAt    time.Time `gorm:"not null" json:"received_at"`
+}
+
+// Notification - obaveštenje korisniku
+type Notification struct {
+	ID        string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    string     `gorm:"type:varchar(36);not null;index" json:"user_id"`
+	Kind      string     `gorm:"not null" json:"kind"`
+	Message   string     `gorm:"not null" json:"message"`
+	Entity    string     `json:"entity"`
+	EntityID  string     `json:"entity_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
 }
\ No newline at end of file
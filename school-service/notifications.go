@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Obaveštenja
+
+// notify leaves a notification for userID in tx, so it exists only if the
+// change it reports commits.
+func notify(tx *gorm.DB, userID, kind, entity, entityID, message string) error {
+	return tx.Create(&Notification{
+		UserID:   userID,
+		Kind:     kind,
+		Message:  message,
+		Entity:   entity,
+		EntityID: entityID,
+	}).Error
+}
+
+// listNotifications returns the caller's own notifications, newest first;
+// ?unread=true leaves out those already read.
+func listNotifications(c *gin.Context) {
+	notifications := []Notification{}
+	query := dbFor(c).Where("user_id = ?", getUserID(c))
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if result := query.Order("created_at desc").Scopes(paginate(c)).Find(&notifications); result.Error != nil {
+		serverError(c, result.Error)
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+func markNotificationRead(c *gin.Context) {
+	var n Notification
+	if result := dbFor(c).First(&n, "id = ? AND user_id = ?", c.Param("id"), getUserID(c)); result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		if err := dbFor(c).Model(&n).Update("read_at", now).Error; err != nil {
+			serverError(c, err)
+			return
+		}
+		n.ReadAt = &now
+	}
+	c.JSON(http.StatusOK, n)
+}
@@ -0,0 +1,41 @@
+package main
+
+// policy is who may do what in school-service. "admin" is the platform
+// administrator, "administracija" the school office; both hold the same
+// administrative permissions. Own means the student themself for student
+// records, the applicant for enrollments and the requester for appointments;
+// Assigned is the teacher an appointment was requested with.
+var policy = Rules{
+	"enrollments:create": {"ucenik": Own, "roditelj": Own, "admin": All, "administracija": All},
+	"enrollments:read":   {"ucenik": Own, "roditelj": Own, "nastavnik": All, "admin": All, "administracija": All},
+	"enrollments:review": {"admin": All, "administracija": All},
+
+	"students:create": {"admin": All, "administracija": All},
+	"students:read":   {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+	"classes:create":  {"admin": All, "administracija": All},
+	"classes:read":    {anyRole: All},
+	"subjects:create": {"admin": All, "administracija": All},
+	"subjects:read":   {anyRole: All},
+
+	"documents:create": {"nastavnik": All, "admin": All, "administracija": All},
+	"documents:read":   {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+
+	"grades:create":     {"nastavnik": All, "admin": All},
+	"grades:delete":     {"nastavnik": All, "admin": All},
+	"grades:read":       {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+	"attendance:create": {"nastavnik": All, "admin": All},
+	"attendance:read":   {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+
+	"appointments:create": {anyRole: Own},
+	"appointments:read":   {"ucenik": Own, "roditelj": Own, "nastavnik": Assigned, "admin": All, "administracija": All},
+	"appointments:review": {"nastavnik": Assigned, "admin": All, "administracija": All},
+
+	"absences:create": {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+	"absences:read":   {"ucenik": Own, "roditelj": Wards, "nastavnik": All, "admin": All, "administracija": All},
+	"absences:review": {"nastavnik": All, "admin": All, "administracija": All},
+
+	"uploads:create":     {anyRole: Own},
+	"notifications:read": {anyRole: Own},
+
+	"audit:read": {"admin": All, "administracija": All},
+}
@@ -1,64 +1,76 @@
 package main
 
 import (
-	"net/http"
-
 	"github.com/gin-gonic/gin"
 )
 
-func setupRouter(jwtSecret []byte) *gin.Engine {
-	r := gin.Default()
+func setupRouter(jwks *JWKS, checks ...Check) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery(), traceRequests("school-service"), requestLog(), measureRequests())
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "school-service"})
-	})
+	r.GET("/metrics", metricsHandler())
+	r.GET("/livez", livez("school-service"))
+	r.GET("/readyz", readyz("school-service", checks...))
+	// /health predates the split and answers like /readyz
+	r.GET("/health", readyz("school-service", checks...))
 
 	// File upload (requires auth)
-	r.POST("/uploads", AuthMiddleware(jwtSecret), handleFileUpload)
+	r.POST("/uploads", AuthMiddleware(jwks), RequirePermission("uploads:create"), handleFileUpload)
 
-	api := r.Group("", AuthMiddleware(jwtSecret))
+	api := r.Group("", AuthMiddleware(jwks))
+	verified := RequireVerifiedIdentity()
 	{
 		// 1. Elektronska prijava i evidencija učenika
-		api.POST("/enrollments", createEnrollment)
-		api.GET("/enrollments", listEnrollments)
-		api.GET("/enrollments/:id", getEnrollment)
-		api.PATCH("/enrollments/:id/status", updateEnrollmentStatus)
+		api.POST("/enrollments", verified, RequirePermission("enrollments:create"), createEnrollment)
+		api.GET("/enrollments", RequirePermission("enrollments:read"), listEnrollments)
+		api.GET("/enrollments/:id", RequirePermission("enrollments:read"), getEnrollment)
+		api.GET("/enrollments/:id/history", RequirePermission("enrollments:read"), listEnrollmentHistory)
+		api.PUT("/enrollments/:id/health-certificate", verified, RequirePermission("enrollments:create"), attachHealthCertificate)
+		api.PATCH("/enrollments/:id/status", verified, RequirePermission("enrollments:review"), updateEnrollmentStatus)
 
 		// Učenici
-		api.POST("/students", createStudent)
-		api.GET("/students", listStudents)
-		api.GET("/students/:id", getStudent)
+		api.POST("/students", RequirePermission("students:create"), createStudent)
+		api.GET("/students", RequirePermission("students:read"), listStudents)
+		api.GET("/students/:id", RequirePermission("students:read"), getStudent)
 
 		// Odeljenja i predmeti
-		api.POST("/classes", createClass)
-		api.GET("/classes", listClasses)
-		api.POST("/subjects", createSubject)
-		api.GET("/subjects", listSubjects)
+		api.POST("/classes", RequirePermission("classes:create"), createClass)
+		api.GET("/classes", RequirePermission("classes:read"), listClasses)
+		api.POST("/subjects", RequirePermission("subjects:create"), createSubject)
+		api.GET("/subjects", RequirePermission("subjects:read"), listSubjects)
 
 		// 2. Pregled i preuzimanje dokumenata
-		api.POST("/documents", createDocument)
-		api.GET("/documents", listDocuments)
-		api.GET("/documents/:id", getDocument)
+		api.POST("/documents", RequirePermission("documents:create"), createDocument)
+		api.GET("/documents", RequirePermission("documents:read"), listDocuments)
+		api.GET("/documents/:id", RequirePermission("documents:read"), getDocument)
 
 		// 3. Elektronski dnevnik - ocene
-		api.POST("/grades", createGrade)
-		api.GET("/grades", listGrades)
-		api.DELETE("/grades/:id", deleteGrade)
+		api.POST("/grades", verified, RequirePermission("grades:create"), createGrade)
+		api.GET("/grades", RequirePermission("grades:read"), listGrades)
+		api.DELETE("/grades/:id", verified, RequirePermission("grades:delete"), deleteGrade)
 
 		// 3. Elektronski dnevnik - prisustvo
-		api.POST("/attendance", createAttendance)
-		api.GET("/attendance", listAttendance)
+		api.POST("/attendance", RequirePermission("attendance:create"), createAttendance)
+		api.GET("/attendance", RequirePermission("attendance:read"), listAttendance)
 
 		// 4. Zakazivanje termina
-		api.POST("/appointments", createSchoolAppointment)
-		api.GET("/appointments", listSchoolAppointments)
-		api.PATCH("/appointments/:id/status", updateSchoolAppointmentStatus)
+		api.POST("/appointments", RequirePermission("appointments:create"), createSchoolAppointment)
+		api.GET("/appointments", RequirePermission("appointments:read"), listSchoolAppointments)
+		api.PATCH("/appointments/:id/status", RequirePermission("appointments:review"), updateSchoolAppointmentStatus)
 
 		// 5. Digitalno opravdavanje izostanaka
-		api.POST("/absences", createAbsenceJustification)
-		api.GET("/absences", listAbsenceJustifications)
-		api.PATCH("/absences/:id/status", updateAbsenceStatus)
+		api.POST("/absences", RequirePermission("absences:create"), createAbsenceJustification)
+		api.GET("/absences", RequirePermission("absences:read"), listAbsenceJustifications)
+		api.PATCH("/absences/:id/status", RequirePermission("absences:review"), updateAbsenceStatus)
+
+		// Obaveštenja
+		api.GET("/notifications", RequirePermission("notifications:read"), listNotifications)
+		api.PATCH("/notifications/:id/read", RequirePermission("notifications:read"), markNotificationRead)
+
+		// Dnevnik izmena
+		api.GET("/audit", verified, RequirePermission("audit:read"), listAuditEntries)
+		api.GET("/audit/verify", RequirePermission("audit:read"), verifyAuditChain)
 	}
 
 	return r
-}
\ No newline at end of file
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceTokens fetches client-credentials tokens for this service from
+// sso-service and reuses each one until shortly before it expires.
+type ServiceTokens struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewServiceTokens(ssoURL, clientID, clientSecret string) *ServiceTokens {
+	return &ServiceTokens{
+		TokenURL:     strings.TrimSuffix(ssoURL, "/") + "/oauth/token",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Client:       &http.Client{Timeout: 5 * time.Second, Transport: tracedTransport()},
+	}
+}
+
+func (t *ServiceTokens) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.ClientID, t.ClientSecret)
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("sso token endpoint: unexpected status %d", resp.StatusCode)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	t.token = body.AccessToken
+	// renew a little early so a token never expires on the way to the other service
+	t.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - 30*time.Second)
+	return t.token, nil
+}
+
+// Invalidate drops the cached token, for when the other service rejected it.
+func (t *ServiceTokens) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ""
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// absenceCertTypes are the medical certificate types that excuse a student
+// from school, from ABSENCE_CERT_TYPES.
+var absenceCertTypes = []string{"bolovanje"}
+
+// certificateReviewer is the reviewer of justifications approved by a
+// certificate rather than by staff.
+const certificateReviewer = "health-service"
+
+// Ages of the patients whose sick leave concerns the school.
+const (
+	schoolAgeMin = 6
+	schoolAgeMax = 19
+)
+
+// receiveSickLeave handles certificate.issued. A sick-leave certificate of a
+// school-age patient who is a student is kept as the student's SickLeave,
+// and absences already recorded in its period are justified; those recorded
+// later are justified by createAttendance. A certificate that only the
+// patient's name and date of birth tie to a student justifies nothing: it
+// is left to the class teacher as a pending justification. Other
+// certificates are ignored.
+func receiveSickLeave(ctx context.Context, tx *gorm.DB, e Event) error {
+	var cert HealthCertificate
+	if err := json.Unmarshal(e.Data, &cert); err != nil {
+		// it would fail the same way on every delivery
+		slog.Error("malformed event skipped", "event", e.ID, "type", e.Type, "error", err)
+		return nil
+	}
+	if !slices.Contains(absenceCertTypes, cert.Type) || cert.PatientID == "" {
+		return nil
+	}
+	if dob := cert.Patient.DateOfBirth; !dob.IsZero() {
+		if age := ageOn(dob, cert.ValidFrom); age < schoolAgeMin || age > schoolAgeMax {
+			return nil
+		}
+	}
+	logged := auditEvent(e)
+	student, match, err := certificateStudent(tx, cert, logged)
+	if err != nil {
+		return err
+	}
+	switch match {
+	case noStudent:
+		slog.Info("certificate holder is not a student", "event", e.ID, "certificate", cert.ID)
+		return nil
+	case sameNameStudent:
+		return reviewSickLeave(tx, student, cert, logged)
+	}
+	leave := SickLeave{
+		CertificateID: cert.ID,
+		StudentID:     student.ID,
+		ValidFrom:     cert.ValidFrom,
+		ValidTo:       cert.ValidTo,
+		ReceivedAt:    time.Now(),
+	}
+	if err := tx.Create(&leave).Error; err != nil {
+		return err
+	}
+	if err := logged(tx, auditCreate, "sick_leave", leave.CertificateID, nil, leave); err != nil {
+		return err
+	}
+	return justifySickLeave(tx, leave, logged)
+}
+
+// ageOn is the age in whole years on the given day.
+func ageOn(dob, on time.Time) int {
+	dob, on = dob.UTC(), on.UTC()
+	age := on.Year() - dob.Year()
+	if on.Month() < dob.Month() || on.Month() == dob.Month() && on.Day() < dob.Day() {
+		age--
+	}
+	return age
+}
+
+// studentMatch is how certificateStudent tied a certificate to a student.
+type studentMatch int
+
+const (
+	noStudent studentMatch = iota
+	// sameNameStudent has the patient's name and date of birth, and may be
+	// a namesake
+	sameNameStudent
+	// linkedStudent is linked to the patient or has the patient's account
+	linkedStudent
+)
+
+// certificateStudent finds the student cert was issued to: the one linked to
+// the patient, or else the one with the patient's account, who is then
+// linked to the patient for the next certificate. Failing both, it finds the
+// only student with the patient's name and date of birth who is not linked
+// to another patient, but links nobody on so weak a match.
+func certificateStudent(tx *gorm.DB, cert HealthCertificate, logged auditFunc) (Student, studentMatch, error) {
+	var student Student
+	result := tx.Where("health_patient_id = ?", cert.PatientID).Limit(1).Find(&student)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return student, linkedStudent, result.Error
+	}
+	if cert.Patient.UserID != "" {
+		result = tx.Where("user_id = ?", cert.Patient.UserID).Limit(1).Find(&student)
+		if result.Error != nil {
+			return student, noStudent, result.Error
+		}
+		if result.RowsAffected == 1 {
+			if student.HealthPatientID != nil {
+				// the account is linked to another patient record already;
+				// health-service holds two for one person
+				return student, noStudent, nil
+			}
+			before := student
+			if err := tx.Model(&student).Update("health_patient_id", cert.PatientID).Error; err != nil {
+				return student, noStudent, err
+			}
+			student.HealthPatientID = &cert.PatientID
+			return student, linkedStudent, logged(tx, auditUpdate, "student", student.ID, before, student)
+		}
+	}
+	dob := cert.Patient.DateOfBirth
+	if dob.IsZero() {
+		return student, noStudent, nil
+	}
+	var students []Student
+	err := tx.Where("LOWER(first_name) = LOWER(?) AND LOWER(last_name) = LOWER(?)",
+		strings.TrimSpace(cert.Patient.FirstName), strings.TrimSpace(cert.Patient.LastName)).Find(&students).Error
+	if err != nil {
+		return student, noStudent, err
+	}
+	students = slices.DeleteFunc(students, func(s Student) bool { return dateOf(s.DateOfBirth) != dateOf(dob) })
+	// a student linked to another patient record is a namesake
+	if len(students) != 1 || students[0].HealthPatientID != nil {
+		return student, noStudent, nil
+	}
+	return students[0], sameNameStudent, nil
+}
+
+// reviewSickLeave leaves a pending justification for the period of cert to
+// the class teacher, who knows whether the student was away, and tells them.
+func reviewSickLeave(tx *gorm.DB, student Student, cert HealthCertificate, logged auditFunc) error {
+	absence := AbsenceJustification{
+		StudentID: student.ID,
+		StartDate: cert.ValidFrom,
+		EndDate:   cert.ValidTo,
+		Reason:    "Bolovanje po lekarskom uverenju izdatom pacijentu istog imena i datuma rođenja",
+		// a certificate ID links the certificate, as when a parent picks it
+		DocumentURL: cert.ID,
+		Status:      "pending",
+	}
+	if err := tx.Create(&absence).Error; err != nil {
+		return err
+	}
+	if err := logged(tx, auditCreate, "absence", absence.ID, nil, absence); err != nil {
+		return err
+	}
+	return notifyClassTeacher(tx, absence)
+}
+
+// justifyAttendance justifies a newly recorded absence that falls in one of
+// the student's sick leaves.
+func justifyAttendance(tx *gorm.DB, att Attendance, logged auditFunc) error {
+	if att.Status != "absent" {
+		return nil
+	}
+	var leaves []SickLeave
+	err := tx.Where("student_id = ? AND valid_from <= ? AND valid_to >= ?", att.StudentID, att.Date, att.Date).
+		Find(&leaves).Error
+	if err != nil {
+		return err
+	}
+	for _, leave := range leaves {
+		if err := justifySickLeave(tx, leave, logged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// justifySickLeave justifies the student's absences in the period of leave
+// once one is recorded: the earliest pending justification that overlaps the
+// period is approved and widened to cover it, or else an approved one is
+// created for the whole period. Either references the certificate, and the
+// class teacher is notified. A leave is justified once, since that
+// justification covers every day of it.
+func justifySickLeave(tx *gorm.DB, leave SickLeave, logged auditFunc) error {
+	var n int64
+	if err := tx.Model(&AbsenceJustification{}).Where("health_cert_id = ?", leave.CertificateID).Count(&n).Error; err != nil || n > 0 {
+		return err
+	}
+	err := tx.Model(&Attendance{}).
+		Where("student_id = ? AND status = ? AND date BETWEEN ? AND ?", leave.StudentID, "absent", leave.ValidFrom, leave.ValidTo).
+		Count(&n).Error
+	if err != nil || n == 0 {
+		return err
+	}
+
+	var absence AbsenceJustification
+	result := tx.Where("student_id = ? AND status = ? AND health_cert_id IS NULL AND start_date <= ? AND end_date >= ?",
+		leave.StudentID, "pending", leave.ValidTo, leave.ValidFrom).Order("created_at").Limit(1).Find(&absence)
+	if result.Error != nil {
+		return result.Error
+	}
+	action, before := auditCreate, any(nil)
+	if result.RowsAffected == 1 {
+		action, before = auditUpdate, absence
+		start, end := absence.StartDate, absence.EndDate
+		if leave.ValidFrom.Before(start) {
+			start = leave.ValidFrom
+		}
+		if leave.ValidTo.After(end) {
+			end = leave.ValidTo
+		}
+		err = tx.Model(&absence).Updates(map[string]interface{}{
+			"start_date":     start,
+			"end_date":       end,
+			"status":         "approved",
+			"reviewed_by":    certificateReviewer,
+			"health_cert_id": leave.CertificateID,
+		}).Error
+		if err == nil {
+			err = tx.First(&absence, "id = ?", absence.ID).Error
+		}
+	} else {
+		absence = AbsenceJustification{
+			StudentID: leave.StudentID,
+			StartDate: leave.ValidFrom,
+			EndDate:   leave.ValidTo,
+			Reason:    "Bolovanje po lekarskom uverenju",
+			// a certificate ID links the certificate, as when a parent picks it
+			DocumentURL:  leave.CertificateID,
+			Status:       "approved",
+			ReviewedBy:   certificateReviewer,
+			HealthCertID: &leave.CertificateID,
+		}
+		err = tx.Create(&absence).Error
+	}
+	if err != nil {
+		return err
+	}
+	if err := logged(tx, action, "absence", absence.ID, before, absence); err != nil {
+		return err
+	}
+	if err := publishEvent(tx, eventAbsenceReviewed, absenceReviewed(absence)); err != nil {
+		return err
+	}
+	return notifyClassTeacher(tx, absence)
+}
+
+// notifyClassTeacher tells the teacher of the student's class that a
+// certificate justified the absence or, while it is pending, that the
+// teacher is to review it.
+func notifyClassTeacher(tx *gorm.DB, absence AbsenceJustification) error {
+	var student Student
+	if err := tx.First(&student, "id = ?", absence.StudentID).Error; err != nil {
+		return err
+	}
+	if student.ClassID == "" {
+		return nil
+	}
+	var class Class
+	if err := tx.Limit(1).Find(&class, "id = ?", student.ClassID).Error; err != nil || class.TeacherID == "" {
+		return err
+	}
+	kind, format := "absence.justified", "Izostanak učenika %s %s od %s do %s opravdan je lekarskim uverenjem."
+	if absence.Status == "pending" {
+		kind, format = "absence.review",
+			"Stiglo je lekarsko uverenje za učenika %s %s od %s do %s. Proverite da li je izdato njemu pre nego što odobrite opravdanje."
+	}
+	message := fmt.Sprintf(format,
+		student.FirstName, student.LastName, absence.StartDate.Format("02.01.2006."), absence.EndDate.Format("02.01.2006."))
+	return notify(tx, class.TeacherID, kind, "absence", absence.ID, message)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestAgeOn(t *testing.T) {
+	dob := time.Date(2012, time.March, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		on   string
+		want int
+	}{
+		{"2018-03-14", 5},
+		{"2018-03-15", 6},
+		{"2031-03-14", 18},
+		{"2032-01-10", 19},
+		{"2032-03-15", 20},
+	}
+	for _, tt := range tests {
+		on, _ := time.Parse("2006-01-02", tt.on)
+		if got := ageOn(dob, on); got != tt.want {
+			t.Errorf("ageOn(%s) = %d, want %d", tt.on, got, tt.want)
+		}
+	}
+}
+
+// The sick leave of the tests runs from Monday to Friday; the student is ten.
+var (
+	leaveFrom  = date("2026-03-02")
+	leaveTo    = date("2026-03-06")
+	studentDOB = date("2016-01-20")
+)
+
+const classTeacher = "user-nastavnik"
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// enrolledStudent creates a student in a class of classTeacher.
+func enrolledStudent(t *testing.T, userID, firstName, lastName string, dob time.Time) Student {
+	t.Helper()
+	class := Class{Name: "IV-2", Year: 4, TeacherID: classTeacher}
+	if err := db.Create(&class).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := Student{UserID: userID, FirstName: firstName, LastName: lastName, DateOfBirth: dob, ClassID: class.ID}
+	if err := db.Create(&s).Error; err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// sickLeaveEvent is certificate.issued for a sick leave of the patient from
+// leaveFrom to leaveTo.
+func sickLeaveEvent(t *testing.T, patientID, userID, firstName, lastName string, dob time.Time) Event {
+	t.Helper()
+	cert := HealthCertificate{ID: uuid.NewString(), PatientID: patientID, Type: "bolovanje", ValidFrom: leaveFrom, ValidTo: leaveTo}
+	cert.Patient.UserID = userID
+	cert.Patient.FirstName = firstName
+	cert.Patient.LastName = lastName
+	cert.Patient.DateOfBirth = dob
+	data, err := json.Marshal(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Event{ID: uuid.NewString(), Type: eventCertificateIssued, Source: "health-service", OccurredAt: time.Now(), Data: data}
+}
+
+// recordAbsence records the student absent on day as createAttendance does.
+func recordAbsence(t *testing.T, studentID string, day time.Time) {
+	t.Helper()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		att := Attendance{StudentID: studentID, Date: day, Period: 1, Status: "absent", TeacherID: classTeacher}
+		if err := tx.Create(&att).Error; err != nil {
+			return err
+		}
+		return justifyAttendance(tx, att, auditEvent(Event{ID: uuid.NewString(), Source: classTeacher}))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func justifications(t *testing.T, studentID string) []AbsenceJustification {
+	t.Helper()
+	var list []AbsenceJustification
+	if err := db.Where("student_id = ?", studentID).Order("created_at").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func teacherNotifications(t *testing.T) []Notification {
+	t.Helper()
+	var list []Notification
+	if err := db.Where("user_id = ?", classTeacher).Order("created_at").Find(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func handle(t *testing.T, e Event) {
+	t.Helper()
+	if err := handleEvent(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSickLeaveMatchesStudent checks which certificates reach a student: a
+// strong match justifies and links, a name and date of birth alone only ask
+// the class teacher, and anything less does nothing.
+func TestSickLeaveMatchesStudent(t *testing.T) {
+	patient := uuid.NewString()
+	tests := []struct {
+		name string
+		// setup creates the students and returns the one concerned
+		setup func(t *testing.T) Student
+		event func(t *testing.T) Event
+		// want is the status of the student's one justification, or ""
+		want   string
+		linked bool
+	}{
+		{
+			name:  "account",
+			setup: func(t *testing.T) Student { return enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB) },
+			event: func(t *testing.T) Event {
+				return sickLeaveEvent(t, patient, "u-ana", "Ana Marija", "Jović", studentDOB)
+			},
+			want:   "approved",
+			linked: true,
+		},
+		{
+			name: "linked patient",
+			setup: func(t *testing.T) Student {
+				s := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+				if err := db.Model(&s).Update("health_patient_id", patient).Error; err != nil {
+					t.Fatal(err)
+				}
+				return s
+			},
+			event:  func(t *testing.T) Event { return sickLeaveEvent(t, patient, "", "", "", time.Time{}) },
+			want:   "approved",
+			linked: true,
+		},
+		{
+			name:  "name and date of birth",
+			setup: func(t *testing.T) Student { return enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB) },
+			event: func(t *testing.T) Event { return sickLeaveEvent(t, patient, "", " ana ", "JOVIĆ", studentDOB) },
+			want:  "pending",
+		},
+		{
+			name: "two namesakes",
+			setup: func(t *testing.T) Student {
+				enrolledStudent(t, "u-ana2", "Ana", "Jović", studentDOB)
+				return enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+			},
+			event: func(t *testing.T) Event { return sickLeaveEvent(t, patient, "", "Ana", "Jović", studentDOB) },
+		},
+		{
+			name: "namesake linked to another patient",
+			setup: func(t *testing.T) Student {
+				s := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+				if err := db.Model(&s).Update("health_patient_id", uuid.NewString()).Error; err != nil {
+					t.Fatal(err)
+				}
+				return s
+			},
+			event: func(t *testing.T) Event { return sickLeaveEvent(t, patient, "", "Ana", "Jović", studentDOB) },
+		},
+		{
+			name:  "other date of birth",
+			setup: func(t *testing.T) Student { return enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB) },
+			event: func(t *testing.T) Event {
+				return sickLeaveEvent(t, patient, "", "Ana", "Jović", studentDOB.AddDate(0, 0, 1))
+			},
+		},
+		{
+			name: "adult",
+			setup: func(t *testing.T) Student {
+				return enrolledStudent(t, "u-ana", "Ana", "Jović", leaveFrom.AddDate(-schoolAgeMax-1, 0, 0))
+			},
+			event: func(t *testing.T) Event {
+				return sickLeaveEvent(t, patient, "u-ana", "Ana", "Jović", leaveFrom.AddDate(-schoolAgeMax-1, 0, 0))
+			},
+		},
+		{
+			name: "under school age",
+			setup: func(t *testing.T) Student {
+				return enrolledStudent(t, "u-ana", "Ana", "Jović", leaveFrom.AddDate(-5, 0, 0))
+			},
+			event: func(t *testing.T) Event {
+				return sickLeaveEvent(t, patient, "u-ana", "Ana", "Jović", leaveFrom.AddDate(-5, 0, 0))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDatabase(t)
+			student := tt.setup(t)
+			recordAbsence(t, student.ID, leaveFrom.AddDate(0, 0, 1))
+			handle(t, tt.event(t))
+
+			list := justifications(t, student.ID)
+			var got string
+			if len(list) == 1 {
+				got = list[0].Status
+			}
+			if len(list) > 1 || got != tt.want {
+				t.Errorf("justifications %+v, want one %q", list, tt.want)
+			}
+			if err := db.First(&student, "id = ?", student.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if linked := student.HealthPatientID != nil && *student.HealthPatientID == patient; linked != tt.linked {
+				t.Errorf("student linked to the patient: %v, want %v", linked, tt.linked)
+			}
+			var leaves int64
+			db.Model(&SickLeave{}).Where("student_id = ?", student.ID).Count(&leaves)
+			if want := tt.want == "approved"; (leaves == 1) != want {
+				t.Errorf("%d sick leaves kept, want one: %v", leaves, want)
+			}
+		})
+	}
+}
+
+// TestJustifySickLeave checks that a certificate approves the pending
+// justification it overlaps, widened to the whole leave, or else creates
+// one, and that either covers absences recorded later.
+func TestJustifySickLeave(t *testing.T) {
+	tests := []struct {
+		name string
+		// pending is the period a parent asked to justify, if any
+		pending    []time.Time
+		start, end time.Time
+	}{
+		{"no request", nil, leaveFrom, leaveTo},
+		{"request within the leave", []time.Time{date("2026-03-04"), date("2026-03-05")}, leaveFrom, leaveTo},
+		{"request past the leave", []time.Time{date("2026-03-05"), date("2026-03-10")}, leaveFrom, date("2026-03-10")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDatabase(t)
+			student := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+			var requested string
+			if tt.pending != nil {
+				a := AbsenceJustification{StudentID: student.ID, StartDate: tt.pending[0], EndDate: tt.pending[1],
+					Reason: "Prehlada", Status: "pending"}
+				if err := db.Create(&a).Error; err != nil {
+					t.Fatal(err)
+				}
+				requested = a.ID
+			}
+			recordAbsence(t, student.ID, date("2026-03-04"))
+			e := sickLeaveEvent(t, uuid.NewString(), "u-ana", "Ana", "Jović", studentDOB)
+			handle(t, e)
+			// absences on the other days of the leave are recorded later
+			recordAbsence(t, student.ID, leaveFrom)
+			recordAbsence(t, student.ID, leaveTo)
+
+			list := justifications(t, student.ID)
+			if len(list) != 1 {
+				t.Fatalf("justifications %+v, want one", list)
+			}
+			a := list[0]
+			if requested != "" && a.ID != requested {
+				t.Errorf("created %s instead of approving the request %s", a.ID, requested)
+			}
+			if a.Status != "approved" || a.ReviewedBy != certificateReviewer || a.HealthCertID == nil {
+				t.Errorf("justification %+v, want approved by the certificate", a)
+			}
+			if !a.StartDate.Equal(tt.start) || !a.EndDate.Equal(tt.end) {
+				t.Errorf("justified %s to %s, want %s to %s", a.StartDate, a.EndDate, tt.start, tt.end)
+			}
+			if n := len(teacherNotifications(t)); n != 1 {
+				t.Errorf("teacher notified %d times, want once", n)
+			}
+		})
+	}
+}
+
+// TestSickLeaveRedelivered handles one certificate.issued twice, as after a
+// crash before the bus recorded it.
+func TestSickLeaveRedelivered(t *testing.T) {
+	testDatabase(t)
+	student := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+	recordAbsence(t, student.ID, leaveFrom)
+	e := sickLeaveEvent(t, uuid.NewString(), "u-ana", "Ana", "Jović", studentDOB)
+	handle(t, e)
+	handle(t, e)
+
+	counts := map[string]any{
+		"sick leaves":      &SickLeave{},
+		"justifications":   &AbsenceJustification{},
+		"notifications":    &Notification{},
+		"processed events": &ProcessedEvent{},
+	}
+	for name, model := range counts {
+		var n int64
+		if err := db.Model(model).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("%d %s, want 1", n, name)
+		}
+	}
+}
+
+// TestJustifyAttendanceAfterCertificate checks that a certificate received
+// before any absence justifies the first one recorded in its period.
+func TestJustifyAttendanceAfterCertificate(t *testing.T) {
+	testDatabase(t)
+	student := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+	handle(t, sickLeaveEvent(t, uuid.NewString(), "u-ana", "Ana", "Jović", studentDOB))
+	if list := justifications(t, student.ID); len(list) != 0 {
+		t.Fatalf("justified %+v before any absence", list)
+	}
+
+	recordAbsence(t, student.ID, leaveTo.AddDate(0, 0, 3))
+	if list := justifications(t, student.ID); len(list) != 0 {
+		t.Fatalf("an absence after the leave justified %+v", list)
+	}
+	recordAbsence(t, student.ID, date("2026-03-03"))
+	list := justifications(t, student.ID)
+	if len(list) != 1 || list[0].Status != "approved" || !list[0].StartDate.Equal(leaveFrom) || !list[0].EndDate.Equal(leaveTo) {
+		t.Errorf("justifications %+v, want the leave approved", list)
+	}
+}
+
+func TestNotifyClassTeacher(t *testing.T) {
+	testDatabase(t)
+	student := enrolledStudent(t, "u-ana", "Ana", "Jović", studentDOB)
+	for _, status := range []string{"approved", "pending"} {
+		a := AbsenceJustification{StudentID: student.ID, StartDate: leaveFrom, EndDate: leaveTo, Reason: "Bolovanje", Status: status}
+		if err := db.Create(&a).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := notifyClassTeacher(db, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := teacherNotifications(t)
+	if len(list) != 2 || list[0].Kind != "absence.justified" || list[1].Kind != "absence.review" {
+		t.Fatalf("notifications %+v, want absence.justified then absence.review", list)
+	}
+	for _, n := range list {
+		if !strings.Contains(n.Message, "Ana Jović od 02.03.2026. do 06.03.2026.") || n.Entity != "absence" {
+			t.Errorf("notification %+v does not name the student and the period", n)
+		}
+	}
+
+	// nobody to tell when the class is gone or has no teacher
+	loner := Student{UserID: "u-marko", FirstName: "Marko", LastName: "Ilić", DateOfBirth: studentDOB, ClassID: uuid.NewString()}
+	if err := db.Create(&loner).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := notifyClassTeacher(db, AbsenceJustification{StudentID: loner.ID, Status: "approved"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&Class{}).Where("true").Update("teacher_id", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := notifyClassTeacher(db, AbsenceJustification{StudentID: student.ID, Status: "approved"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(teacherNotifications(t)); n != 2 {
+		t.Errorf("%d notifications, want no new ones", n)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSOUser is the profile returned by sso-service /users endpoints.
+type SSOUser struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+}
+
+// SSOClient calls sso-service on behalf of the current user, forwarding
+// the user's bearer token.
+type SSOClient struct {
+	URL    string
+	Client *http.Client
+}
+
+var sso *SSOClient
+
+func NewSSOClient(url string) *SSOClient {
+	return &SSOClient{URL: strings.TrimSuffix(url, "/"), Client: &http.Client{Timeout: 5 * time.Second, Transport: tracedTransport()}}
+}
+
+func (s *SSOClient) get(c *gin.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, s.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.GetHeader("Authorization"))
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sso %s: unexpected status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Me returns the profile of the user making the request.
+func (s *SSOClient) Me(c *gin.Context) (SSOUser, error) {
+	var u SSOUser
+	err := s.get(c, "/users/me", &u)
+	return u, err
+}
+
+// User returns the name and role of any user; the caller needs a staff role.
+func (s *SSOClient) User(c *gin.Context, id string) (SSOUser, error) {
+	var u SSOUser
+	err := s.get(c, "/users/"+id, &u)
+	return u, err
+}
+
+// SSOWard is a child the user is the verified guardian of.
+type SSOWard struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Relation  string `json:"relation"`
+}
+
+// Wards returns the children the user making the request may act for.
+func (s *SSOClient) Wards(c *gin.Context) ([]SSOWard, error) {
+	var wards []SSOWard
+	err := s.get(c, "/users/me/wards", &wards)
+	return wards, err
+}
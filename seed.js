@@ -1,5 +1,7 @@
 // EUprava25 - Seed skripta (Node.js, bez eksternih zavisnosti)
 // Pokretanje: node seed.js
+// SSO mora biti pokrenut sa BOOTSTRAP_ADMIN_EMAIL=admin@test.rs, jer se
+// privilegovane uloge (lekar, nastavnik, ...) dodeljuju samo preko administratora.
 
 const BASE = "http://localhost:8080/api";
 
@@ -45,19 +47,58 @@ async function main() {
   section("1. Registracija korisnika");
 
   const USERS = [
-    ["pacijent@test.rs",        "test1234", "pacijent",          "Ana",       "Petrović"],
-    ["lekar@test.rs",           "test1234", "lekar",             "Marko",     "Jovanović"],
-    ["medicinska@test.rs",      "test1234", "medicinska_sestra", "Jelena",    "Nikolić"],
-    ["zdravstvo.admin@test.rs", "test1234", "administrator",     "Zdravko",   "Adminović"],
-    ["ucenik@test.rs",          "test1234", "ucenik",            "Petar",     "Lazarević"],
-    ["roditelj@test.rs",        "test1234", "roditelj",          "Milica",    "Lazarević"],
-    ["nastavnik@test.rs",       "test1234", "nastavnik",         "Ivan",      "Đorđević"],
-    ["skola.admin@test.rs",     "test1234", "administracija",    "Sanja",     "Mitrović"],
+    ["pacijent@test.rs",        "test1234", "pacijent",          "Ana",       "Petrović",  "1503985710010"],
+    ["lekar@test.rs",           "test1234", "lekar",             "Marko",     "Jovanović", "0207978710011"],
+    ["medicinska@test.rs",      "test1234", "medicinska_sestra", "Jelena",    "Nikolić",   "1109990710010"],
+    ["zdravstvo.admin@test.rs", "test1234", "administrator",     "Zdravko",   "Adminović", "2503978710017"],
+    ["ucenik@test.rs",          "test1234", "ucenik",            "Petar",     "Lazarević", "1405011710011"],
+    ["roditelj@test.rs",        "test1234", "roditelj",          "Milica",    "Lazarević", "0908984710013"],
+    ["nastavnik@test.rs",       "test1234", "nastavnik",         "Ivan",      "Đorđević",  "3006979710010"],
+    ["skola.admin@test.rs",     "test1234", "administracija",    "Sanja",     "Mitrović",  "1812987710010"],
   ];
 
+  // samoregistracija je dozvoljena samo za uloge građana
+  const CITIZEN_ROLES = ["pacijent", "ucenik", "roditelj"];
+  const ADMIN_EMAIL = "admin@test.rs";
+
+  await post("/auth/register", { email: ADMIN_EMAIL, password: "test1234", role: "pacijent", first_name: "Glavni", last_name: "Administrator" });
+
   for (const [email, pwd, role, fn, ln] of USERS) {
-    const r = await post("/auth/register", { email, password: pwd, role, first_name: fn, last_name: ln });
-    console.log(r ? `  ✓ Registrovan: ${email} [${role}]` : `  → Već postoji: ${email}`);
+    const selfRole = CITIZEN_ROLES.includes(role) ? role : "pacijent";
+    const r = await post("/auth/register", { email, password: pwd, role: selfRole, first_name: fn, last_name: ln });
+    console.log(r ? `  ✓ Registrovan: ${email} [${selfRole}]` : `  → Već postoji: ${email}`);
+  }
+
+  section("1b. Potvrda email adresa, identiteta i dodela privilegovanih uloga");
+
+  const adminLogin = await post("/auth/login", { email: ADMIN_EMAIL, password: "test1234" });
+  const IDS = {};
+  for (const [email, pwd, role, fn, ln, jmbg] of USERS) {
+    if (!adminLogin) break;
+    const l = await post("/auth/login", { email, password: pwd });
+    const v = l && await get("/auth/verify", l.token);
+    if (!v) continue;
+    IDS[email] = v.sub;
+    if (!v.email_verified) {
+      ok(`Email potvrđen → ${email}`, await post(`/auth/admin/users/${v.sub}/email-verified`, null, adminLogin.token));
+    }
+    // osetljive operacije u zdravstvu i školi traže identitet proveren na šalteru
+    if (v.ial < 2) {
+      ok(`Identitet proveren → ${email}`,
+        await post(`/auth/admin/users/${v.sub}/identity`, { jmbg, first_name: fn, last_name: ln }, adminLogin.token)
+      );
+    }
+    if (CITIZEN_ROLES.includes(role)) continue;
+    ok(`Uloga ${role} → ${email}`,
+      await post(`/auth/admin/users/${v.sub}/roles`, { role, primary: true }, adminLogin.token)
+    );
+  }
+
+  // roditelj zastupa dete u školi i zdravstvu tek kada je starateljstvo potvrđeno
+  if (adminLogin && IDS["roditelj@test.rs"] && IDS["ucenik@test.rs"]) {
+    ok("Starateljstvo: roditelj@test.rs → ucenik@test.rs",
+      await post("/auth/admin/guardianships", { guardian_id: IDS["roditelj@test.rs"], child_id: IDS["ucenik@test.rs"], relation: "roditelj" }, adminLogin.token)
+    );
   }
 
   // ── 2. Login ───────────────────────────────────────────
@@ -193,8 +234,8 @@ async function main() {
   const enrollment = ok("Zahtjev za upis",
     await post("/school/enrollments", { first_name: "Petar", last_name: "Lazarević", date_of_birth: "2012-09-10", school_year: "2025/2026", notes: "Upis u 7. razred" }, T.roditelj)
   );
-  if (enrollment) ok("Upis odobren",
-    await patch(`/school/enrollments/${enrollment.id}/status`, { status: "approved", notes: "Dokumentacija kompletna" }, T.skol_admin)
+  if (enrollment) ok("Upis: tražena dokumentacija",
+    await patch(`/school/enrollments/${enrollment.id}/status`, { status: "documents_required", reason: "Nedostaje lekarsko uverenje" }, T.skol_admin)
   );
 
   // ── 12. Škola: ocjene i prisustvo ─────────────────────
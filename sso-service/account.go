@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Purposes of single-use tokens sent by email.
+const (
+	tokenPasswordReset = "password_reset"
+	tokenEmailVerify   = "email_verify"
+
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+)
+
+var (
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	ErrAlreadyVerified  = errors.New("email already verified")
+)
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// issueUserToken creates a single-use token and invalidates any earlier
+// unused token of the same purpose, so only the latest email link works.
+func (s AuthService) issueUserToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	tok, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+	q := `DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err = tx.Exec(ctx, q, userID, purpose); err != nil {
+		return "", err
+	}
+	q = `INSERT INTO user_tokens (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, q, hashToken(tok), userID, purpose, time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return tok, tx.Commit(ctx)
+}
+
+func (s AuthService) link(path, token string) string {
+	return s.AppURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func (s AuthService) sendMail(ctx context.Context, m Mail) {
+	if s.Mailer == nil {
+		return
+	}
+	if err := s.Mailer.Send(ctx, m); err != nil {
+		log.Printf("[mail] sending %q to %s failed: %v", m.Subject, m.To, err)
+	}
+}
+
+// ForgotPassword emails a reset link. Unknown addresses are ignored without
+// an error and the mail goes out in the background, so the response does not
+// reveal whether an account exists.
+func (s AuthService) ForgotPassword(ctx context.Context, email string) error {
+	var userID string
+	if err := s.DB.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&userID); err != nil {
+		return nil
+	}
+	tok, err := s.issueUserToken(ctx, userID, tokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	go s.sendMail(context.Background(), Mail{
+		To:      email,
+		Subject: "eUprava — promena lozinke",
+		Body: "Primili smo zahtev za promenu lozinke za vaš nalog.\n\n" +
+			"Novu lozinku možete postaviti na sledećem linku (važi 1 sat):\n" + s.link("/reset-password", tok) + "\n\n" +
+			"Ako niste tražili promenu lozinke, ignorišite ovu poruku.\n",
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed token. All sessions are
+// revoked, and the email counts as verified since the user just proved
+// access to it.
+func (s AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID string
+	q := `UPDATE user_tokens SET used_at = now()
+	      WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+	      RETURNING user_id`
+	if err = tx.QueryRow(ctx, q, hashToken(token), tokenPasswordReset).Scan(&userID); err != nil {
+		return ErrInvalidUserToken
+	}
+	q = `UPDATE users SET password_hash = $2, email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, userID, string(hash)); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ChangePassword replaces the password of a logged in user after checking
+// the current one. Every other session of the user is signed out.
+func (s AuthService) ChangePassword(ctx context.Context, userID, sessionID, current, password string) error {
+	var ph string
+	if err := s.DB.QueryRow(ctx, `SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&ph); err != nil {
+		return ErrUserNotFound
+	}
+	if bcrypt.CompareHashAndPassword([]byte(ph), []byte(current)) != nil {
+		return ErrInvalidCreds
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, string(hash)); err != nil {
+		return err
+	}
+	q := `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2`
+	if _, err = tx.Exec(ctx, q, userID, sessionID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// SendVerification emails a link that confirms the account's address.
+func (s AuthService) SendVerification(ctx context.Context, userID string) error {
+	var email string
+	var verified bool
+	q := `SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1`
+	if err := s.DB.QueryRow(ctx, q, userID).Scan(&email, &verified); err != nil {
+		return ErrUserNotFound
+	}
+	if verified {
+		return ErrAlreadyVerified
+	}
+	tok, err := s.issueUserToken(ctx, userID, tokenEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+	s.sendMail(ctx, Mail{
+		To:      email,
+		Subject: "eUprava — potvrda email adrese",
+		Body: "Dobrodošli na portal eUprava.\n\n" +
+			"Potvrdite svoju email adresu na sledećem linku (važi 48 sati):\n" + s.link("/verify-email", tok) + "\n\n" +
+			"Dok adresa nije potvrđena, nalog ima ograničen pristup.\n",
+	})
+	return nil
+}
+
+func (s AuthService) VerifyEmail(ctx context.Context, token string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var userID string
+	q := `UPDATE user_tokens SET used_at = now()
+	      WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > now()
+	      RETURNING user_id`
+	if err = tx.QueryRow(ctx, q, hashToken(token), tokenEmailVerify).Scan(&userID); err != nil {
+		return ErrInvalidUserToken
+	}
+	if err = markEmailVerified(ctx, tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// MarkEmailVerified lets an administrator confirm an address without the email round trip.
+func (s AuthService) MarkEmailVerified(ctx context.Context, userID string) error {
+	return markEmailVerified(ctx, s.DB, userID)
+}
+
+func markEmailVerified(ctx context.Context, db execer, userID string) error {
+	tag, err := db.Exec(ctx, `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id::text = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if err := h.Svc.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset link has been sent"})
+}
+
+func (h AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if err := h.Svc.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	sub, _ := claims["sub"].(string)
+	sid, _ := claims["sid"].(string)
+	if err := h.Svc.ChangePassword(c.Request.Context(), sub, sid, req.CurrentPassword, req.NewPassword); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if err := h.Svc.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h AuthHandler) ResendVerification(c *gin.Context) {
+	sub, _ := c.MustGet("claims").(jwt.MapClaims)["sub"].(string)
+	if err := h.Svc.SendVerification(c.Request.Context(), sub); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (h AuthHandler) AdminVerifyEmail(c *gin.Context) {
+	if err := h.Svc.MarkEmailVerified(c.Request.Context(), c.Param("id")); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func accountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidUserToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidCreds):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+	case errors.Is(err, ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	default:
+		serverError(c, err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmailLinkCarriesToken(t *testing.T) {
+	s := AuthService{AppURL: "https://portal.example"}
+	tok, err := newRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := s.link("/verify-email", tok)
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("link %q: %v", link, err)
+	}
+	if u.Host != "portal.example" || u.Path != "/verify-email" {
+		t.Errorf("link %q does not point at the portal's /verify-email", link)
+	}
+	if got := u.Query().Get("token"); got != tok {
+		t.Errorf("link carries token %q, want %q", got, tok)
+	}
+}
+
+func TestUserTokensAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		tok, err := newRefreshToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tok) != 43 || seen[tok] {
+			t.Fatalf("token %q is short or repeated", tok)
+		}
+		seen[tok] = true
+	}
+}
+
+func TestLogMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := LogMailer{Dir: dir, From: "eUprava <no-reply@euprava.local>"}
+	err := m.Send(context.Background(), Mail{
+		To:      "ana/../x@example.com",
+		Subject: "eUprava — potvrda email adrese",
+		Body:    "prvi red\ndrugi red\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("got files %v, want one .eml in %s", files, dir)
+	}
+	if strings.Contains(filepath.Base(files[0]), "/") || filepath.Dir(files[0]) != dir {
+		t.Errorf("message written outside the mail directory: %s", files[0])
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(raw)
+	for _, want := range []string{"To: ana/../x@example.com\r\n", "Subject: eUprava — potvrda email adrese\r\n", "\r\n\r\nprvi red\r\ndrugi red\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
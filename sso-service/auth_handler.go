@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -18,6 +19,9 @@ var validRoles = map[string]bool{
 	"administracija": true, "administrator": true, "admin": true,
 }
 
+// adminRoles may manage the SSO itself: keys, clients and role assignments.
+var adminRoles = []string{"admin", "administrator"}
+
 type RegisterReq struct {
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=6"`
@@ -32,7 +36,17 @@ type LoginReq struct {
 }
 
 type TokenResp struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type RefreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutReq struct {
+	All bool `json:"all"`
 }
 
 func (h AuthHandler) Register(c *gin.Context) {
@@ -49,13 +63,17 @@ func (h AuthHandler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
 		return
 	}
+	if !citizenRoles[role] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "role must be granted by an administrator"})
+		return
+	}
 
 	id, created, err := h.Svc.Register(c.Request.Context(), req.Email, req.Password, role, req.FirstName, req.LastName)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
 			c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error: " + err.Error()})
+			serverError(c, err)
 		}
 		return
 	}
@@ -68,12 +86,72 @@ func (h AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
-	tok, err := h.Svc.Login(c.Request.Context(), req.Email, req.Password)
+	pair, challenge, err := h.Svc.Login(c.Request.Context(), req.Email, req.Password, loginSource(c))
+	if err != nil {
+		var te *ThrottledError
+		if errors.As(err, &te) {
+			throttled(c, te)
+		} else if errors.Is(err, ErrInvalidCreds) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		} else if errors.Is(err, ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		} else {
+			serverError(c, err)
+		}
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, MFAPendingResp{
+			MFARequired: true,
+			MFAToken:    challenge.Token,
+			ExpiresIn:   challenge.ExpiresIn,
+			Enroll:      challenge.Enroll,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, tokenResp(pair))
+}
+
+func (h AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	pair, err := h.Svc.Refresh(c.Request.Context(), req.RefreshToken, "")
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		if errors.Is(err, ErrInvalidRefresh) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		} else {
+			serverError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, tokenResp(pair))
+}
+
+func (h AuthHandler) Logout(c *gin.Context) {
+	var req LogoutReq
+	// body is optional
+	_ = c.ShouldBindJSON(&req)
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
 		return
 	}
-	c.JSON(http.StatusOK, TokenResp{Token: tok})
+	if err := h.Svc.Logout(c.Request.Context(), sub, jti, sid, exp.Time, req.All); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func tokenResp(p TokenPair) TokenResp {
+	return TokenResp{Token: p.AccessToken, RefreshToken: p.RefreshToken, ExpiresIn: p.ExpiresIn}
 }
 
 func (h AuthHandler) Verify(c *gin.Context) {
@@ -87,7 +165,18 @@ func (h AuthHandler) Verify(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
 		return
 	}
+	sub, _ := claims["sub"].(string)
+	active, err := h.Svc.IsActive(c.Request.Context(), sub)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	if !active {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrAccountDisabled.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"sub": claims["sub"], "email": claims["email"], "role": claims["role"], "exp": claims["exp"],
+		"sub": claims["sub"], "email": claims["email"], "email_verified": claims["email_verified"],
+		"role": claims["role"], "roles": claims["roles"], "ial": claims["ial"], "act": claims["act"], "exp": claims["exp"],
 	})
 }
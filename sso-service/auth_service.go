@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -10,9 +11,15 @@ import (
 )
 
 type AuthService struct {
-	DB       *pgxpool.Pool
+	DB         *pgxpool.Pool
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Mailer sends verification and password reset links pointing at AppURL.
+	Mailer   Mailer
+	AppURL   string
+	Throttle LoginThrottle
 	JWTMaker interface {
-		Make(userID, email, role, firstName, lastName string) (string, error)
+		Make(id Identity) (string, error)
 	}
 }
 
@@ -26,25 +33,127 @@ func (s AuthService) Register(ctx context.Context, email, password, role, firstN
 		return "", "", err
 	}
 
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback(ctx)
+
 	var t time.Time
 	q := `INSERT INTO users (email, password_hash, role, first_name, last_name)
 	      VALUES ($1, $2, $3, $4, $5)
 	      RETURNING id, created_at`
-	if err = s.DB.QueryRow(ctx, q, email, string(hash), role, firstName, lastName).
+	if err = tx.QueryRow(ctx, q, email, string(hash), role, firstName, lastName).
 		Scan(&id, &t); err != nil {
 		return "", "", err
 	}
+	if _, err = tx.Exec(ctx, `INSERT INTO user_roles (user_id, role) VALUES ($1, $2)`, id, role); err != nil {
+		return "", "", err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return "", "", err
+	}
+	if err := s.SendVerification(ctx, id); err != nil {
+		log.Printf("[auth] verification email for %s: %v", email, err)
+	}
 	return id, t.Format(time.RFC3339), nil
 }
 
-func (s AuthService) Login(ctx context.Context, email, password string) (token string, err error) {
-	var id, role, ph, firstName, lastName string
-	q := `SELECT id, role, password_hash, first_name, last_name FROM users WHERE email = $1`
-	if err = s.DB.QueryRow(ctx, q, email).Scan(&id, &role, &ph, &firstName, &lastName); err != nil {
-		return "", ErrInvalidCreds
+// dummyHash is compared against when the email is unknown, so a missing
+// account takes as long to reject as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-password"), bcrypt.DefaultCost)
+
+// Login checks the password and opens a session. Accounts with two-factor
+// authentication get a challenge instead of tokens.
+func (s AuthService) Login(ctx context.Context, email, password string, src LoginSource) (TokenPair, *MFAChallenge, error) {
+	ident, err := s.Authenticate(ctx, email, password, src)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+	ch, err := s.beginMFA(ctx, ident)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+	if ch != nil {
+		s.audit(ctx, ident.Email, ident.UserID, src, true, auditMFAPending)
+		return TokenPair{}, ch, nil
+	}
+	s.loginSucceeded(ctx, ident.Email, ident.UserID, src)
+	pair, err := s.startSession(ctx, ident)
+	return pair, nil, err
+}
+
+// Authenticate checks the credentials and loads the identity that goes into
+// tokens. It does not open a session. Failures count towards the account and
+// address throttles; while either is blocked, a *ThrottledError is returned
+// without looking at the password.
+func (s AuthService) Authenticate(ctx context.Context, email, password string, src LoginSource) (Identity, error) {
+	keys := []string{accountKey(email), addressKey(src.IP)}
+	wait, err := s.Throttle.Check(ctx, keys...)
+	if err != nil {
+		return Identity{}, err
+	}
+	if wait > 0 {
+		s.audit(ctx, email, "", src, false, auditThrottled)
+		return Identity{}, &ThrottledError{RetryAfter: wait}
+	}
+
+	ident, err := s.checkPassword(ctx, email, password)
+	if errors.Is(err, ErrInvalidCreds) {
+		s.audit(ctx, email, ident.UserID, src, false, auditBadPassword)
+		for _, k := range keys {
+			if ferr := s.Throttle.Fail(ctx, k); ferr != nil {
+				return Identity{}, ferr
+			}
+		}
+	}
+	if err != nil {
+		return Identity{}, err
+	}
+	return ident, nil
+}
+
+// loginSucceeded clears the account's failures once the whole login,
+// including a second factor, has gone through.
+func (s AuthService) loginSucceeded(ctx context.Context, email, userID string, src LoginSource) {
+	s.audit(ctx, email, userID, src, true, auditOK)
+	_ = s.Throttle.Reset(ctx, accountKey(email))
+}
+
+func (s AuthService) checkPassword(ctx context.Context, email, password string) (Identity, error) {
+	ident := Identity{Email: email}
+	var ph string
+	var deactivated bool
+	q := `SELECT id, role, ` + rolesColumn + `, password_hash, first_name, last_name, email_verified_at IS NOT NULL,
+	             ial, deactivated_at IS NOT NULL
+	      FROM users u WHERE email = $1`
+	if err := s.DB.QueryRow(ctx, q, email).Scan(&ident.UserID, &ident.Role, &ident.Roles, &ph,
+		&ident.FirstName, &ident.LastName, &ident.EmailVerified, &ident.IAL, &deactivated); err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Identity{}, ErrInvalidCreds
 	}
 	if bcrypt.CompareHashAndPassword([]byte(ph), []byte(password)) != nil {
-		return "", ErrInvalidCreds
+		return Identity{UserID: ident.UserID}, ErrInvalidCreds
+	}
+	// only revealed to someone who knows the password
+	if deactivated {
+		return Identity{}, ErrAccountDisabled
+	}
+	return ident, nil
+}
+
+// Identity loads the current token attributes of a user by ID. Deactivated
+// accounts yield ErrAccountDisabled.
+func (s AuthService) Identity(ctx context.Context, userID string) (Identity, error) {
+	ident := Identity{UserID: userID}
+	var deactivated bool
+	q := `SELECT email, role, ` + rolesColumn + `, first_name, last_name, email_verified_at IS NOT NULL,
+	             ial, deactivated_at IS NOT NULL
+	      FROM users u WHERE id = $1`
+	err := s.DB.QueryRow(ctx, q, userID).Scan(&ident.Email, &ident.Role, &ident.Roles,
+		&ident.FirstName, &ident.LastName, &ident.EmailVerified, &ident.IAL, &deactivated)
+	if err == nil && deactivated {
+		err = ErrAccountDisabled
 	}
-	return s.JWTMaker.Make(id, email, role, firstName, lastName)
+	return ident, err
 }
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// delegableServices may be named in a delegation; the names match the
+// "services" claim checked by each service.
+var delegableServices = map[string]bool{"health": true, "school": true}
+
+const maxDelegation = 365 * 24 * time.Hour
+
+// Delegation lets the delegate act for the principal in the listed services
+// until it expires or either side revokes it.
+type Delegation struct {
+	ID            string     `json:"id"`
+	PrincipalID   string     `json:"principal_id"`
+	PrincipalName string     `json:"principal_name"`
+	DelegateID    string     `json:"delegate_id"`
+	DelegateName  string     `json:"delegate_name"`
+	Services      []string   `json:"services"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	Active        bool       `json:"active"`
+}
+
+var (
+	ErrDelegationNotFound = errors.New("delegation not found")
+	ErrSelfDelegation     = errors.New("cannot delegate to yourself")
+	ErrDelegationServices = errors.New("services must be a non-empty subset of health, school")
+	ErrDelegationExpiry   = errors.New("expires_at must be in the future and at most one year away")
+)
+
+const delegationColumns = `d.id, d.principal_id, p.first_name || ' ' || p.last_name,
+	d.delegate_id, a.first_name || ' ' || a.last_name, d.services, d.expires_at, d.created_at, d.revoked_at,
+	d.revoked_at IS NULL AND d.expires_at > now()
+	FROM delegations d
+	JOIN users p ON p.id = d.principal_id
+	JOIN users a ON a.id = d.delegate_id`
+
+func scanDelegation(row rowScanner) (Delegation, error) {
+	var d Delegation
+	err := row.Scan(&d.ID, &d.PrincipalID, &d.PrincipalName, &d.DelegateID, &d.DelegateName,
+		&d.Services, &d.ExpiresAt, &d.CreatedAt, &d.RevokedAt, &d.Active)
+	return d, err
+}
+
+// GrantDelegation gives the user with delegateEmail the right to act for the
+// principal in the given services until expiresAt.
+func (s AuthService) GrantDelegation(ctx context.Context, principalID, delegateEmail string, services []string, expiresAt time.Time) (Delegation, error) {
+	if len(services) == 0 {
+		return Delegation{}, ErrDelegationServices
+	}
+	for _, svc := range services {
+		if !delegableServices[svc] {
+			return Delegation{}, ErrDelegationServices
+		}
+	}
+	if !expiresAt.After(time.Now()) || time.Until(expiresAt) > maxDelegation {
+		return Delegation{}, ErrDelegationExpiry
+	}
+	var delegateID string
+	q := `SELECT id FROM users WHERE email = $1 AND deactivated_at IS NULL`
+	if err := s.DB.QueryRow(ctx, q, strings.TrimSpace(delegateEmail)).Scan(&delegateID); err != nil {
+		return Delegation{}, ErrUserNotFound
+	}
+	if delegateID == principalID {
+		return Delegation{}, ErrSelfDelegation
+	}
+	var id string
+	q = `INSERT INTO delegations (principal_id, delegate_id, services, expires_at) VALUES ($1, $2, $3, $4) RETURNING id`
+	if err := s.DB.QueryRow(ctx, q, principalID, delegateID, services, expiresAt).Scan(&id); err != nil {
+		return Delegation{}, err
+	}
+	return scanDelegation(s.DB.QueryRow(ctx, `SELECT `+delegationColumns+` WHERE d.id = $1`, id))
+}
+
+// Delegations lists what the user granted and what was granted to them.
+func (s AuthService) Delegations(ctx context.Context, userID string) ([]Delegation, error) {
+	q := `SELECT ` + delegationColumns + `
+	      WHERE d.principal_id::text = $1 OR d.delegate_id::text = $1
+	      ORDER BY d.created_at DESC`
+	rows, err := s.DB.Query(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Delegation{}
+	for rows.Next() {
+		d, err := scanDelegation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// RevokeDelegation ends a delegation; both the principal and the delegate may
+// do so. Tokens already issued stay valid until they expire, at most AccessTTL.
+func (s AuthService) RevokeDelegation(ctx context.Context, id, userID string) error {
+	q := `UPDATE delegations SET revoked_at = now()
+	      WHERE id::text = $1 AND revoked_at IS NULL AND (principal_id::text = $2 OR delegate_id::text = $2)`
+	tag, err := s.DB.Exec(ctx, q, id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDelegationNotFound
+	}
+	return nil
+}
+
+// DelegatedToken issues an access token for the principal of a delegation,
+// with the delegate as actor. It is bound to the delegate's session, so
+// logging out ends it too, and it comes without a refresh token.
+func (s AuthService) DelegatedToken(ctx context.Context, id, delegateID, sessionID string, src LoginSource) (TokenPair, error) {
+	var principalID string
+	actor := Actor{DelegationID: id}
+	q := `SELECT principal_id, services, expires_at FROM delegations
+	      WHERE id::text = $1 AND delegate_id::text = $2 AND revoked_at IS NULL AND expires_at > now()`
+	if err := s.DB.QueryRow(ctx, q, id, delegateID).Scan(&principalID, &actor.Services, &actor.ExpiresAt); err != nil {
+		return TokenPair{}, ErrDelegationNotFound
+	}
+	ident, err := s.Identity(ctx, principalID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	delegate, err := s.Identity(ctx, delegateID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	actor.UserID, actor.Email = delegate.UserID, delegate.Email
+	// the weaker of the two identities is what the service can rely on
+	if delegate.IAL < ident.IAL {
+		ident.IAL = delegate.IAL
+	}
+	ident.SessionID = sessionID
+	ident.Actor = &actor
+
+	token, err := s.JWTMaker.Make(ident)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	q = `INSERT INTO login_audit (email, user_id, actor_id, ip, user_agent, success, reason)
+	     VALUES ($1, $2, $3, $4, $5, TRUE, $6)`
+	if _, err = s.DB.Exec(ctx, q, ident.Email, ident.UserID, delegate.UserID, src.IP, src.UserAgent, auditDelegated); err != nil {
+		return TokenPair{}, err
+	}
+	countLogin(true, auditDelegated)
+	ttl := s.AccessTTL
+	if left := time.Until(actor.ExpiresAt); left < ttl {
+		ttl = left
+	}
+	return TokenPair{AccessToken: token, ExpiresIn: int(ttl.Seconds())}, nil
+}
+
+// RejectDelegated keeps delegated tokens away from account management: a
+// delegate may act for the principal in services, never change the account.
+func RejectDelegated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.MustGet("claims").(jwt.MapClaims)["act"]; ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with a delegated token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+type DelegationHandler struct {
+	Svc AuthService
+}
+
+type GrantDelegationReq struct {
+	DelegateEmail string    `json:"delegate_email" binding:"required,email"`
+	Services      []string  `json:"services" binding:"required"`
+	ExpiresAt     time.Time `json:"expires_at" binding:"required"`
+}
+
+func (h DelegationHandler) List(c *gin.Context) {
+	list, err := h.Svc.Delegations(c.Request.Context(), claimsSub(c))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h DelegationHandler) Grant(c *gin.Context) {
+	var req GrantDelegationReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	d, err := h.Svc.GrantDelegation(c.Request.Context(), claimsSub(c), req.DelegateEmail, req.Services, req.ExpiresAt)
+	if err != nil {
+		delegationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, d)
+}
+
+func (h DelegationHandler) Revoke(c *gin.Context) {
+	if err := h.Svc.RevokeDelegation(c.Request.Context(), c.Param("id"), claimsSub(c)); err != nil {
+		delegationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Token is called by the delegate to get a token for acting as the principal.
+func (h DelegationHandler) Token(c *gin.Context) {
+	sid, _ := c.MustGet("claims").(jwt.MapClaims)["sid"].(string)
+	pair, err := h.Svc.DelegatedToken(c.Request.Context(), c.Param("id"), claimsSub(c), sid, loginSource(c))
+	if err != nil {
+		delegationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": pair.AccessToken, "expires_in": pair.ExpiresIn})
+}
+
+func delegationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrDelegationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, ErrSelfDelegation), errors.Is(err, ErrDelegationServices), errors.Is(err, ErrDelegationExpiry):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		serverError(c, err)
+	}
+}
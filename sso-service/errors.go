@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes sent with sanitized errors. Clients see the code and the
+// request ID; the underlying error is only logged.
+const (
+	errCodeInternal = "internal_error"
+	errCodeUpstream = "upstream_error"
+)
+
+// serverError logs err and answers 500 without exposing it: database errors
+// carry SQL and the values that failed.
+func serverError(c *gin.Context, err error) {
+	reqLogger(c).Error("request failed", "code", errCodeInternal, "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal error", "code": errCodeInternal, "request_id": c.GetString("requestID"),
+	})
+}
+
+// upstreamError logs err and answers 502 with msg, for failed calls to
+// another service.
+func upstreamError(c *gin.Context, msg string, err error) {
+	reqLogger(c).Error(msg, "code", errCodeUpstream, "error", err)
+	c.JSON(http.StatusBadGateway, gin.H{
+		"error": msg, "code": errCodeUpstream, "request_id": c.GetString("requestID"),
+	})
+}
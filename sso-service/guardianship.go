@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Guardianship links a parent or legal guardian to a child's account. It
+// takes effect once verified at a counter and ends when the child turns 18.
+type Guardianship struct {
+	ID             string     `json:"id"`
+	GuardianID     string     `json:"guardian_id"`
+	GuardianName   string     `json:"guardian_name"`
+	ChildID        string     `json:"child_id"`
+	ChildName      string     `json:"child_name"`
+	ChildBirthDate *time.Time `json:"child_birth_date"`
+	Relation       string     `json:"relation"`
+	Status         string     `json:"status"` // pending, active, expired or revoked
+	ValidUntil     *time.Time `json:"valid_until"`
+	RequestedAt    time.Time  `json:"requested_at"`
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Ward is a child the user may currently act for.
+type Ward struct {
+	ID         string    `json:"id"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	BirthDate  time.Time `json:"birth_date"`
+	Relation   string    `json:"relation"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+var validRelations = map[string]bool{"roditelj": true, "staratelj": true}
+
+var (
+	ErrGuardianshipNotFound = errors.New("guardianship not found")
+	ErrGuardianshipExists   = errors.New("guardianship already exists")
+	ErrChildNotMinor        = errors.New("child must have a verified birth date and be under 18")
+	ErrSelfGuardianship     = errors.New("cannot be your own guardian")
+)
+
+// an active link is verified, not revoked, and the child is still a minor
+const guardianshipActive = `g.verified_at IS NOT NULL AND g.revoked_at IS NULL
+	AND ch.birth_date + interval '18 years' > current_date`
+
+const guardianshipColumns = `g.id, g.guardian_id, gu.first_name || ' ' || gu.last_name,
+	g.child_id, ch.first_name || ' ' || ch.last_name, ch.birth_date, g.relation,
+	CASE WHEN g.revoked_at IS NOT NULL THEN 'revoked'
+	     WHEN ch.birth_date + interval '18 years' <= current_date THEN 'expired'
+	     WHEN g.verified_at IS NULL THEN 'pending'
+	     ELSE 'active' END,
+	(ch.birth_date + interval '18 years')::date, g.requested_at, g.verified_at, g.revoked_at`
+
+const guardianshipFrom = ` FROM guardianships g
+	JOIN users gu ON gu.id = g.guardian_id
+	JOIN users ch ON ch.id = g.child_id`
+
+func scanGuardianship(row rowScanner) (Guardianship, error) {
+	var g Guardianship
+	err := row.Scan(&g.ID, &g.GuardianID, &g.GuardianName, &g.ChildID, &g.ChildName, &g.ChildBirthDate,
+		&g.Relation, &g.Status, &g.ValidUntil, &g.RequestedAt, &g.VerifiedAt, &g.RevokedAt)
+	return g, err
+}
+
+func (s AuthService) queryGuardianships(ctx context.Context, where string, args ...any) ([]Guardianship, error) {
+	rows, err := s.DB.Query(ctx, `SELECT `+guardianshipColumns+guardianshipFrom+` WHERE `+where+
+		` ORDER BY g.requested_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []Guardianship{}
+	for rows.Next() {
+		g, err := scanGuardianship(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+func (s AuthService) Guardianship(ctx context.Context, id string) (Guardianship, error) {
+	g, err := scanGuardianship(s.DB.QueryRow(ctx, `SELECT `+guardianshipColumns+guardianshipFrom+` WHERE g.id::text = $1`, id))
+	if err != nil {
+		return Guardianship{}, ErrGuardianshipNotFound
+	}
+	return g, nil
+}
+
+// RequestGuardianship records a pending claim of the guardian over the child
+// with the given JMBG, to be verified at a counter. Only a verified
+// identity is matched, since anyone can claim a number. It answers the same
+// whether or not the JMBG belongs to a minor with an account, so it cannot
+// be used to look people up; the counter sees every request it made.
+func (s AuthService) RequestGuardianship(ctx context.Context, guardianID, childJMBG, relation string) error {
+	if _, err := ParseJMBG(childJMBG); err != nil {
+		return err
+	}
+	var childID string
+	q := `SELECT id FROM users WHERE jmbg = $1 AND ial >= $2`
+	if err := s.DB.QueryRow(ctx, q, childJMBG, ialVerified).Scan(&childID); err != nil {
+		return nil
+	}
+	_, err := s.createGuardianship(ctx, guardianID, childID, relation, "")
+	switch {
+	case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrChildNotMinor), errors.Is(err, ErrGuardianshipExists):
+		return nil
+	}
+	return err
+}
+
+// AddGuardianship creates an already verified link, for officials who
+// checked the birth certificate in person.
+func (s AuthService) AddGuardianship(ctx context.Context, guardianID, childID, relation, verifiedBy string) (Guardianship, error) {
+	return s.createGuardianship(ctx, guardianID, childID, relation, verifiedBy)
+}
+
+func (s AuthService) createGuardianship(ctx context.Context, guardianID, childID, relation, verifiedBy string) (Guardianship, error) {
+	if guardianID == childID {
+		return Guardianship{}, ErrSelfGuardianship
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return Guardianship{}, err
+	}
+	defer tx.Rollback(ctx)
+	if err = checkMinor(ctx, tx, childID); err != nil {
+		return Guardianship{}, err
+	}
+	var id string
+	q := `INSERT INTO guardianships (guardian_id, child_id, relation, verified_at, verified_by)
+	      VALUES ($1, $2, $3, CASE WHEN $4 <> '' THEN now() END, NULLIF($4, '')::uuid)
+	      RETURNING id`
+	if err = tx.QueryRow(ctx, q, guardianID, childID, relation, verifiedBy).Scan(&id); err != nil {
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+			return Guardianship{}, ErrGuardianshipExists
+		}
+		if strings.Contains(err.Error(), "foreign key") {
+			return Guardianship{}, ErrUserNotFound
+		}
+		return Guardianship{}, err
+	}
+	if verifiedBy != "" {
+		if err = grantParentRole(ctx, tx, guardianID, verifiedBy); err != nil {
+			return Guardianship{}, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Guardianship{}, err
+	}
+	return s.Guardianship(ctx, id)
+}
+
+// VerifyGuardianship confirms a pending request. The guardian gets the
+// roditelj role if they did not have it.
+func (s AuthService) VerifyGuardianship(ctx context.Context, id, verifiedBy string) (Guardianship, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return Guardianship{}, err
+	}
+	defer tx.Rollback(ctx)
+	var guardianID, childID string
+	q := `SELECT guardian_id, child_id FROM guardianships WHERE id::text = $1 AND revoked_at IS NULL FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, id).Scan(&guardianID, &childID); err != nil {
+		return Guardianship{}, ErrGuardianshipNotFound
+	}
+	if err = checkMinor(ctx, tx, childID); err != nil {
+		return Guardianship{}, err
+	}
+	q = `UPDATE guardianships SET verified_at = COALESCE(verified_at, now()), verified_by = COALESCE(verified_by, $2::uuid)
+	     WHERE id::text = $1`
+	if _, err = tx.Exec(ctx, q, id, verifiedBy); err != nil {
+		return Guardianship{}, err
+	}
+	if err = grantParentRole(ctx, tx, guardianID, verifiedBy); err != nil {
+		return Guardianship{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Guardianship{}, err
+	}
+	return s.Guardianship(ctx, id)
+}
+
+// RevokeGuardianship ends a link. A non-empty guardianID limits it to links
+// of that guardian, so parents can withdraw only their own.
+func (s AuthService) RevokeGuardianship(ctx context.Context, id, guardianID string) error {
+	q := `UPDATE guardianships SET revoked_at = now()
+	      WHERE id::text = $1 AND revoked_at IS NULL AND ($2 = '' OR guardian_id::text = $2)`
+	tag, err := s.DB.Exec(ctx, q, id, guardianID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGuardianshipNotFound
+	}
+	return nil
+}
+
+// Wards lists the children a user may currently act for.
+func (s AuthService) Wards(ctx context.Context, guardianID string) ([]Ward, error) {
+	q := `SELECT ch.id, ch.first_name, ch.last_name, ch.birth_date, g.relation,
+	             (ch.birth_date + interval '18 years')::date
+	      FROM guardianships g JOIN users ch ON ch.id = g.child_id
+	      WHERE g.guardian_id::text = $1 AND ch.deactivated_at IS NULL AND ` + guardianshipActive + `
+	      ORDER BY ch.birth_date`
+	rows, err := s.DB.Query(ctx, q, guardianID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	wards := []Ward{}
+	for rows.Next() {
+		var w Ward
+		if err = rows.Scan(&w.ID, &w.FirstName, &w.LastName, &w.BirthDate, &w.Relation, &w.ValidUntil); err != nil {
+			return nil, err
+		}
+		wards = append(wards, w)
+	}
+	return wards, rows.Err()
+}
+
+// Guardians lists the active guardians of a child.
+func (s AuthService) Guardians(ctx context.Context, childID string) ([]Guardianship, error) {
+	return s.queryGuardianships(ctx, `g.child_id::text = $1 AND `+guardianshipActive, childID)
+}
+
+// checkMinor requires a child whose birth date was checked at a counter; a
+// self-asserted JMBG or birth date proves nothing.
+func checkMinor(ctx context.Context, tx pgx.Tx, childID string) error {
+	var minor *bool
+	var ial int
+	q := `SELECT birth_date + interval '18 years' > current_date, ial FROM users WHERE id::text = $1`
+	if err := tx.QueryRow(ctx, q, childID).Scan(&minor, &ial); err != nil {
+		return ErrUserNotFound
+	}
+	if ial < ialVerified || minor == nil || !*minor {
+		return ErrChildNotMinor
+	}
+	return nil
+}
+
+func grantParentRole(ctx context.Context, tx pgx.Tx, userID, grantedBy string) error {
+	q := `INSERT INTO user_roles (user_id, role, granted_by) VALUES ($1, 'roditelj', NULLIF($2, '')::uuid)
+	      ON CONFLICT (user_id, role) DO NOTHING`
+	_, err := tx.Exec(ctx, q, userID, grantedBy)
+	return err
+}
+
+type GuardianshipHandler struct {
+	Svc AuthService
+}
+
+type RequestGuardianshipReq struct {
+	ChildJMBG string `json:"child_jmbg" binding:"required"`
+	Relation  string `json:"relation"`
+}
+
+type AddGuardianshipReq struct {
+	GuardianID string `json:"guardian_id" binding:"required"`
+	ChildID    string `json:"child_id" binding:"required"`
+	Relation   string `json:"relation"`
+}
+
+func relationOrDefault(r string) (string, bool) {
+	r = strings.TrimSpace(r)
+	if r == "" {
+		r = "roditelj"
+	}
+	return r, validRelations[r]
+}
+
+// List returns the links where the user is either the guardian or the child.
+// Guardians see a link only once it is verified: a pending one would tell
+// them that the JMBG they typed belongs to someone.
+func (h GuardianshipHandler) List(c *gin.Context) {
+	sub := claimsSub(c)
+	list, err := h.Svc.queryGuardianships(c.Request.Context(),
+		`(g.guardian_id::text = $1 AND g.verified_at IS NOT NULL) OR g.child_id::text = $1`, sub)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h GuardianshipHandler) Request(c *gin.Context) {
+	var req RequestGuardianshipReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	relation, ok := relationOrDefault(req.Relation)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid relation"})
+		return
+	}
+	if err := h.Svc.RequestGuardianship(c.Request.Context(), claimsSub(c), strings.TrimSpace(req.ChildJMBG), relation); err != nil {
+		guardianshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+}
+
+func (h GuardianshipHandler) Withdraw(c *gin.Context) {
+	if err := h.Svc.RevokeGuardianship(c.Request.Context(), c.Param("id"), claimsSub(c)); err != nil {
+		guardianshipError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Wards is queried by school-service and health-service with the parent's
+// own token to find out whom the parent may act for.
+func (h GuardianshipHandler) Wards(c *gin.Context) {
+	wards, err := h.Svc.Wards(c.Request.Context(), claimsSub(c))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wards)
+}
+
+// Guardians is open to the child, staff and admins.
+func (h GuardianshipHandler) Guardians(c *gin.Context) {
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	id := c.Param("id")
+	if id != claimsSub(c) && !hasStaffRole(claims) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	list, err := h.Svc.Guardians(c.Request.Context(), id)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h GuardianshipHandler) AdminList(c *gin.Context) {
+	where := "TRUE"
+	switch c.Query("status") {
+	case "pending":
+		where = "g.verified_at IS NULL AND g.revoked_at IS NULL"
+	case "active":
+		where = guardianshipActive
+	case "":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	list, err := h.Svc.queryGuardianships(c.Request.Context(), where)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (h GuardianshipHandler) Add(c *gin.Context) {
+	var req AddGuardianshipReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	relation, ok := relationOrDefault(req.Relation)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid relation"})
+		return
+	}
+	g, err := h.Svc.AddGuardianship(c.Request.Context(), req.GuardianID, req.ChildID, relation, claimsSub(c))
+	if err != nil {
+		guardianshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, g)
+}
+
+func (h GuardianshipHandler) Verify(c *gin.Context) {
+	g, err := h.Svc.VerifyGuardianship(c.Request.Context(), c.Param("id"), claimsSub(c))
+	if err != nil {
+		guardianshipError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
+
+func (h GuardianshipHandler) Revoke(c *gin.Context) {
+	if err := h.Svc.RevokeGuardianship(c.Request.Context(), c.Param("id"), ""); err != nil {
+		guardianshipError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func guardianshipError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrGuardianshipNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, ErrInvalidJMBG), errors.Is(err, ErrSelfGuardianship):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrGuardianshipExists), errors.Is(err, ErrChildNotMinor):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		serverError(c, err)
+	}
+}
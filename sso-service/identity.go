@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Identity assurance levels, carried in the "ial" claim.
+const (
+	ialSelfAsserted = 1 // registered online, attributes typed in by the user
+	ialVerified     = 2 // checked against an ID document at a counter
+)
+
+var (
+	ErrInvalidJMBG      = errors.New("invalid JMBG")
+	ErrJMBGTaken        = errors.New("JMBG already belongs to another account")
+	ErrIdentityVerified = errors.New("identity is verified and can only be changed at a counter")
+)
+
+// ParseJMBG validates a JMBG (DDMMYYYRRBBBK) and returns the birth date
+// encoded in it. The check digit follows the modulo 11 rule.
+func ParseJMBG(s string) (time.Time, error) {
+	if len(s) != 13 {
+		return time.Time{}, ErrInvalidJMBG
+	}
+	var d [13]int
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return time.Time{}, ErrInvalidJMBG
+		}
+		d[i] = int(s[i] - '0')
+	}
+
+	sum := 0
+	for i := 0; i < 6; i++ {
+		sum += (7 - i) * (d[i] + d[i+6])
+	}
+	k := 11 - sum%11
+	if k > 9 {
+		k = 0
+	}
+	if d[12] != k {
+		return time.Time{}, ErrInvalidJMBG
+	}
+
+	day := d[0]*10 + d[1]
+	month := d[2]*10 + d[3]
+	year := d[4]*100 + d[5]*10 + d[6]
+	// only the last three digits of the year are stored: 9xx is 19xx, 0xx is 20xx
+	if year >= 800 {
+		year += 1000
+	} else {
+		year += 2000
+	}
+	birth := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if birth.Day() != day || int(birth.Month()) != month || birth.After(time.Now()) {
+		return time.Time{}, ErrInvalidJMBG
+	}
+	return birth, nil
+}
+
+// SetJMBG stores a self-asserted JMBG. Once the identity has been verified
+// the number is fixed. Self-asserted numbers need not be unique: anyone can
+// type in someone else's, and only a verified identity holds it for good.
+func (s AuthService) SetJMBG(ctx context.Context, userID, jmbg string) (User, error) {
+	birth, err := ParseJMBG(jmbg)
+	if err != nil {
+		return User{}, err
+	}
+	var ial int
+	if err = s.DB.QueryRow(ctx, `SELECT ial FROM users WHERE id::text = $1`, userID).Scan(&ial); err != nil {
+		return User{}, ErrUserNotFound
+	}
+	if ial >= ialVerified {
+		return User{}, ErrIdentityVerified
+	}
+	q := `UPDATE users SET jmbg = $2, birth_date = $3 WHERE id::text = $1`
+	if _, err = s.DB.Exec(ctx, q, userID, jmbg, birth); err != nil {
+		return User{}, jmbgError(err)
+	}
+	return s.User(ctx, userID)
+}
+
+// VerifyIdentity records that an official checked the user's ID document.
+// The JMBG and names from the document replace whatever the user entered,
+// and the number is taken away from any account that only claimed it.
+func (s AuthService) VerifyIdentity(ctx context.Context, userID, jmbg, firstName, lastName, verifiedBy string) (User, error) {
+	birth, err := ParseJMBG(jmbg)
+	if err != nil {
+		return User{}, err
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback(ctx)
+	q := `UPDATE users SET jmbg = NULL, birth_date = NULL WHERE jmbg = $2 AND ial < $3 AND id::text <> $1`
+	if _, err = tx.Exec(ctx, q, userID, jmbg, ialVerified); err != nil {
+		return User{}, err
+	}
+	q = `UPDATE users SET jmbg = $2, birth_date = $3, first_name = $4, last_name = $5,
+	            ial = $6, identity_verified_at = now(), identity_verified_by = $7
+	     WHERE id::text = $1`
+	tag, err := tx.Exec(ctx, q, userID, jmbg, birth, firstName, lastName, ialVerified, verifiedBy)
+	if err != nil {
+		return User{}, jmbgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return User{}, ErrUserNotFound
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return User{}, err
+	}
+	return s.User(ctx, userID)
+}
+
+func jmbgError(err error) error {
+	if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+		return ErrJMBGTaken
+	}
+	return err
+}
+
+type SetJMBGReq struct {
+	JMBG string `json:"jmbg" binding:"required"`
+}
+
+type VerifyIdentityReq struct {
+	JMBG      string `json:"jmbg" binding:"required"`
+	FirstName string `json:"first_name" binding:"required,max=100"`
+	LastName  string `json:"last_name" binding:"required,max=100"`
+}
+
+func (h UserHandler) SetJMBG(c *gin.Context) {
+	var req SetJMBGReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	u, err := h.Svc.SetJMBG(c.Request.Context(), claimsSub(c), strings.TrimSpace(req.JMBG))
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+func (h UserHandler) VerifyIdentity(c *gin.Context) {
+	var req VerifyIdentityReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	u, err := h.Svc.VerifyIdentity(c.Request.Context(), c.Param("id"), strings.TrimSpace(req.JMBG),
+		strings.TrimSpace(req.FirstName), strings.TrimSpace(req.LastName), claimsSub(c))
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseJMBG(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		jmbg string
+		want time.Time // zero for invalid
+	}{
+		{"0101990710008", date(1990, 1, 1)},
+		{"1503985710002", date(1985, 3, 15)},
+		{"2902000710009", date(2000, 2, 29)},
+		// a remainder of 0 or 1 gives 11 or 10, written as check digit 0
+		{"1503985710010", date(1985, 3, 15)},
+		{"1503985710070", date(1985, 3, 15)},
+		// 800 and above is the 1000s, below it the 2000s
+		{"0101800710007", date(1800, 1, 1)},
+		{"0101799710006", time.Time{}}, // 2799, in the future
+		{"0101099710005", time.Time{}}, // 2099, in the future
+
+		{"0101990710009", time.Time{}}, // wrong check digit
+		{"1503985710071", time.Time{}}, // 1 where 10 must be written as 0
+		{"2902999710000", time.Time{}}, // 29 Feb 1999
+		{"3104000710009", time.Time{}}, // 31 Apr
+		{"0113000710007", time.Time{}}, // month 13
+		{"0001000710004", time.Time{}}, // day 0
+		{"010199071000", time.Time{}},
+		{"01019907100008", time.Time{}},
+		{"01019907100a8", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseJMBG(tt.jmbg)
+		if tt.want.IsZero() {
+			if !errors.Is(err, ErrInvalidJMBG) {
+				t.Errorf("ParseJMBG(%q) = %v, %v; want ErrInvalidJMBG", tt.jmbg, got, err)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseJMBG(%q) = %v, %v; want %v", tt.jmbg, got, err, tt.want)
+		}
+	}
+}
@@ -3,31 +3,200 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Identity holds the user attributes that end up in an access token.
+type Identity struct {
+	UserID    string
+	Email     string
+	Role      string
+	Roles     []string
+	FirstName string
+	LastName  string
+	SessionID string
+	// EmailVerified is false until the user confirms the address; such
+	// tokens carry only citizen roles.
+	EmailVerified bool
+	// IAL is the identity assurance level, see ialSelfAsserted and ialVerified.
+	IAL int
+	// Actor is set when another user acts for this one under a delegation.
+	Actor *Actor
+	// ClientID is the OIDC client a token is issued to, and Scope what the
+	// user granted it; both are empty for the portal.
+	ClientID string
+	Scope    string
+}
+
+// Actor is the delegate behind a token issued under a delegation. Such
+// tokens carry an "act" claim and are limited to the delegated services.
+type Actor struct {
+	UserID       string
+	Email        string
+	DelegationID string
+	Services     []string
+	ExpiresAt    time.Time
+}
+
+// tokenRoles returns the role claims, limited to citizen roles while the
+// email address is unverified and under a delegation: staff powers are never
+// delegated.
+func (id Identity) tokenRoles() (string, []string) {
+	if id.EmailVerified && id.Actor == nil {
+		return id.Role, id.Roles
+	}
+	roles := []string{}
+	for _, r := range id.Roles {
+		if citizenRoles[r] {
+			roles = append(roles, r)
+		}
+	}
+	role := id.Role
+	if !citizenRoles[role] {
+		role = ""
+		if len(roles) > 0 {
+			role = roles[0]
+		}
+	}
+	return role, roles
+}
+
+// Token audiences. Portal tokens are for the services behind the portal. An
+// OIDC client is granted no more than the user's profile, so its access
+// tokens are only for the userinfo endpoint.
+const (
+	audienceSSO      = "sso"
+	audienceUserInfo = "userinfo"
+)
+
+// portalAudience is the aud claim of portal access tokens.
+var portalAudience = []string{audienceSSO, "school", "health"}
+
+// accessTokenType is the typ header of access tokens (RFC 9068). id_tokens
+// keep the plain JWT type, so no service takes one for a bearer token.
+const accessTokenType = "at+jwt"
+
+// oidcScopes are the scopes an OIDC client may be granted.
+var oidcScopes = []string{"openid", "profile", "email"}
+
+// grantedScope keeps the OIDC scopes of a requested scope, in order.
+func grantedScope(scope string) string {
+	var granted []string
+	for _, s := range strings.Fields(scope) {
+		if slices.Contains(oidcScopes, s) && !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+// scopeCovers reports whether scope holds s.
+func scopeCovers(scope, s string) bool {
+	return slices.Contains(strings.Fields(scope), s)
+}
+
 type Maker struct {
-	Secret []byte
+	Keys   *KeyStore
 	TTL    time.Duration
+	Issuer string
 }
 
-func (m Maker) Make(userID, email, role, firstName, lastName string) (string, error) {
+// Make issues an access token. A token for an OIDC client names the client
+// in azp and carries the granted scope instead of the user's roles.
+func (m Maker) Make(id Identity) (string, error) {
 	now := time.Now().UTC()
 	claims := jwt.MapClaims{
-		"iss":        "euprava25-sso",
-		"sub":        userID,
-		"email":      email,
-		"role":       role,
-		"first_name": firstName,
-		"last_name":  lastName,
-		"iat":        now.Unix(),
-		"exp":        now.Add(m.TTL).Unix(),
-		"jti":        jti(email, now),
-	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(m.Secret)
+		"iss": m.Issuer,
+		"sub": id.UserID,
+		"iat": now.Unix(),
+		"exp": now.Add(m.TTL).Unix(),
+		"jti": jti(id.Email, now),
+	}
+	if id.SessionID != "" {
+		claims["sid"] = id.SessionID
+	}
+	if id.ClientID != "" {
+		claims["aud"] = []string{audienceUserInfo}
+		claims["azp"] = id.ClientID
+		claims["scope"] = id.Scope
+		return m.sign(claims, accessTokenType)
+	}
+	role, roles := id.tokenRoles()
+	claims["aud"] = portalAudience
+	claims["email"] = id.Email
+	claims["email_verified"] = id.EmailVerified
+	claims["role"] = role
+	claims["roles"] = roles
+	claims["first_name"] = id.FirstName
+	claims["last_name"] = id.LastName
+	claims["ial"] = id.IAL
+	if a := id.Actor; a != nil {
+		claims["act"] = map[string]any{"sub": a.UserID, "email": a.Email}
+		claims["delegation_id"] = a.DelegationID
+		claims["services"] = a.Services
+		if a.ExpiresAt.Before(now.Add(m.TTL)) {
+			claims["exp"] = a.ExpiresAt.Unix()
+		}
+	}
+	return m.sign(claims, accessTokenType)
+}
+
+// MakeIDToken issues an OpenID Connect id_token for the given client, with
+// the claims of the scope the user granted it. It is for the client to read
+// and is accepted as a bearer token nowhere.
+func (m Maker) MakeIDToken(id Identity, clientID, nonce string, authTime time.Time) (string, error) {
+	now := time.Now().UTC()
+	claims := jwt.MapClaims{
+		"iss":       m.Issuer,
+		"sub":       id.UserID,
+		"aud":       clientID,
+		"auth_time": authTime.Unix(),
+		"iat":       now.Unix(),
+		"exp":       now.Add(m.TTL).Unix(),
+	}
+	for k, v := range profileClaims(id) {
+		claims[k] = v
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return m.sign(claims, "JWT")
+}
+
+// profileClaims are the user claims the scope of id covers; a portal
+// identity has no scope and gets them all.
+func profileClaims(id Identity) map[string]any {
+	claims := map[string]any{}
+	if id.ClientID == "" || scopeCovers(id.Scope, "email") {
+		claims["email"] = id.Email
+		claims["email_verified"] = id.EmailVerified
+	}
+	if id.ClientID == "" || scopeCovers(id.Scope, "profile") {
+		role, roles := id.tokenRoles()
+		claims["role"] = role
+		claims["roles"] = roles
+		claims["first_name"] = id.FirstName
+		claims["last_name"] = id.LastName
+		claims["given_name"] = id.FirstName
+		claims["family_name"] = id.LastName
+		claims["ial"] = id.IAL
+	}
+	return claims
+}
+
+func (m Maker) sign(claims jwt.MapClaims, typ string) (string, error) {
+	key, err := m.Keys.Signing()
+	if err != nil {
+		return "", err
+	}
+	t := jwt.NewWithClaims(key.method(), claims)
+	t.Header["kid"] = key.Kid
+	t.Header["typ"] = typ
+	return t.SignedString(key.Private)
 }
 
 func jti(email string, t time.Time) string {
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys is a key ring with one active EdDSA key, without a database.
+func testKeys(t *testing.T) *KeyStore {
+	t.Helper()
+	kid, priv, err := generateKey("EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := &KeyStore{Alg: "EdDSA"}
+	ks.keys = []*signingKey{{Kid: kid, Alg: "EdDSA", Private: priv, ActivatesAt: time.Now().Add(-time.Minute)}}
+	return ks
+}
+
+type revokedSet map[string]bool
+
+func (r revokedSet) IsRevoked(_ context.Context, jti, _ string) (bool, error) { return r[jti], nil }
+
+// authStatus runs token through the Auth middleware of the portal, or of
+// the given audiences.
+func authStatus(ks *KeyStore, revoked RevocationChecker, token string, audiences ...string) int {
+	if len(audiences) == 0 {
+		audiences = []string{audienceSSO}
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", Auth(ks, revoked, audiences...), func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAccessTokenExpiry(t *testing.T) {
+	ks := testKeys(t)
+	ident := Identity{UserID: "u1", Email: "ana@example.com", Role: "pacijent", Roles: []string{"pacijent"}, EmailVerified: true}
+
+	fresh, err := Maker{Keys: ks, TTL: 15 * time.Minute}.Make(ident)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := authStatus(ks, revokedSet{}, fresh); code != http.StatusOK {
+		t.Errorf("fresh token: status %d, want 200", code)
+	}
+	expired, err := Maker{Keys: ks, TTL: -time.Minute}.Make(ident)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := authStatus(ks, revokedSet{}, expired); code != http.StatusUnauthorized {
+		t.Errorf("expired token: status %d, want 401", code)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(fresh, claims); err != nil {
+		t.Fatal(err)
+	}
+	if code := authStatus(ks, revokedSet{claims["jti"].(string): true}, fresh); code != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d, want 401", code)
+	}
+	if code := authStatus(testKeys(t), revokedSet{}, fresh); code != http.StatusUnauthorized {
+		t.Errorf("token of an unknown key: status %d, want 401", code)
+	}
+}
+
+// TestOIDCClientTokens checks that an OIDC client's access token reaches
+// only userinfo and holds no roles, and that its id_token is no bearer token.
+func TestOIDCClientTokens(t *testing.T) {
+	ks := testKeys(t)
+	m := Maker{Keys: ks, TTL: 15 * time.Minute}
+	ident := Identity{UserID: "u1", Email: "ana@example.com", Role: "admin", Roles: []string{"admin", "lekar"},
+		EmailVerified: true, SessionID: "s1", ClientID: "client-1", Scope: "openid email"}
+
+	access, err := m.Make(ident)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(access, claims); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"role", "roles", "email", "ial"} {
+		if _, ok := claims[name]; ok {
+			t.Errorf("client access token holds %s", name)
+		}
+	}
+	if claims["azp"] != "client-1" || claims["scope"] != "openid email" || claims["jti"] == nil || claims["sid"] != "s1" {
+		t.Errorf("client access token claims %v", claims)
+	}
+	if code := authStatus(ks, revokedSet{}, access); code != http.StatusUnauthorized {
+		t.Errorf("client token on the portal: status %d, want 401", code)
+	}
+	if code := authStatus(ks, revokedSet{}, access, audienceSSO, audienceUserInfo); code != http.StatusOK {
+		t.Errorf("client token on userinfo: status %d, want 200", code)
+	}
+
+	idToken, err := m.MakeIDToken(ident, "client-1", "n1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims = jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claims["roles"]; ok || claims["email"] != "ana@example.com" {
+		t.Errorf("id_token for scope email has claims %v", claims)
+	}
+	for _, audiences := range [][]string{{audienceSSO}, {audienceSSO, audienceUserInfo}, {"client-1"}} {
+		if code := authStatus(ks, revokedSet{}, idToken, audiences...); code != http.StatusUnauthorized {
+			t.Errorf("id_token on %v: status %d, want 401", audiences, code)
+		}
+	}
+
+	portal, err := m.Make(Identity{UserID: "u1", Email: "ana@example.com", Role: "pacijent", Roles: []string{"pacijent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := authStatus(ks, revokedSet{}, portal, audienceSSO, audienceUserInfo); code != http.StatusOK {
+		t.Errorf("portal token on userinfo: status %d, want 200", code)
+	}
+}
+
+func TestGrantedScope(t *testing.T) {
+	tests := map[string]string{
+		"openid":                            "openid",
+		"openid profile email":              "openid profile email",
+		"email openid offline_access roles": "email openid",
+		"openid openid  school:grades":      "openid",
+		"":                                  "",
+	}
+	for scope, want := range tests {
+		if got := grantedScope(scope); got != want {
+			t.Errorf("grantedScope(%q) = %q, want %q", scope, got, want)
+		}
+	}
+}
+
+func TestDelegatedTokenEndsWithDelegation(t *testing.T) {
+	ks := testKeys(t)
+	ends := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	ident := Identity{UserID: "u1", Email: "ana@example.com", Role: "pacijent", Roles: []string{"pacijent"}, EmailVerified: true,
+		Actor: &Actor{UserID: "u2", Email: "marko@example.com", DelegationID: "d1", Services: []string{"health"}, ExpiresAt: ends}}
+	tok, err := Maker{Keys: ks, TTL: 15 * time.Minute}.Make(ident)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tok, claims); err != nil {
+		t.Fatal(err)
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil || !exp.Equal(ends) {
+		t.Errorf("exp = %v, want the delegation's end %v", exp, ends)
+	}
+}
+
+func TestUnverifiedEmailGetsOnlyCitizenRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		ident     Identity
+		wantRole  string
+		wantRoles []string
+	}{
+		{"verified staff", Identity{Role: "lekar", Roles: []string{"lekar", "pacijent"}, EmailVerified: true},
+			"lekar", []string{"lekar", "pacijent"}},
+		{"unverified staff", Identity{Role: "lekar", Roles: []string{"lekar", "pacijent"}},
+			"pacijent", []string{"pacijent"}},
+		{"unverified staff only", Identity{Role: "admin", Roles: []string{"admin"}},
+			"", []string{}},
+		{"unverified citizen", Identity{Role: "roditelj", Roles: []string{"roditelj"}},
+			"roditelj", []string{"roditelj"}},
+		{"delegated staff", Identity{Role: "nastavnik", Roles: []string{"nastavnik", "roditelj"}, EmailVerified: true, Actor: &Actor{}},
+			"roditelj", []string{"roditelj"}},
+	}
+	for _, tt := range tests {
+		role, roles := tt.ident.tokenRoles()
+		if role != tt.wantRole || !slices.Equal(roles, tt.wantRoles) {
+			t.Errorf("%s: got %q %v, want %q %v", tt.name, role, roles, tt.wantRole, tt.wantRoles)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyHandler struct {
+	Keys *KeyStore
+}
+
+func (h KeyHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": h.Keys.JWKS()})
+}
+
+// Rotate schedules a new signing key. It becomes active after the publish
+// window, so tokens keep verifying everywhere during the switch.
+func (h KeyHandler) Rotate(c *gin.Context) {
+	if err := h.Keys.Rotate(c.Request.Context()); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": h.Keys.JWKS()})
+}
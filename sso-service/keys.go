@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no active signing key")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// signingKey is one entry of the key ring. A key is published in the JWKS as
+// soon as it is created, but only used for signing once ActivatesAt passes,
+// so verifiers have time to pick it up before the first token shows up.
+type signingKey struct {
+	Kid         string
+	Alg         string
+	Private     crypto.Signer
+	ActivatesAt time.Time
+}
+
+func (k *signingKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Alg)
+}
+
+// KeyStore keeps the signing keys in Postgres so all SSO replicas share the
+// same key ring and rotate it together.
+type KeyStore struct {
+	DB  *pgxpool.Pool
+	Alg string
+	// RotateEvery is the lifetime of a signing key before a successor is created.
+	RotateEvery time.Duration
+	// PublishAhead is how long a new key is published before it signs anything.
+	PublishAhead time.Duration
+	// Retain is how long a superseded key stays published; it must cover the
+	// lifetime of the longest token it could have signed.
+	Retain time.Duration
+
+	mu   sync.RWMutex
+	keys []*signingKey // sorted by ActivatesAt
+}
+
+// Start loads the key ring, creates the first key if needed and keeps the ring
+// fresh in the background until ctx is cancelled.
+func (ks *KeyStore) Start(ctx context.Context) error {
+	if err := ks.maintain(ctx); err != nil {
+		return err
+	}
+	go func() {
+		t := time.NewTicker(time.Minute)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := ks.maintain(ctx); err != nil {
+					log.Printf("[keys] maintenance failed: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (ks *KeyStore) maintain(ctx context.Context) error {
+	if err := ks.load(ctx); err != nil {
+		return err
+	}
+	if !ks.needsRotation(time.Now()) {
+		return nil
+	}
+	return ks.Rotate(ctx)
+}
+
+func (ks *KeyStore) needsRotation(now time.Time) bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return true
+	}
+	newest := ks.keys[len(ks.keys)-1]
+	if newest.ActivatesAt.After(now) {
+		// a successor is already waiting
+		return false
+	}
+	return now.Sub(newest.ActivatesAt) >= ks.RotateEvery-ks.PublishAhead
+}
+
+// Rotate creates the next signing key. The first key of an empty ring is
+// active immediately, every later one after PublishAhead.
+func (ks *KeyStore) Rotate(ctx context.Context) error {
+	tx, err := ks.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// serialize rotation across replicas
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('sso_signing_keys'))`); err != nil {
+		return err
+	}
+	var count int
+	var pending bool
+	if err = tx.QueryRow(ctx, `SELECT count(*), coalesce(bool_or(activates_at > now()), false) FROM signing_keys`).
+		Scan(&count, &pending); err != nil {
+		return err
+	}
+	if pending {
+		return tx.Commit(ctx)
+	}
+	activatesAt := time.Now().Add(ks.PublishAhead)
+	if count == 0 {
+		activatesAt = time.Now()
+	}
+
+	kid, priv, err := generateKey(ks.Alg)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	q := `INSERT INTO signing_keys (kid, alg, private_pem, activates_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, q, kid, ks.Alg, string(privPEM), activatesAt); err != nil {
+		return err
+	}
+	// drop keys whose successor has been active for longer than Retain
+	if _, err = tx.Exec(ctx, `
+		DELETE FROM signing_keys k
+		WHERE EXISTS (
+			SELECT 1 FROM signing_keys n
+			WHERE n.activates_at > k.activates_at AND n.activates_at < $1
+		)`, time.Now().Add(-ks.Retain)); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	log.Printf("[keys] created signing key %s (%s), active from %s", kid, ks.Alg, activatesAt.Format(time.RFC3339))
+	return ks.load(ctx)
+}
+
+func (ks *KeyStore) load(ctx context.Context) error {
+	rows, err := ks.DB.Query(ctx, `SELECT kid, alg, private_pem, activates_at FROM signing_keys ORDER BY activates_at`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var keys []*signingKey
+	for rows.Next() {
+		var k signingKey
+		var privPEM string
+		if err = rows.Scan(&k.Kid, &k.Alg, &privPEM, &k.ActivatesAt); err != nil {
+			return err
+		}
+		if k.Private, err = parsePrivateKey(privPEM); err != nil {
+			return fmt.Errorf("key %s: %w", k.Kid, err)
+		}
+		keys = append(keys, &k)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ActivatesAt.Before(keys[j].ActivatesAt) })
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// Signing returns the newest key that is already active.
+func (ks *KeyStore) Signing() (*signingKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	now := time.Now()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if !ks.keys[i].ActivatesAt.After(now) {
+			return ks.keys[i], nil
+		}
+	}
+	return nil, ErrNoSigningKey
+}
+
+// Keyfunc resolves the verification key of a token by its kid header.
+func (ks *KeyStore) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.Kid == kid {
+			if t.Method.Alg() != k.Alg {
+				return nil, errors.New("unexpected signing method")
+			}
+			return k.Private.Public(), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517, RFC 8037).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS returns every published public key, including pending and
+// superseded ones.
+func (ks *KeyStore) JWKS() []JWK {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	out := make([]JWK, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.Kid, Alg: k.Alg, Use: "sig"}
+		switch pub := k.Private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		out = append(out, jwk)
+	}
+	return out
+}
+
+func generateKey(alg string) (kid string, priv crypto.Signer, err error) {
+	switch alg {
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return "", nil, fmt.Errorf("unsupported JWT_ALG %q", alg)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	return time.Now().UTC().Format("20060102") + "-" + hex.EncodeToString(b), priv, nil
+}
+
+func parsePrivateKey(privPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privPEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
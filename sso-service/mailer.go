@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email. SMTPMailer is used in production,
+// LogMailer for local development and tests.
+type Mailer interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPMailer) Send(ctx context.Context, m Mail) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, s.From, []string{m.To}, formatMail(s.From, m))
+}
+
+// LogMailer writes each message to Dir as an .eml file, or only logs it when
+// Dir is empty.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (l LogMailer) Send(ctx context.Context, m Mail) error {
+	if l.Dir == "" {
+		log.Printf("[mail] to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+		return nil
+	}
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFileName(m.To))
+	path := filepath.Join(l.Dir, name)
+	if err := os.WriteFile(path, formatMail(l.From, m), 0o644); err != nil {
+		return err
+	}
+	log.Printf("[mail] to=%s subject=%q written to %s", m.To, m.Subject, path)
+	return nil
+}
+
+func formatMail(from string, m Mail) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+func NewMailer(cfg *Config) Mailer {
+	if cfg.MailDriver == "smtp" {
+		return SMTPMailer{Addr: cfg.SMTPAddr, Username: cfg.SMTPUser, Password: cfg.SMTPPassword, From: cfg.MailFrom}
+	}
+	return LogMailer{Dir: cfg.MailDir, From: cfg.MailFrom}
+}
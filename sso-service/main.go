@@ -1,24 +1,109 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 func main() {
+	initLogging("sso-service")
+	shutdown, err := initTracing(context.Background(), "sso-service")
+	if err != nil {
+		log.Fatalf("tracing: %v", err)
+	}
 	cfg := Load()
+
 	pool := NewPool(cfg.Database)
+	sqlDB := stdlib.OpenDBFromPool(pool)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(sqlDB, os.Args[2:])
+	}
+	if cfg.MigrateOnStart {
+		migrateSSO(sqlDB)
+	}
+	registerMetrics(pool)
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		log.Fatalf("migrations: %v", err)
+	}
+
+	keys := &KeyStore{
+		DB:           pool,
+		Alg:          cfg.JWTAlg,
+		RotateEvery:  cfg.KeyRotateEvery,
+		PublishAhead: 5 * time.Minute,
+		Retain:       cfg.JWTTTL + 5*time.Minute,
+	}
+	if err := keys.Start(context.Background()); err != nil {
+		log.Fatalf("signing keys: %v", err)
+	}
 
-	jwtMaker := Maker{Secret: cfg.JWTSecret, TTL: cfg.JWTTTL}
-	authSvc := AuthService{DB: pool, JWTMaker: jwtMaker}
+	jwtMaker := Maker{Keys: keys, TTL: cfg.JWTTTL, Issuer: cfg.Issuer}
+	authSvc := AuthService{
+		DB:         pool,
+		JWTMaker:   jwtMaker,
+		AccessTTL:  cfg.JWTTTL,
+		RefreshTTL: cfg.RefreshTTL,
+		Mailer:     NewMailer(cfg),
+		AppURL:     cfg.AppURL,
+		Throttle: LoginThrottle{
+			DB:            pool,
+			MaxFailures:   cfg.LoginMaxFailures,
+			IPMaxFailures: cfg.LoginIPMaxFailures,
+			BaseDelay:     time.Second,
+			Lockout:       cfg.LoginLockout,
+		},
+	}
 	authH := AuthHandler{Svc: authSvc}
 
+	if cfg.BootstrapAdmin != "" {
+		ok, err := authSvc.EnsureRoleByEmail(context.Background(), cfg.BootstrapAdmin, "admin")
+		if err != nil {
+			log.Fatalf("bootstrap admin: %v", err)
+		}
+		if ok {
+			log.Printf("bootstrap admin role ensured for %s", cfg.BootstrapAdmin)
+		} else {
+			log.Printf("bootstrap admin %s not promoted: no account with that verified email yet, restart once it exists", cfg.BootstrapAdmin)
+		}
+	}
+
+	oidcSvc := OIDCService{DB: pool, Auth: authSvc, JWT: jwtMaker}
+	for _, sc := range cfg.ServiceClients {
+		if err := oidcSvc.EnsureServiceClient(context.Background(), sc); err != nil {
+			log.Fatalf("service client %s: %v", sc.ClientID, err)
+		}
+		log.Printf("service client %s ensured (scopes: %v)", sc.ClientID, sc.Scopes)
+	}
+
 	r := New(Deps{
 		AuthHandler: authH,
-		JWTSecret:   cfg.JWTSecret,
+		KeyHandler:  KeyHandler{Keys: keys},
+		OIDCHandler: OIDCHandler{
+			Svc:       oidcSvc,
+			Issuer:    cfg.Issuer,
+			PublicURL: cfg.PublicURL,
+			Alg:       cfg.JWTAlg,
+		},
+		RoleHandler:         RoleHandler{Svc: authSvc},
+		MFAHandler:          MFAHandler{Svc: authSvc, Issuer: cfg.MFAIssuer},
+		UserHandler:         UserHandler{Svc: authSvc},
+		GuardianshipHandler: GuardianshipHandler{Svc: authSvc},
+		DelegationHandler:   DelegationHandler{Svc: authSvc},
+		Keys:                keys,
+		Revocations:         authSvc,
+
+		TrustedProxies: cfg.TrustedProxies,
+		ReadyChecks:    []Check{{Name: "database", Run: pool.Ping}, migrator.ReadyCheck()},
 	})
 
 	log.Printf("SSO listening on :%s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
-		log.Fatal(err)
-	}
+	serve(r, cfg.Port, cfg.ShutdownTimeout, shutdown, func(context.Context) error {
+		pool.Close()
+		return nil
+	})
 }
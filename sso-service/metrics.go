@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// measureRequests counts requests under their route pattern rather than the
+// raw path, so IDs in URLs do not create a series each.
+func measureRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		httpDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+var loginAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sso_login_attempts_total",
+	Help: "Login attempts by result and login_audit reason.",
+}, []string{"result", "reason"})
+
+func countLogin(success bool, reason string) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	loginAttempts.WithLabelValues(result, reason).Inc()
+}
+
+// registerMetrics exposes the connection pool and the guardianships waiting
+// for verification at a counter.
+func registerMetrics(pool *pgxpool.Pool) {
+	prometheus.MustRegister(poolCollector{pool})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "sso_pending_guardianships",
+		Help: "Guardianship requests waiting for verification.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var n int64
+		q := `SELECT count(*) FROM guardianships WHERE verified_at IS NULL AND revoked_at IS NULL`
+		if err := pool.QueryRow(ctx, q).Scan(&n); err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc("sso_db_pool_acquired_conns", "Connections in use.", nil, nil)
+	poolIdleDesc     = prometheus.NewDesc("sso_db_pool_idle_conns", "Idle connections.", nil, nil)
+	poolTotalDesc    = prometheus.NewDesc("sso_db_pool_total_conns", "Open connections.", nil, nil)
+	poolMaxDesc      = prometheus.NewDesc("sso_db_pool_max_conns", "Maximum pool size.", nil, nil)
+	poolAcquireDesc  = prometheus.NewDesc("sso_db_pool_acquire_total", "Connections acquired from the pool.", nil, nil)
+	poolWaitDesc     = prometheus.NewDesc("sso_db_pool_empty_acquire_total", "Acquires that had to wait for a connection.", nil, nil)
+	poolWaitSecDesc  = prometheus.NewDesc("sso_db_pool_acquire_seconds_total", "Time spent acquiring connections.", nil, nil)
+)
+
+// poolCollector reports pgxpool statistics at scrape time.
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (p poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{poolAcquiredDesc, poolIdleDesc, poolTotalDesc, poolMaxDesc, poolAcquireDesc, poolWaitDesc, poolWaitSecDesc} {
+		ch <- d
+	}
+}
+
+func (p poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := p.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDesc, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitDesc, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolWaitSecDesc, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator app
+// understands, so they are not configurable.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // accepted steps before and after the current one
+
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaMaxAttempts    = 5
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5 // 8 base32 characters, shown as xxxx-xxxx
+	totpSecretBytes   = 20
+	defaultTOTPIssuer = "eUprava"
+)
+
+var (
+	ErrMFAInvalidCode   = errors.New("invalid code")
+	ErrMFAChallenge     = errors.New("invalid or expired mfa token")
+	ErrMFANotEnrolled   = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyActive = errors.New("two-factor authentication is already enabled")
+	ErrMFARequired      = errors.New("two-factor authentication is required for this account")
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAChallenge is handed out instead of tokens when the password was correct
+// but a second factor is still needed. Enroll is set when the user's role
+// requires MFA and the account has not set it up yet.
+type MFAChallenge struct {
+	Token     string
+	ExpiresIn int
+	Enroll    bool
+}
+
+// MFAEnrollment is a freshly generated, not yet confirmed TOTP secret.
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type MFAStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// totpMatch returns the time step the code belongs to, or -1.
+func totpMatch(secret []byte, code string, now time.Time) int64 {
+	step := now.Unix() / totpPeriod
+	for d := int64(-totpSkew); d <= totpSkew; d++ {
+		if hmac.Equal([]byte(totpCode(secret, step+d)), []byte(code)) {
+			return step + d
+		}
+	}
+	return -1
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func otpauthURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	q := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// normalizeRecoveryCode accepts codes with or without the dash and in any case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func newRecoveryCodes() (plain, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := b32.EncodeToString(b)
+		plain = append(plain, strings.ToLower(c[:4]+"-"+c[4:]))
+		hashes = append(hashes, hashToken(c))
+	}
+	return plain, hashes, nil
+}
+
+// mfaState reports whether the user has confirmed TOTP and whether any of
+// their roles requires it.
+func (s AuthService) mfaState(ctx context.Context, userID string) (enabled, required bool, err error) {
+	q := `SELECT EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NOT NULL),
+	             EXISTS (SELECT 1 FROM user_roles ur JOIN mfa_required_roles m ON m.role = ur.role WHERE ur.user_id = $1)`
+	err = s.DB.QueryRow(ctx, q, userID).Scan(&enabled, &required)
+	return enabled, required, err
+}
+
+// beginMFA opens a challenge for a user who passed the password check, or
+// returns nil if the account does not need a second factor.
+func (s AuthService) beginMFA(ctx context.Context, ident Identity) (*MFAChallenge, error) {
+	enabled, required, err := s.mfaState(ctx, ident.UserID)
+	if err != nil || (!enabled && !required) {
+		return nil, err
+	}
+	tok, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	q := `INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err = s.DB.Exec(ctx, q, hashToken(tok), ident.UserID, time.Now().Add(mfaChallengeTTL)); err != nil {
+		return nil, err
+	}
+	_, _ = s.DB.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < now()`)
+	return &MFAChallenge{Token: tok, ExpiresIn: int(mfaChallengeTTL.Seconds()), Enroll: !enabled}, nil
+}
+
+// challengeUser resolves a pending challenge and counts the attempt against it.
+func (s AuthService) challengeUser(ctx context.Context, token string) (string, error) {
+	var userID string
+	q := `UPDATE mfa_challenges SET attempts = attempts + 1
+	      WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now() AND attempts < $2
+	      RETURNING user_id`
+	if err := s.DB.QueryRow(ctx, q, hashToken(token), mfaMaxAttempts).Scan(&userID); err != nil {
+		return "", ErrMFAChallenge
+	}
+	return userID, nil
+}
+
+// consumeChallenge marks the challenge used so it cannot complete a second login.
+func (s AuthService) consumeChallenge(ctx context.Context, token string) error {
+	tag, err := s.DB.Exec(ctx, `UPDATE mfa_challenges SET used_at = now() WHERE token_hash = $1 AND used_at IS NULL`, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAChallenge
+	}
+	return nil
+}
+
+// PassMFA checks a TOTP or recovery code against a pending challenge and
+// consumes it, returning the user it was issued for. Wrong codes count
+// towards the account throttle like wrong passwords, otherwise fresh
+// challenges would allow unlimited guessing.
+func (s AuthService) PassMFA(ctx context.Context, token, code string, src LoginSource) (string, error) {
+	userID, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	var email string
+	if err = s.DB.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		return "", err
+	}
+	if err = s.checkMFACode(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrMFAInvalidCode) {
+			s.audit(ctx, email, userID, src, false, auditBadMFACode)
+			if ferr := s.Throttle.Fail(ctx, accountKey(email)); ferr != nil {
+				return "", ferr
+			}
+		}
+		return "", err
+	}
+	if err = s.consumeChallenge(ctx, token); err != nil {
+		return "", err
+	}
+	s.loginSucceeded(ctx, email, userID, src)
+	return userID, nil
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code.
+func (s AuthService) VerifyMFA(ctx context.Context, token, code string, src LoginSource) (TokenPair, error) {
+	userID, err := s.PassMFA(ctx, token, code, src)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	ident, err := s.Identity(ctx, userID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return s.startSession(ctx, ident)
+}
+
+// EnrollPendingMFA starts enrollment for a user whose role requires MFA but
+// who has not set it up, authenticated only by the pending challenge.
+func (s AuthService) EnrollPendingMFA(ctx context.Context, token, issuer string) (MFAEnrollment, error) {
+	userID, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	return s.EnrollMFA(ctx, userID, issuer)
+}
+
+// ConfirmPendingMFA activates the secret from EnrollPendingMFA and completes
+// the login in the same step.
+func (s AuthService) ConfirmPendingMFA(ctx context.Context, token, code string, src LoginSource) (TokenPair, []string, error) {
+	userID, err := s.challengeUser(ctx, token)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+	codes, err := s.ConfirmMFA(ctx, userID, code)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+	if err = s.consumeChallenge(ctx, token); err != nil {
+		return TokenPair{}, nil, err
+	}
+	ident, err := s.Identity(ctx, userID)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+	s.loginSucceeded(ctx, ident.Email, userID, src)
+	pair, err := s.startSession(ctx, ident)
+	return pair, codes, err
+}
+
+// checkMFACode accepts either the current TOTP code or an unused recovery
+// code. A TOTP code is accepted only once, even within its validity window.
+func (s AuthService) checkMFACode(ctx context.Context, userID, code string) error {
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		q := `UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+		tag, err := s.DB.Exec(ctx, q, userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMFAInvalidCode
+		}
+		return nil
+	}
+
+	var secret string
+	q := `SELECT secret FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NOT NULL`
+	if err := s.DB.QueryRow(ctx, q, userID).Scan(&secret); err != nil {
+		return ErrMFANotEnrolled
+	}
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		return err
+	}
+	step := totpMatch(key, code, time.Now())
+	if step < 0 {
+		return ErrMFAInvalidCode
+	}
+	tag, err := s.DB.Exec(ctx, `UPDATE user_mfa SET last_step = $2 WHERE user_id = $1 AND last_step < $2`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAInvalidCode
+	}
+	return nil
+}
+
+// EnrollMFA generates a new TOTP secret for the user. It stays inactive until
+// ConfirmMFA sees a valid code from it; an unconfirmed secret is replaced.
+func (s AuthService) EnrollMFA(ctx context.Context, userID, issuer string) (MFAEnrollment, error) {
+	var email string
+	var confirmed bool
+	q := `SELECT u.email, EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.confirmed_at IS NOT NULL)
+	      FROM users u WHERE u.id = $1`
+	if err := s.DB.QueryRow(ctx, q, userID).Scan(&email, &confirmed); err != nil {
+		return MFAEnrollment{}, ErrUserNotFound
+	}
+	if confirmed {
+		return MFAEnrollment{}, ErrMFAAlreadyActive
+	}
+	raw := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return MFAEnrollment{}, err
+	}
+	secret := b32.EncodeToString(raw)
+	q = `INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+	     ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = now(), last_step = 0`
+	if _, err := s.DB.Exec(ctx, q, userID, secret); err != nil {
+		return MFAEnrollment{}, err
+	}
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+	return MFAEnrollment{Secret: secret, OTPAuthURI: otpauthURI(issuer, email, secret)}, nil
+}
+
+// ConfirmMFA activates the pending secret and returns fresh recovery codes.
+func (s AuthService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var secret string
+	q := `SELECT secret FROM user_mfa WHERE user_id = $1 AND confirmed_at IS NULL FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, userID).Scan(&secret); err != nil {
+		return nil, ErrMFANotEnrolled
+	}
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		return nil, err
+	}
+	step := totpMatch(key, strings.TrimSpace(code), time.Now())
+	if step < 0 {
+		return nil, ErrMFAInvalidCode
+	}
+	if _, err = tx.Exec(ctx, `UPDATE user_mfa SET confirmed_at = now(), last_step = $2 WHERE user_id = $1`, userID, step); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit(ctx)
+}
+
+// RegenerateRecoveryCodes invalidates all previous recovery codes.
+func (s AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.checkMFACode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string) ([]string, error) {
+	plain, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	q := `INSERT INTO mfa_recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`
+	if _, err = tx.Exec(ctx, q, userID, hashes); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
+
+// DisableMFA turns TOTP off for a user who proves possession of it. Users
+// whose role requires MFA cannot opt out.
+func (s AuthService) DisableMFA(ctx context.Context, userID, code string) error {
+	_, required, err := s.mfaState(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequired
+	}
+	if err = s.checkMFACode(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.ResetMFA(ctx, userID)
+}
+
+// ResetMFA removes the second factor without any check; used by admins for
+// users who lost both their device and recovery codes.
+func (s AuthService) ResetMFA(ctx context.Context, userID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id::text = $1`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id::text = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s AuthService) MFAStatus(ctx context.Context, userID string) (MFAStatus, error) {
+	var st MFAStatus
+	var err error
+	if st.Enabled, st.Required, err = s.mfaState(ctx, userID); err != nil {
+		return st, err
+	}
+	q := `SELECT count(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	err = s.DB.QueryRow(ctx, q, userID).Scan(&st.RecoveryCodesLeft)
+	return st, err
+}
+
+func (s AuthService) MFARequiredRoles(ctx context.Context) ([]string, error) {
+	var roles []string
+	err := s.DB.QueryRow(ctx, `SELECT ARRAY(SELECT role FROM mfa_required_roles ORDER BY role)`).Scan(&roles)
+	return roles, err
+}
+
+// SetMFARequiredRoles replaces the set of roles that must use MFA. Users of
+// those roles without TOTP are taken through enrollment on their next login.
+func (s AuthService) SetMFARequiredRoles(ctx context.Context, roles []string, setBy string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, `DELETE FROM mfa_required_roles WHERE role <> ALL($1::text[])`, roles); err != nil {
+		return err
+	}
+	q := `INSERT INTO mfa_required_roles (role, set_by) SELECT unnest($1::text[]), NULLIF($2, '')::uuid
+	      ON CONFLICT (role) DO NOTHING`
+	if _, err = tx.Exec(ctx, q, roles, setBy); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type MFAHandler struct {
+	Svc    AuthService
+	Issuer string // shown as the account issuer in authenticator apps
+}
+
+// MFAPendingResp replaces TokenResp on /login when a second factor is needed.
+type MFAPendingResp struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Enroll      bool   `json:"enroll"`
+}
+
+type MFALoginReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"`
+}
+
+type MFACodeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFARolesReq struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+func claimsSub(c *gin.Context) string {
+	sub, _ := c.MustGet("claims").(jwt.MapClaims)["sub"].(string)
+	return sub
+}
+
+// Verify is the second login step: it trades the mfa_token and a TOTP or
+// recovery code for the real token pair.
+func (h MFAHandler) Verify(c *gin.Context) {
+	var req MFALoginReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	pair, err := h.Svc.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code, loginSource(c))
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokenResp(pair))
+}
+
+func (h MFAHandler) EnrollPending(c *gin.Context) {
+	var req MFALoginReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	enr, err := h.Svc.EnrollPendingMFA(c.Request.Context(), req.MFAToken, h.Issuer)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enr)
+}
+
+// ConfirmPending activates the new secret and completes the login. The
+// recovery codes are shown only in this response.
+func (h MFAHandler) ConfirmPending(c *gin.Context) {
+	var req MFALoginReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	pair, codes, err := h.Svc.ConfirmPendingMFA(c.Request.Context(), req.MFAToken, req.Code, loginSource(c))
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":          pair.AccessToken,
+		"refresh_token":  pair.RefreshToken,
+		"expires_in":     pair.ExpiresIn,
+		"recovery_codes": codes,
+	})
+}
+
+func (h MFAHandler) Status(c *gin.Context) {
+	st, err := h.Svc.MFAStatus(c.Request.Context(), claimsSub(c))
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+func (h MFAHandler) Enroll(c *gin.Context) {
+	enr, err := h.Svc.EnrollMFA(c.Request.Context(), claimsSub(c), h.Issuer)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, enr)
+}
+
+func (h MFAHandler) Confirm(c *gin.Context) {
+	var req MFACodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	codes, err := h.Svc.ConfirmMFA(c.Request.Context(), claimsSub(c), req.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h MFAHandler) RecoveryCodes(c *gin.Context) {
+	var req MFACodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	codes, err := h.Svc.RegenerateRecoveryCodes(c.Request.Context(), claimsSub(c), req.Code)
+	if err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h MFAHandler) Disable(c *gin.Context) {
+	var req MFACodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if err := h.Svc.DisableMFA(c.Request.Context(), claimsSub(c), req.Code); err != nil {
+		mfaError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h MFAHandler) RequiredRoles(c *gin.Context) {
+	roles, err := h.Svc.MFARequiredRoles(c.Request.Context())
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+func (h MFAHandler) SetRequiredRoles(c *gin.Context) {
+	var req MFARolesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	for _, r := range req.Roles {
+		if !validRoles[r] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role: " + r})
+			return
+		}
+	}
+	if err := h.Svc.SetMFARequiredRoles(c.Request.Context(), req.Roles, claimsSub(c)); err != nil {
+		serverError(c, err)
+		return
+	}
+	h.RequiredRoles(c)
+}
+
+// Reset removes a user's second factor, for accounts that lost both the
+// device and the recovery codes.
+func (h MFAHandler) Reset(c *gin.Context) {
+	if err := h.Svc.ResetMFA(c.Request.Context(), c.Param("id")); err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func mfaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrMFAChallenge), errors.Is(err, ErrMFAInvalidCode):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrMFAAlreadyActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrMFARequired), errors.Is(err, ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	default:
+		serverError(c, err)
+	}
+}
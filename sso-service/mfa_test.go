@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digits; a 6-digit code is the last six of them
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Secret, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPMatchAcceptsOneStepOfSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	for d := int64(-3); d <= 3; d++ {
+		code := totpCode(rfc6238Secret, step+d)
+		want := int64(-1)
+		if d >= -totpSkew && d <= totpSkew {
+			want = step + d
+		}
+		if got := totpMatch(rfc6238Secret, code, now); got != want {
+			t.Errorf("code of step %+d: totpMatch = %d, want %d", d, got, want)
+		}
+	}
+	if got := totpMatch([]byte("another secret"), totpCode(rfc6238Secret, step), now); got != -1 {
+		t.Errorf("code of another secret matched step %d", got)
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	for code, want := range map[string]bool{
+		"123456": true, "000000": true,
+		"12345": false, "1234567": false, "12a456": false, "abcd-efgh": false, "": false,
+	} {
+		if got := isTOTPCode(code); got != want {
+			t.Errorf("isTOTPCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	plain, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(plain), len(hashes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range plain {
+		if len(code) != 9 || code[4] != '-' {
+			t.Errorf("code %q is not xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q handed out twice", code)
+		}
+		seen[code] = true
+		// typed back however the user likes, it must hash to what is stored
+		for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", " ")} {
+			if hashToken(normalizeRecoveryCode(typed)) != hashes[i] {
+				t.Errorf("%q does not match the stored hash of %q", typed, code)
+			}
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"net/http"
 	"strings"
 
@@ -9,7 +9,15 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Auth(jwtSecret []byte) gin.HandlerFunc {
+// RevocationChecker tells whether an otherwise valid token was revoked.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, jti, sessionID string) (bool, error)
+}
+
+// Auth accepts access tokens issued for one of the given audiences. Every
+// access token has a jti, so that it can be revoked; id_tokens and tokens
+// meant for other services are refused.
+func Auth(keys *KeyStore, revoked RevocationChecker, audiences ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authz := c.GetHeader("Authorization")
 		if !strings.HasPrefix(authz, "Bearer ") {
@@ -17,13 +25,9 @@ func Auth(jwtSecret []byte) gin.HandlerFunc {
 			return
 		}
 		tokenStr := strings.TrimPrefix(authz, "Bearer ")
-		tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
-		if err != nil || !tok.Valid {
+		tok, err := jwt.Parse(tokenStr, keys.Keyfunc, jwt.WithValidMethods([]string{"EdDSA", "RS256"}),
+			jwt.WithAudience(audiences...))
+		if err != nil || !tok.Valid || tok.Header["typ"] != accessTokenType {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
@@ -32,7 +36,61 @@ func Auth(jwtSecret []byte) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
 			return
 		}
+		// service tokens are for the school and health services, not for the SSO itself
+		if _, ok := claims["client_id"]; ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "service tokens are not accepted here"})
+			return
+		}
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+		sid, _ := claims["sid"].(string)
+		isRevoked, err := revoked.IsRevoked(c.Request.Context(), jti, sid)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "revocation check failed"})
+			return
+		}
+		if isRevoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
 		c.Set("claims", claims)
+		if sub, ok := claims["sub"].(string); ok {
+			c.Set("userID", sub)
+		}
 		c.Next()
 	}
 }
+
+// RequireRole lets the request through only if the authenticated user holds
+// one of the given roles. It must run after Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		mc, _ := claims.(jwt.MapClaims)
+		for _, r := range roles {
+			if hasRole(mc, r) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
+// hasRole checks the roles array claim, falling back to the single role claim
+// of tokens issued before users could hold several roles.
+func hasRole(claims jwt.MapClaims, role string) bool {
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range list {
+			if r == role {
+				return true
+			}
+		}
+		return false
+	}
+	primary, _ := claims["role"].(string)
+	return primary == role
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+	kid TEXT PRIMARY KEY,
+	alg TEXT NOT NULL,
+	private_pem TEXT NOT NULL,
+	activates_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
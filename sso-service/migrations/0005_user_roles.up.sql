@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	granted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (user_id, role)
+);
+
+-- korisnici iz vremena jedne uloge dobijaju svoju ulogu i u user_roles
+INSERT INTO user_roles (user_id, role, granted_at)
+SELECT id, role, created_at FROM users
+ON CONFLICT (user_id, role) DO NOTHING;
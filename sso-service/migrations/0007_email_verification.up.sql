@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_tokens (
+	token_hash TEXT PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id, purpose);
+
+-- postojeći nalozi se smatraju potvrđenim; kolona se dodaje samo jednom
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+	               WHERE table_name = 'users' AND column_name = 'email_verified_at') THEN
+		ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+		UPDATE users SET email_verified_at = created_at;
+	END IF;
+END $$;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS login_throttle (
+	key TEXT PRIMARY KEY,
+	failures INT NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	blocked_until TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS login_audit (
+	id BIGSERIAL PRIMARY KEY,
+	email TEXT NOT NULL,
+	user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	ip TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	success BOOLEAN NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_login_audit_email ON login_audit(email, id);
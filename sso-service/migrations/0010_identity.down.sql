@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN IF EXISTS identity_verified_by;
+ALTER TABLE users DROP COLUMN IF EXISTS identity_verified_at;
+ALTER TABLE users DROP COLUMN IF EXISTS ial;
+ALTER TABLE users DROP COLUMN IF EXISTS birth_date;
+ALTER TABLE users DROP COLUMN IF EXISTS jmbg;
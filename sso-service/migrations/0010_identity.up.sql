@@ -0,0 +1,6 @@
+-- JMBG i nivo pouzdanosti identiteta (1 = samoregistrovan, 2 = proveren na šalteru)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS jmbg CHAR(13) UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS birth_date DATE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ial SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS identity_verified_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS identity_verified_by UUID REFERENCES users(id) ON DELETE SET NULL;
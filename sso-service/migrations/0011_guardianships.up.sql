@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS guardianships (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	guardian_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	child_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	relation TEXT NOT NULL DEFAULT 'roditelj',
+	requested_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	verified_at TIMESTAMPTZ,
+	verified_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	revoked_at TIMESTAMPTZ,
+	CHECK (guardian_id <> child_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_guardianships_open ON guardianships(guardian_id, child_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_guardianships_child ON guardianships(child_id);
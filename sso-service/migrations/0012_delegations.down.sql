@@ -0,0 +1,2 @@
+ALTER TABLE login_audit DROP COLUMN IF EXISTS actor_id;
+DROP TABLE IF EXISTS delegations;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS delegations (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	principal_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	delegate_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	services TEXT[] NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMPTZ,
+	CHECK (principal_id <> delegate_id)
+);
+CREATE INDEX IF NOT EXISTS idx_delegations_principal ON delegations(principal_id);
+CREATE INDEX IF NOT EXISTS idx_delegations_delegate ON delegations(delegate_id);
+
+ALTER TABLE login_audit ADD COLUMN IF NOT EXISTS actor_id UUID REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+-- OIDC klijent kome je sesija izdata; NULL za portal
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS client_id TEXT REFERENCES oauth_clients(client_id) ON DELETE CASCADE;
@@ -0,0 +1 @@
+DELETE FROM mfa_required_roles WHERE role IN ('lekar', 'administrator', 'nastavnik') AND set_by IS NULL;
@@ -0,0 +1,3 @@
+-- dvofaktorska prijava je obavezna za lekare, administratore i nastavnike
+INSERT INTO mfa_required_roles (role) VALUES ('lekar'), ('administrator'), ('nastavnik')
+ON CONFLICT (role) DO NOTHING;
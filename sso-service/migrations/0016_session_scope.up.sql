@@ -0,0 +1,2 @@
+-- opseg (scope) koji je korisnik odobrio OIDC klijentu; prazan za portal
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_jmbg;
+DROP INDEX IF EXISTS idx_users_jmbg_verified;
+ALTER TABLE users ADD CONSTRAINT users_jmbg_key UNIQUE (jmbg);
@@ -0,0 +1,5 @@
+-- JMBG je jedinstven samo među proverenim identitetima; samoregistrovani
+-- korisnik ne sme da zauzme tuđi broj i tako zaključa pravog vlasnika
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_jmbg_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_jmbg_verified ON users(jmbg) WHERE ial >= 2;
+CREATE INDEX IF NOT EXISTS idx_users_jmbg ON users(jmbg);
@@ -0,0 +1 @@
+DELETE FROM mfa_required_roles WHERE role = 'admin' AND set_by IS NULL;
@@ -0,0 +1,3 @@
+-- i uloga admin je administratorska, pa i za nju važi obavezna dvofaktorska prijava
+INSERT INTO mfa_required_roles (role) VALUES ('admin')
+ON CONFLICT (role) DO NOTHING;
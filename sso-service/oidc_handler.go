@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type OIDCHandler struct {
+	Svc       OIDCService
+	Issuer    string
+	PublicURL string
+	Alg       string
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="sr">
+<head>
+<meta charset="utf-8">
+<title>eUprava — prijava</title>
+<style>
+body { font-family: sans-serif; background: #f4f6f9; display: flex; justify-content: center; padding-top: 80px; }
+form { background: #fff; padding: 32px; border-radius: 8px; width: 320px; box-shadow: 0 2px 8px rgba(0,0,0,.1); }
+input { width: 100%; padding: 8px; margin: 6px 0 14px; box-sizing: border-box; }
+button { width: 100%; padding: 10px; background: #0c4076; color: #fff; border: 0; border-radius: 4px; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<form method="post" action="authorize">
+<h2>eUprava</h2>
+<p>Aplikacija <b>{{.ClientName}}</b> traži prijavu.</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .MFAToken}}<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>Kod iz aplikacije za autentifikaciju ili rezervni kod</label>
+<input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required autofocus>
+{{else}}<label>Email adresa</label>
+<input type="email" name="email" required autofocus>
+<label>Lozinka</label>
+<input type="password" name="password" required>
+{{end}}{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}<button type="submit">Prijavi se</button>
+</form>
+</body>
+</html>`))
+
+func (h OIDCHandler) Discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                h.Issuer,
+		"authorization_endpoint":                h.PublicURL + "/authorize",
+		"token_endpoint":                        h.PublicURL + "/oauth/token",
+		"userinfo_endpoint":                     h.PublicURL + "/userinfo",
+		"jwks_uri":                              h.PublicURL + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{h.Alg},
+		"scopes_supported":                      oidcScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "first_name", "last_name", "given_name", "family_name", "role", "roles", "ial"},
+	})
+}
+
+// authRequest validates the parameters shared by GET and POST /authorize.
+// Until client_id and redirect_uri are known to be valid, errors are shown to
+// the user instead of being redirected, as required by RFC 6749 4.1.2.1.
+func (h OIDCHandler) authRequest(c *gin.Context, get func(string) string) (AuthRequest, OAuthClient, bool) {
+	req := AuthRequest{
+		ClientID:            get("client_id"),
+		RedirectURI:         get("redirect_uri"),
+		Scope:               get("scope"),
+		State:               get("state"),
+		Nonce:               get("nonce"),
+		CodeChallenge:       get("code_challenge"),
+		CodeChallengeMethod: get("code_challenge_method"),
+	}
+	client, err := h.Svc.Client(c.Request.Context(), req.ClientID)
+	if err != nil {
+		c.String(http.StatusBadRequest, "unknown client_id")
+		return req, client, false
+	}
+	if !client.AllowsRedirect(req.RedirectURI) {
+		c.String(http.StatusBadRequest, "redirect_uri is not registered for this client")
+		return req, client, false
+	}
+	if get("response_type") != "code" {
+		redirectError(c, req, "unsupported_response_type")
+		return req, client, false
+	}
+	if !strings.Contains(" "+req.Scope+" ", " openid ") {
+		redirectError(c, req, "invalid_scope")
+		return req, client, false
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		redirectError(c, req, "invalid_request")
+		return req, client, false
+	}
+	return req, client, true
+}
+
+func (h OIDCHandler) Authorize(c *gin.Context) {
+	req, client, ok := h.authRequest(c, c.Query)
+	if !ok {
+		return
+	}
+	renderLogin(c, req, client, "", "")
+}
+
+func (h OIDCHandler) AuthorizeSubmit(c *gin.Context) {
+	req, client, ok := h.authRequest(c, c.PostForm)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	src := loginSource(c)
+
+	var userID string
+	if tok := c.PostForm("mfa_token"); tok != "" {
+		id, err := h.Svc.Auth.PassMFA(ctx, tok, c.PostForm("code"), src)
+		if err != nil {
+			if errors.Is(err, ErrMFAInvalidCode) {
+				renderLogin(c, req, client, "Pogrešan kod.", tok)
+			} else {
+				renderLogin(c, req, client, "Prijava je istekla, pokušajte ponovo.", "")
+			}
+			return
+		}
+		userID = id
+	} else {
+		ident, err := h.Svc.Auth.Authenticate(ctx, c.PostForm("email"), c.PostForm("password"), src)
+		if err != nil {
+			var te *ThrottledError
+			if errors.As(err, &te) {
+				renderLogin(c, req, client, "Previše neuspešnih pokušaja. Pokušajte ponovo kasnije.", "")
+			} else if errors.Is(err, ErrAccountDisabled) {
+				renderLogin(c, req, client, "Nalog je deaktiviran.", "")
+			} else {
+				renderLogin(c, req, client, "Pogrešan email ili lozinka.", "")
+			}
+			return
+		}
+		ch, err := h.Svc.Auth.beginMFA(ctx, ident)
+		if err != nil {
+			redirectError(c, req, "server_error")
+			return
+		}
+		if ch != nil {
+			h.Svc.Auth.audit(ctx, ident.Email, ident.UserID, src, true, auditMFAPending)
+			if ch.Enroll {
+				// enrollment needs the portal, the consent page only verifies codes
+				renderLogin(c, req, client, "Za ovaj nalog je obavezna dvofaktorska autentifikacija. Podesite je prijavom na portal.", "")
+			} else {
+				renderLogin(c, req, client, "", ch.Token)
+			}
+			return
+		}
+		h.Svc.Auth.loginSucceeded(ctx, ident.Email, ident.UserID, src)
+		userID = ident.UserID
+	}
+
+	code, err := h.Svc.IssueCode(ctx, req, userID)
+	if err != nil {
+		redirectError(c, req, "server_error")
+		return
+	}
+	q := url.Values{"code": {code}}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	c.Redirect(http.StatusFound, withQuery(req.RedirectURI, q))
+}
+
+// renderLogin shows the password form, or the code form when mfaToken is set.
+func renderLogin(c *gin.Context, req AuthRequest, client OAuthClient, errMsg, mfaToken string) {
+	params := map[string]string{
+		"response_type":         "code",
+		"client_id":             req.ClientID,
+		"redirect_uri":          req.RedirectURI,
+		"scope":                 req.Scope,
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        req.CodeChallenge,
+		"code_challenge_method": req.CodeChallengeMethod,
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("X-Frame-Options", "DENY")
+	status := http.StatusOK
+	if errMsg != "" {
+		status = http.StatusUnauthorized
+	}
+	c.Status(status)
+	_ = loginPage.Execute(c.Writer, gin.H{
+		"ClientName": client.Name,
+		"Error":      errMsg,
+		"MFAToken":   mfaToken,
+		"Params":     params,
+	})
+}
+
+func redirectError(c *gin.Context, req AuthRequest, code string) {
+	q := url.Values{"error": {code}}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	c.Redirect(http.StatusFound, withQuery(req.RedirectURI, q))
+}
+
+func withQuery(uri string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(uri, "?") {
+		sep = "&"
+	}
+	return uri + sep + q.Encode()
+}
+
+func (h OIDCHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		toks, err := h.Svc.ExchangeCode(c.Request.Context(), clientID, clientSecret,
+			c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  toks.AccessToken,
+			"token_type":    "Bearer",
+			"expires_in":    toks.ExpiresIn,
+			"refresh_token": toks.RefreshToken,
+			"id_token":      toks.IDToken,
+			"scope":         toks.Scope,
+		})
+	case "refresh_token":
+		pair, err := h.Svc.RefreshTokens(c.Request.Context(), clientID, clientSecret, c.PostForm("refresh_token"))
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  pair.AccessToken,
+			"token_type":    "Bearer",
+			"expires_in":    pair.ExpiresIn,
+			"refresh_token": pair.RefreshToken,
+		})
+	case "client_credentials":
+		token, scopes, err := h.Svc.ClientCredentials(c.Request.Context(), clientID, clientSecret, c.PostForm("scope"))
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": token,
+			"token_type":   "Bearer",
+			"expires_in":   int(h.Svc.JWT.TTL.Seconds()),
+			"scope":        strings.Join(scopes, " "),
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+	}
+}
+
+func tokenError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidClient):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+	case errors.Is(err, ErrInvalidGrant):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+	case errors.Is(err, ErrInvalidScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope"})
+	case errors.Is(err, ErrUnauthorizedClient):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unauthorized_client"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+	}
+}
+
+func (h OIDCHandler) UserInfo(c *gin.Context) {
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	sub, _ := claims["sub"].(string)
+	ident, err := h.Svc.Auth.Identity(c.Request.Context(), sub)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+		return
+	}
+	// a client's token answers only for the scope the user granted it
+	ident.ClientID, _ = claims["azp"].(string)
+	ident.Scope, _ = claims["scope"].(string)
+	info := gin.H{"sub": ident.UserID}
+	for k, v := range profileClaims(ident) {
+		info[k] = v
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// RegisterClientReq registers either a sign-in client (redirect_uris) or a
+// confidential machine client (scopes), or a client that is both.
+type RegisterClientReq struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"omitempty,dive,url"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+func (h OIDCHandler) RegisterClient(c *gin.Context) {
+	var req RegisterClientReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if len(req.RedirectURIs) == 0 && len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect_uris or scopes required"})
+		return
+	}
+	for _, sc := range req.Scopes {
+		if !serviceScopes[sc] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope: " + sc})
+			return
+		}
+	}
+	if len(req.Scopes) > 0 && !req.Confidential {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "clients with scopes must be confidential"})
+		return
+	}
+	if req.RedirectURIs == nil {
+		req.RedirectURIs = []string{}
+	}
+	if req.Scopes == nil {
+		req.Scopes = []string{}
+	}
+	client, secret, err := h.Svc.RegisterClient(c.Request.Context(), req.Name, req.RedirectURIs, req.Scopes, req.Confidential)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	resp := gin.H{"client": client}
+	if secret != "" {
+		resp["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (h OIDCHandler) ListClients(c *gin.Context) {
+	clients, err := h.Svc.ListClients(c.Request.Context())
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, clients)
+}
+
+func (h OIDCHandler) DeleteClient(c *gin.Context) {
+	if err := h.Svc.DeleteClient(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, ErrUnknownClient) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "client not found"})
+		} else {
+			serverError(c, err)
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
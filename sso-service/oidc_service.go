@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const authCodeTTL = 2 * time.Minute
+
+var (
+	ErrUnknownClient = errors.New("unknown client")
+	ErrInvalidClient = errors.New("invalid client credentials")
+	ErrInvalidGrant  = errors.New("invalid grant")
+)
+
+// OAuthClient is an application registered to sign users in through the SSO,
+// or a machine client (no redirect URIs, only scopes) that uses the
+// client_credentials grant.
+type OAuthClient struct {
+	ClientID     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	secretHash   string
+}
+
+func (c OAuthClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// AuthRequest is a validated /authorize request waiting for the user to log in.
+type AuthRequest struct {
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OIDCTokens is the token endpoint response for an authorization code.
+type OIDCTokens struct {
+	TokenPair
+	IDToken string
+	Scope   string
+}
+
+type OIDCService struct {
+	DB   *pgxpool.Pool
+	Auth AuthService
+	JWT  Maker
+}
+
+func (s OIDCService) Client(ctx context.Context, clientID string) (OAuthClient, error) {
+	var c OAuthClient
+	var secretHash *string
+	q := `SELECT client_id, name, redirect_uris, scopes, client_secret_hash, created_at FROM oauth_clients WHERE client_id = $1`
+	if err := s.DB.QueryRow(ctx, q, clientID).Scan(&c.ClientID, &c.Name, &c.RedirectURIs, &c.Scopes, &secretHash, &c.CreatedAt); err != nil {
+		return OAuthClient{}, ErrUnknownClient
+	}
+	if secretHash != nil {
+		c.Confidential = true
+		c.secretHash = *secretHash
+	}
+	return c, nil
+}
+
+func (s OIDCService) ListClients(ctx context.Context) ([]OAuthClient, error) {
+	rows, err := s.DB.Query(ctx, `SELECT client_id, name, redirect_uris, scopes, client_secret_hash IS NOT NULL, created_at FROM oauth_clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	clients := []OAuthClient{}
+	for rows.Next() {
+		var c OAuthClient
+		if err = rows.Scan(&c.ClientID, &c.Name, &c.RedirectURIs, &c.Scopes, &c.Confidential, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		clients = append(clients, c)
+	}
+	return clients, rows.Err()
+}
+
+// RegisterClient stores a new client. Confidential clients get a secret that
+// is returned only here; public clients (SPAs, mobile apps) rely on PKCE alone.
+func (s OIDCService) RegisterClient(ctx context.Context, name string, redirectURIs, scopes []string, confidential bool) (OAuthClient, string, error) {
+	clientID, err := newRefreshToken()
+	if err != nil {
+		return OAuthClient{}, "", err
+	}
+	clientID = clientID[:22]
+	var secret string
+	var secretHash *string
+	if confidential {
+		if secret, err = newRefreshToken(); err != nil {
+			return OAuthClient{}, "", err
+		}
+		h, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return OAuthClient{}, "", err
+		}
+		hs := string(h)
+		secretHash = &hs
+	}
+	c := OAuthClient{ClientID: clientID, Name: name, RedirectURIs: redirectURIs, Scopes: scopes, Confidential: confidential}
+	q := `INSERT INTO oauth_clients (client_id, name, redirect_uris, scopes, client_secret_hash)
+	      VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	if err = s.DB.QueryRow(ctx, q, clientID, name, redirectURIs, scopes, secretHash).Scan(&c.CreatedAt); err != nil {
+		return OAuthClient{}, "", err
+	}
+	return c, secret, nil
+}
+
+func (s OIDCService) DeleteClient(ctx context.Context, clientID string) error {
+	tag, err := s.DB.Exec(ctx, `DELETE FROM oauth_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUnknownClient
+	}
+	return nil
+}
+
+// IssueCode creates a single-use authorization code for an authenticated user.
+func (s OIDCService) IssueCode(ctx context.Context, req AuthRequest, userID string) (string, error) {
+	code, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	q := `INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce,
+	                               code_challenge, code_challenge_method, expires_at)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = s.DB.Exec(ctx, q, hashToken(code), req.ClientID, userID, req.RedirectURI, req.Scope, req.Nonce,
+		req.CodeChallenge, req.CodeChallengeMethod, time.Now().Add(authCodeTTL))
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code at the token endpoint. The code
+// is consumed even if a later check fails, so it can never be replayed.
+func (s OIDCService) ExchangeCode(ctx context.Context, clientID, clientSecret, code, redirectURI, verifier string) (OIDCTokens, error) {
+	if _, err := s.authenticateClient(ctx, clientID, clientSecret); err != nil {
+		return OIDCTokens{}, err
+	}
+
+	var userID, codeRedirect, scope, nonce, challenge, method string
+	var authTime time.Time
+	q := `UPDATE oauth_codes SET used_at = now()
+	      WHERE code_hash = $1 AND client_id = $2 AND used_at IS NULL AND expires_at > now()
+	      RETURNING user_id, redirect_uri, scope, nonce, code_challenge, code_challenge_method, created_at`
+	if err := s.DB.QueryRow(ctx, q, hashToken(code), clientID).
+		Scan(&userID, &codeRedirect, &scope, &nonce, &challenge, &method, &authTime); err != nil {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+	if codeRedirect != redirectURI || !verifyPKCE(challenge, method, verifier) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+
+	ident, err := s.Auth.Identity(ctx, userID)
+	if errors.Is(err, ErrAccountDisabled) {
+		return OIDCTokens{}, ErrInvalidGrant
+	}
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	// the client's tokens carry only the OIDC scopes the user granted
+	ident.ClientID, ident.Scope = clientID, grantedScope(scope)
+	pair, err := s.Auth.startSession(ctx, ident)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	idToken, err := s.JWT.MakeIDToken(ident, clientID, nonce, authTime)
+	if err != nil {
+		return OIDCTokens{}, err
+	}
+	return OIDCTokens{TokenPair: pair, IDToken: idToken, Scope: ident.Scope}, nil
+}
+
+// RefreshTokens rotates a refresh token at the token endpoint. Like the code,
+// the token only works for the client it was issued to.
+func (s OIDCService) RefreshTokens(ctx context.Context, clientID, clientSecret, refreshToken string) (TokenPair, error) {
+	if _, err := s.authenticateClient(ctx, clientID, clientSecret); err != nil {
+		return TokenPair{}, err
+	}
+	pair, err := s.Auth.Refresh(ctx, refreshToken, clientID)
+	if errors.Is(err, ErrInvalidRefresh) {
+		err = ErrInvalidGrant
+	}
+	return pair, err
+}
+
+// authenticateClient checks the client's secret; public clients have none
+// and are identified by client_id alone.
+func (s OIDCService) authenticateClient(ctx context.Context, clientID, clientSecret string) (OAuthClient, error) {
+	client, err := s.Client(ctx, clientID)
+	if err != nil {
+		return OAuthClient{}, ErrInvalidClient
+	}
+	if client.Confidential && bcrypt.CompareHashAndPassword([]byte(client.secretHash), []byte(clientSecret)) != nil {
+		return OAuthClient{}, ErrInvalidClient
+	}
+	return client, nil
+}
+
+func verifyPKCE(challenge, method, verifier string) bool {
+	if method != "S256" || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 appendix B
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+	tests := []struct {
+		name                        string
+		challenge, method, verifier string
+		want                        bool
+	}{
+		{"S256", challenge, "S256", verifier, true},
+		{"wrong verifier", challenge, "S256", strings.Replace(verifier, "d", "e", 1), false},
+		{"plain method", verifier, "plain", verifier, false},
+		{"no method", challenge, "", verifier, false},
+		{"verifier as challenge", verifier, "S256", verifier, false},
+		{"empty challenge", "", "S256", verifier, false},
+		{"short verifier", challenge, "S256", verifier[:42], false},
+		{"long verifier", challenge, "S256", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		if got := verifyPKCE(tt.challenge, tt.method, tt.verifier); got != tt.want {
+			t.Errorf("%s: verifyPKCE = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log"
 	"time"
 
+	"github.com/exaring/otelpgx"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -13,7 +15,14 @@ func NewPool(dsn string) *pgxpool.Pool {
 	var err error
 
 	for i := 0; i < 10; i++ {
-		pool, err = pgxpool.New(context.Background(), dsn)
+		var cfg *pgxpool.Config
+		cfg, err = pgxpool.ParseConfig(dsn)
+		if err != nil {
+			log.Fatalf("invalid database url: %v", err)
+		}
+		// spans for every query; bound values stay out, they hold personal data
+		cfg.ConnConfig.Tracer = otelpgx.NewTracer()
+		pool, err = pgxpool.NewWithConfig(context.Background(), cfg)
 		if err == nil {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			err = pool.Ping(ctx)
@@ -30,32 +39,18 @@ func NewPool(dsn string) *pgxpool.Pool {
 		log.Fatal("db connection failed after retries:", err)
 	}
 
-	migrateSSO(pool)
 	return pool
 }
 
-func migrateSSO(pool *pgxpool.Pool) {
-	ctx := context.Background()
-	_, _ = pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS pgcrypto")
-
-	_, err := pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			role TEXT NOT NULL DEFAULT 'USER',
-			first_name TEXT NOT NULL DEFAULT '',
-			last_name TEXT NOT NULL DEFAULT '',
-			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		)
-	`)
-	if err == nil {
-		// add columns if they don't exist (upgrade from old schema)
-		pool.Exec(ctx, `ALTER TABLE users ADD COLUMN IF NOT EXISTS first_name TEXT NOT NULL DEFAULT ''`)
-		pool.Exec(ctx, `ALTER TABLE users ADD COLUMN IF NOT EXISTS last_name TEXT NOT NULL DEFAULT ''`)
+// migrateSSO applies pending migrations from migrations/ at startup.
+func migrateSSO(db *sql.DB) {
+	m, err := NewMigrator(db)
+	if err != nil {
+		log.Fatalf("SSO migration failed: %v", err)
 	}
+	n, err := m.Up(context.Background())
 	if err != nil {
 		log.Fatalf("SSO migration failed: %v", err)
 	}
-	log.Println("SSO DB schema migrated")
+	log.Printf("SSO DB schema migrated (%d new migrations)", n)
 }
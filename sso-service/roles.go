@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rolesColumn selects all roles of the user aliased as u.
+const rolesColumn = `ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = u.id ORDER BY ur.role)`
+
+// citizenRoles are the only roles available through self-registration.
+// Everything else in validRoles is granted by an administrator.
+var citizenRoles = map[string]bool{
+	"pacijent": true, "ucenik": true, "roditelj": true,
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrLastRole     = errors.New("user must keep at least one role")
+)
+
+func (s AuthService) Roles(ctx context.Context, userID string) ([]string, error) {
+	var roles []string
+	q := `SELECT ` + rolesColumn + ` FROM users u WHERE id = $1`
+	if err := s.DB.QueryRow(ctx, q, userID).Scan(&roles); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return roles, nil
+}
+
+// GrantRole adds a role to the user. With primary set the role also becomes
+// the one reported in the single "role" claim.
+func (s AuthService) GrantRole(ctx context.Context, userID, role, grantedBy string, primary bool) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id::text = $1)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	q := `INSERT INTO user_roles (user_id, role, granted_by) VALUES ($1, $2, NULLIF($3, '')::uuid)
+	      ON CONFLICT (user_id, role) DO NOTHING`
+	if _, err = tx.Exec(ctx, q, userID, role, grantedBy); err != nil {
+		return err
+	}
+	if primary {
+		if _, err = tx.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, role); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// RevokeRole removes a role. If it was the primary role, another remaining
+// role takes its place; the last role cannot be removed.
+func (s AuthService) RevokeRole(ctx context.Context, userID, role string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var primary string
+	if err = tx.QueryRow(ctx, `SELECT role FROM users WHERE id::text = $1 FOR UPDATE`, userID).Scan(&primary); err != nil {
+		return ErrUserNotFound
+	}
+	var remaining []string
+	q := `SELECT ARRAY(SELECT role FROM user_roles WHERE user_id = $1 AND role <> $2 ORDER BY granted_at)`
+	if err = tx.QueryRow(ctx, q, userID, role).Scan(&remaining); err != nil {
+		return err
+	}
+	if len(remaining) == 0 {
+		return ErrLastRole
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role); err != nil {
+		return err
+	}
+	if primary == role {
+		if _, err = tx.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, remaining[0]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// EnsureRoleByEmail grants a role to an existing account whose owner has
+// verified the email, used to bootstrap the first administrator. Missing and
+// unverified accounts are ignored.
+func (s AuthService) EnsureRoleByEmail(ctx context.Context, email, role string) (bool, error) {
+	var userID string
+	q := `SELECT id FROM users WHERE email = $1 AND email_verified_at IS NOT NULL`
+	if err := s.DB.QueryRow(ctx, q, email).Scan(&userID); err != nil {
+		return false, nil
+	}
+	return true, s.GrantRole(ctx, userID, role, "", false)
+}
+
+type RoleHandler struct {
+	Svc AuthService
+}
+
+type GrantRoleReq struct {
+	Role    string `json:"role" binding:"required"`
+	Primary bool   `json:"primary"`
+}
+
+func (h RoleHandler) List(c *gin.Context) {
+	roles, err := h.Svc.Roles(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": c.Param("id"), "roles": roles})
+}
+
+func (h RoleHandler) Grant(c *gin.Context) {
+	var req GrantRoleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if !validRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+		return
+	}
+	admin, _ := c.MustGet("claims").(jwt.MapClaims)["sub"].(string)
+	if err := h.Svc.GrantRole(c.Request.Context(), c.Param("id"), req.Role, admin, req.Primary); err != nil {
+		roleError(c, err)
+		return
+	}
+	h.List(c)
+}
+
+func (h RoleHandler) Revoke(c *gin.Context) {
+	if err := h.Svc.RevokeRole(c.Request.Context(), c.Param("id"), c.Param("role")); err != nil {
+		roleError(c, err)
+		return
+	}
+	h.List(c)
+}
+
+func roleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, ErrLastRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		serverError(c, err)
+	}
+}
@@ -1,28 +1,138 @@
 package main
 
 import (
-	"net/http"
+	"log"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Deps struct {
 	AuthHandler AuthHandler
-	JWTSecret   []byte
+	KeyHandler  KeyHandler
+	OIDCHandler OIDCHandler
+	RoleHandler RoleHandler
+	MFAHandler  MFAHandler
+	UserHandler UserHandler
+	// GuardianshipHandler serves parent-child links to school and health services.
+	GuardianshipHandler GuardianshipHandler
+	DelegationHandler   DelegationHandler
+	Keys                *KeyStore
+	Revocations         RevocationChecker
+	// TrustedProxies may set X-Forwarded-For; the client IP feeds the login throttle.
+	TrustedProxies []string
+	// ReadyChecks are the dependencies /readyz waits for.
+	ReadyChecks []Check
 }
 
 func New(deps Deps) *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery(), traceRequests("sso-service"), requestLog(), measureRequests())
+	if err := r.SetTrustedProxies(deps.TrustedProxies); err != nil {
+		log.Fatalf("trusted proxies: %v", err)
+	}
+
+	r.GET("/metrics", metricsHandler())
+	r.GET("/livez", livez("sso-service"))
+	r.GET("/readyz", readyz("sso-service", deps.ReadyChecks...))
+	// /health predates the split and answers like /readyz
+	r.GET("/health", readyz("sso-service", deps.ReadyChecks...))
+
+	r.GET("/.well-known/jwks.json", deps.KeyHandler.JWKS)
+	r.GET("/.well-known/openid-configuration", deps.OIDCHandler.Discovery)
 
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "sso-service"})
-	})
+	auth := Auth(deps.Keys, deps.Revocations, audienceSSO)
+	// OIDC clients reach the user's profile and nothing else
+	userinfo := Auth(deps.Keys, deps.Revocations, audienceSSO, audienceUserInfo)
+	// delegated tokens act in services only, never on the account itself
+	own := RejectDelegated()
+
+	// OpenID Connect provider
+	oidc := r.Group("")
+	{
+		oidc.GET("/authorize", deps.OIDCHandler.Authorize)
+		oidc.POST("/authorize", deps.OIDCHandler.AuthorizeSubmit)
+		oidc.POST("/oauth/token", deps.OIDCHandler.Token)
+		oidc.GET("/userinfo", userinfo, deps.OIDCHandler.UserInfo)
+		oidc.POST("/userinfo", userinfo, deps.OIDCHandler.UserInfo)
+	}
 
 	api := r.Group("")
 	{
 		api.POST("/register", deps.AuthHandler.Register)
 		api.POST("/login", deps.AuthHandler.Login)
-		api.GET("/verify", Auth(deps.JWTSecret), deps.AuthHandler.Verify)
+		api.POST("/login/mfa", deps.MFAHandler.Verify)
+		api.POST("/login/mfa/enroll", deps.MFAHandler.EnrollPending)
+		api.POST("/login/mfa/enroll/confirm", deps.MFAHandler.ConfirmPending)
+		api.POST("/refresh", deps.AuthHandler.Refresh)
+		api.POST("/logout", auth, own, deps.AuthHandler.Logout)
+		api.POST("/password/forgot", deps.AuthHandler.ForgotPassword)
+		api.POST("/password/reset", deps.AuthHandler.ResetPassword)
+		api.POST("/password/change", auth, own, deps.AuthHandler.ChangePassword)
+		api.POST("/email/verify", deps.AuthHandler.VerifyEmail)
+		api.POST("/email/verify/resend", auth, own, deps.AuthHandler.ResendVerification)
+		api.GET("/verify", auth, deps.AuthHandler.Verify)
+	}
+
+	// dvofaktorska autentifikacija (TOTP)
+	mfa := r.Group("/mfa", auth, own)
+	{
+		mfa.GET("", deps.MFAHandler.Status)
+		mfa.POST("/enroll", deps.MFAHandler.Enroll)
+		mfa.POST("/enroll/confirm", deps.MFAHandler.Confirm)
+		mfa.POST("/recovery-codes", deps.MFAHandler.RecoveryCodes)
+		mfa.DELETE("", deps.MFAHandler.Disable)
+	}
+
+	users := r.Group("/users", auth)
+	{
+		users.GET("/me", deps.UserHandler.Me)
+		users.PATCH("/me", own, deps.UserHandler.UpdateMe)
+		users.PUT("/me/jmbg", own, deps.UserHandler.SetJMBG)
+		users.GET("/me/wards", deps.GuardianshipHandler.Wards)
+		users.GET("/:id", deps.UserHandler.Get)
+		users.GET("/:id/guardians", deps.GuardianshipHandler.Guardians)
+		users.GET("", RequireRole(adminRoles...), deps.UserHandler.Search)
+	}
+
+	// starateljstvo: roditelj podnosi zahtev, šalter ga potvrđuje
+	guardianships := r.Group("/guardianships", auth, own)
+	{
+		guardianships.GET("", deps.GuardianshipHandler.List)
+		guardianships.POST("", deps.GuardianshipHandler.Request)
+		guardianships.DELETE("/:id", deps.GuardianshipHandler.Withdraw)
+	}
+
+	// punomoćja: korisnik ovlašćuje drugog da ga zastupa u izabranim servisima
+	delegations := r.Group("/delegations", auth, own)
+	{
+		delegations.GET("", deps.DelegationHandler.List)
+		delegations.POST("", deps.DelegationHandler.Grant)
+		delegations.DELETE("/:id", deps.DelegationHandler.Revoke)
+		delegations.POST("/:id/token", deps.DelegationHandler.Token)
+	}
+
+	admin := r.Group("/admin", auth, own, RequireRole(adminRoles...))
+	{
+		admin.POST("/keys/rotate", deps.KeyHandler.Rotate)
+		admin.GET("/clients", deps.OIDCHandler.ListClients)
+		admin.POST("/clients", deps.OIDCHandler.RegisterClient)
+		admin.DELETE("/clients/:id", deps.OIDCHandler.DeleteClient)
+		admin.GET("/users/:id/roles", deps.RoleHandler.List)
+		admin.POST("/users/:id/roles", deps.RoleHandler.Grant)
+		admin.DELETE("/users/:id/roles/:role", deps.RoleHandler.Revoke)
+		admin.DELETE("/users/:id/mfa", deps.MFAHandler.Reset)
+		admin.POST("/users/:id/email-verified", deps.AuthHandler.AdminVerifyEmail)
+		admin.POST("/users/:id/unlock", deps.AuthHandler.Unlock)
+		admin.POST("/users/:id/deactivate", deps.UserHandler.Deactivate)
+		admin.POST("/users/:id/activate", deps.UserHandler.Activate)
+		admin.POST("/users/:id/identity", deps.UserHandler.VerifyIdentity)
+		admin.GET("/guardianships", deps.GuardianshipHandler.AdminList)
+		admin.POST("/guardianships", deps.GuardianshipHandler.Add)
+		admin.POST("/guardianships/:id/verify", deps.GuardianshipHandler.Verify)
+		admin.DELETE("/guardianships/:id", deps.GuardianshipHandler.Revoke)
+		admin.GET("/login-audit", deps.AuthHandler.LoginAudit)
+		admin.GET("/mfa/roles", deps.MFAHandler.RequiredRoles)
+		admin.PUT("/mfa/roles", deps.MFAHandler.SetRequiredRoles)
 	}
 	return r
 }
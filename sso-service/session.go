@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrInvalidRefresh = errors.New("invalid refresh token")
+)
+
+// TokenPair is what a successful login or refresh hands back to the client.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(tok string) string {
+	h := sha256.Sum256([]byte(tok))
+	return hex.EncodeToString(h[:])
+}
+
+// startSession opens a new session for the user and issues the first token
+// pair. ident.ClientID is the OIDC client the session is issued to, empty
+// for the portal; only that client can refresh it, and its tokens keep the
+// scope the user granted.
+func (s AuthService) startSession(ctx context.Context, ident Identity) (TokenPair, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = tx.QueryRow(ctx, `INSERT INTO sessions (user_id, client_id, scope) VALUES ($1, NULLIF($2, ''), $3) RETURNING id`,
+		ident.UserID, ident.ClientID, ident.Scope).Scan(&ident.SessionID); err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := s.insertRefreshToken(ctx, tx, ident)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return TokenPair{}, err
+	}
+	return s.pair(ident, refresh)
+}
+
+func (s AuthService) insertRefreshToken(ctx context.Context, tx pgx.Tx, ident Identity) (string, error) {
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	q := `INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)
+	      VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, q, ident.SessionID, ident.UserID, hashToken(refresh), time.Now().Add(s.RefreshTTL)); err != nil {
+		return "", err
+	}
+	return refresh, nil
+}
+
+func (s AuthService) pair(ident Identity, refresh string) (TokenPair, error) {
+	access, err := s.JWTMaker.Make(ident)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int(s.AccessTTL.Seconds())}, nil
+}
+
+// Refresh rotates a refresh token: the presented token is consumed and a new
+// one is issued in the same session. Presenting an already consumed token is
+// treated as theft and revokes the whole session. clientID must be the client
+// the session was issued to, empty for the portal.
+func (s AuthService) Refresh(ctx context.Context, refreshToken, clientID string) (TokenPair, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var tokenID string
+	var expiresAt time.Time
+	var usedAt, sessionRevokedAt *time.Time
+	var ident Identity
+	q := `SELECT rt.id, rt.session_id, COALESCE(s.client_id, ''), s.scope, rt.expires_at, rt.used_at, s.revoked_at,
+	             u.id, u.email, u.role, ` + rolesColumn + `, u.first_name, u.last_name, u.email_verified_at IS NOT NULL,
+	             u.ial
+	      FROM refresh_tokens rt
+	      JOIN sessions s ON s.id = rt.session_id
+	      JOIN users u ON u.id = rt.user_id
+	      WHERE rt.token_hash = $1 AND u.deactivated_at IS NULL
+	      FOR UPDATE OF rt`
+	err = tx.QueryRow(ctx, q, hashToken(refreshToken)).Scan(&tokenID, &ident.SessionID, &ident.ClientID, &ident.Scope, &expiresAt, &usedAt,
+		&sessionRevokedAt, &ident.UserID, &ident.Email, &ident.Role, &ident.Roles, &ident.FirstName, &ident.LastName, &ident.EmailVerified,
+		&ident.IAL)
+	if err != nil {
+		return TokenPair{}, ErrInvalidRefresh
+	}
+	if ident.ClientID != clientID || sessionRevokedAt != nil || time.Now().After(expiresAt) {
+		return TokenPair{}, ErrInvalidRefresh
+	}
+	if usedAt != nil {
+		// reuse of a rotated token: kill the session and everything issued from it
+		if _, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1`, ident.SessionID); err != nil {
+			return TokenPair{}, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrInvalidRefresh
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE id = $1`, tokenID); err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := s.insertRefreshToken(ctx, tx, ident)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return TokenPair{}, err
+	}
+	return s.pair(ident, refresh)
+}
+
+// Logout revokes the access token identified by jti and the session it
+// belongs to. With all set, every session of the user is revoked.
+func (s AuthService) Logout(ctx context.Context, userID, jti, sessionID string, exp time.Time, all bool) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if jti != "" {
+		q := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+		if _, err = tx.Exec(ctx, q, jti, exp); err != nil {
+			return err
+		}
+	}
+	if all {
+		_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	} else if sessionID != "" {
+		_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, sessionID, userID)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// IsRevoked reports whether an access token was revoked, either directly by
+// its jti or through its session.
+func (s AuthService) IsRevoked(ctx context.Context, jti, sessionID string) (bool, error) {
+	var revoked bool
+	if err := s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).
+		Scan(&revoked); err != nil || revoked {
+		return revoked, err
+	}
+	if sessionID == "" {
+		return false, nil
+	}
+	err := s.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE id::text = $1 AND revoked_at IS NOT NULL)`, sessionID).
+		Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are looked up by name in three places, first match wins: the
+// environment, the file named by NAME_FILE (Docker secrets) and the YAML file
+// named by CONFIG_FILE, a flat map of the same names. Every lookup is
+// recorded, so the effective configuration can be validated and logged.
+
+type setting struct {
+	Value  string
+	Source string // env, file, yaml or default
+	Secret bool
+}
+
+var (
+	settingsMu sync.Mutex
+	settings   = map[string]setting{}
+	yamlValues map[string]string
+	configErrs []error
+)
+
+// devSecrets are the credentials shipped for local development in compose
+// files and examples; production refuses them like built-in defaults.
+var devSecrets = map[string]bool{
+	"dev-school-secret": true,
+	"sso_pass":          true,
+	"school_pass":       true,
+	"health_pass":       true,
+	"events_pass":       true,
+}
+
+func lookup(key string) (value, source string) {
+	if v := os.Getenv(key); v != "" {
+		return v, "env"
+	}
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			configErrs = append(configErrs, fmt.Errorf("%s_FILE: %w", key, err))
+			return "", ""
+		}
+		return strings.TrimRight(string(b), "\r\n"), "file"
+	}
+	if yamlValues == nil {
+		yamlValues = loadYAML(os.Getenv("CONFIG_FILE"))
+	}
+	if v := yamlValues[key]; v != "" {
+		return v, "yaml"
+	}
+	return "", ""
+}
+
+func loadYAML(path string) map[string]string {
+	values := map[string]string{}
+	if path == "" {
+		return values
+	}
+	b, err := os.ReadFile(path)
+	if err == nil {
+		var raw map[string]any
+		if err = yaml.Unmarshal(b, &raw); err == nil {
+			for k, v := range raw {
+				values[strings.ToUpper(k)] = yamlString(v)
+			}
+		}
+	}
+	if err != nil {
+		configErrs = append(configErrs, fmt.Errorf("CONFIG_FILE %s: %w", path, err))
+	}
+	return values
+}
+
+// yamlString flattens a YAML value to its environment form; lists become
+// comma-separated, as TRUSTED_PROXIES expects.
+func yamlString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func readSetting(key, def string, secret bool) string {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	v, src := lookup(key)
+	if src == "" {
+		v, src = def, "default"
+	}
+	settings[key] = setting{Value: v, Source: src, Secret: secret}
+	return v
+}
+
+func getEnv(key, def string) string {
+	return readSetting(key, def, false)
+}
+
+// getSecret reads a credential: it is redacted when logged, and production
+// refuses the built-in default.
+func getSecret(key, def string) string {
+	return readSetting(key, def, true)
+}
+
+func getIntEnv(key string, def int) int {
+	v := getEnv(key, strconv.Itoa(def))
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		configError("%s: %q is not a positive whole number", key, v)
+		return def
+	}
+	return n
+}
+
+func getBoolEnv(key string, def bool) bool {
+	v := getEnv(key, strconv.FormatBool(def))
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		configError("%s: %q is not true or false", key, v)
+		return def
+	}
+	return b
+}
+
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	v := getEnv(key, def.String())
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		configError("%s: %q is not a duration such as 30s or 5m", key, v)
+		return def
+	}
+	return d
+}
+
+func getListEnv(key, def string) []string {
+	var out []string
+	for _, v := range strings.Split(getEnv(key, def), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// configError records an invalid setting; finishConfig reports them all at
+// once instead of stopping at the first.
+func configError(format string, args ...any) {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	configErrs = append(configErrs, fmt.Errorf(format, args...))
+}
+
+// production is set with APP_ENV=production; it turns development defaults
+// into startup errors.
+func production() bool {
+	return getEnv("APP_ENV", "development") == "production"
+}
+
+// checkConfig returns every invalid setting seen so far and, in production,
+// every secret still at a development value.
+func checkConfig() error {
+	prod := production()
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	errs := append([]error(nil), configErrs...)
+	if prod {
+		for _, key := range settingKeys() {
+			s := settings[key]
+			if !s.Secret || s.Value == "" {
+				continue
+			}
+			if s.Source == "default" || devSecrets[secretPart(s.Value)] {
+				errs = append(errs, fmt.Errorf("%s: development secret is not allowed with APP_ENV=production", key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// finishConfig is called by Load once every setting has been read: it stops
+// the service on invalid settings and logs the effective configuration.
+func finishConfig() {
+	if err := checkConfig(); err != nil {
+		slog.Error("invalid configuration", "errors", strings.Split(err.Error(), "\n"))
+		os.Exit(1)
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	var attrs []any
+	for _, key := range settingKeys() {
+		s := settings[key]
+		attrs = append(attrs, slog.Group(key, "value", s.display(), "source", s.Source))
+	}
+	slog.Info("configuration loaded", slog.Group("config", attrs...))
+}
+
+func settingKeys() []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// secretPart is the password of a URL value, or the value itself.
+func secretPart(v string) string {
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		p, _ := u.User.Password()
+		return p
+	}
+	return v
+}
+
+// display hides secrets; URLs keep everything but their password.
+func (s setting) display() string {
+	if u, err := url.Parse(s.Value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	if s.Secret && s.Value != "" {
+		return "[redacted]"
+	}
+	return s.Value
+}
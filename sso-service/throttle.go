@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Failures below this count are free, so a couple of typos never slow anyone down.
+const freeLoginFailures = 2
+
+// LoginSource describes where a login attempt came from.
+type LoginSource struct {
+	IP        string
+	UserAgent string
+}
+
+// ThrottledError is returned while an account or client address is blocked.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// LoginThrottle tracks failed logins per account and per client address.
+// Accounts are keyed by email rather than user ID, so an address without an
+// account is throttled exactly like a real one.
+type LoginThrottle struct {
+	DB            *pgxpool.Pool
+	MaxFailures   int           // per account, before the full lockout
+	IPMaxFailures int           // per address, before the full lockout
+	BaseDelay     time.Duration // first backoff step, doubled on every failure
+	Lockout       time.Duration // also how long failures are remembered
+}
+
+func accountKey(email string) string { return "email:" + strings.ToLower(strings.TrimSpace(email)) }
+func addressKey(ip string) string    { return "ip:" + ip }
+
+// Check returns how long the caller must wait, or zero if the attempt may proceed.
+func (t LoginThrottle) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	var until *time.Time
+	q := `SELECT max(blocked_until) FROM login_throttle WHERE key = ANY($1) AND blocked_until > now()`
+	if err := t.DB.QueryRow(ctx, q, keys).Scan(&until); err != nil || until == nil {
+		return 0, err
+	}
+	return time.Until(*until), nil
+}
+
+// Fail records a failed attempt. Accounts back off exponentially and are
+// locked after MaxFailures; addresses are only locked at IPMaxFailures, since
+// a whole school can sit behind one NAT.
+func (t LoginThrottle) Fail(ctx context.Context, key string) error {
+	var failures int
+	q := `INSERT INTO login_throttle (key, failures, last_failure_at) VALUES ($1, 1, now())
+	      ON CONFLICT (key) DO UPDATE SET
+	          failures = CASE WHEN login_throttle.last_failure_at < $2 THEN 1 ELSE login_throttle.failures + 1 END,
+	          last_failure_at = now()
+	      RETURNING failures`
+	if err := t.DB.QueryRow(ctx, q, key, time.Now().Add(-t.Lockout)).Scan(&failures); err != nil {
+		return err
+	}
+	var d time.Duration
+	if strings.HasPrefix(key, "ip:") {
+		if failures >= t.IPMaxFailures {
+			d = t.Lockout
+		}
+	} else {
+		d = t.delay(failures)
+	}
+	if d == 0 {
+		return nil
+	}
+	_, err := t.DB.Exec(ctx, `UPDATE login_throttle SET blocked_until = $2 WHERE key = $1`, key, time.Now().Add(d))
+	return err
+}
+
+func (t LoginThrottle) delay(failures int) time.Duration {
+	if failures >= t.MaxFailures {
+		return t.Lockout
+	}
+	if failures <= freeLoginFailures {
+		return 0
+	}
+	// doubled one step at a time and only while under Lockout, so a long run
+	// of failures cannot overflow into a short or negative delay
+	d := t.BaseDelay
+	for n := failures - freeLoginFailures - 1; n > 0 && d < t.Lockout; n-- {
+		d *= 2
+	}
+	return min(d, t.Lockout)
+}
+
+// Reset clears the failures of a key, after a successful login or an admin unlock.
+func (t LoginThrottle) Reset(ctx context.Context, key string) error {
+	_, err := t.DB.Exec(ctx, `DELETE FROM login_throttle WHERE key = $1`, key)
+	return err
+}
+
+// LoginAuditEntry is one row of the login audit log.
+type LoginAuditEntry struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	UserID    *string   `json:"user_id"`
+	ActorID   *string   `json:"actor_id,omitempty"` // delegate, for tokens issued under a delegation
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Reasons stored in login_audit.
+const (
+	auditOK          = "ok"
+	auditMFAPending  = "mfa_pending"
+	auditBadPassword = "invalid_credentials"
+	auditThrottled   = "throttled"
+	auditBadMFACode  = "invalid_mfa_code"
+	auditDelegated   = "delegated"
+)
+
+func (s AuthService) audit(ctx context.Context, email, userID string, src LoginSource, success bool, reason string) {
+	q := `INSERT INTO login_audit (email, user_id, ip, user_agent, success, reason)
+	      VALUES ($1, NULLIF($2, '')::uuid, $3, $4, $5, $6)`
+	_, _ = s.DB.Exec(ctx, q, strings.ToLower(email), userID, src.IP, src.UserAgent, success, reason)
+	countLogin(success, reason)
+}
+
+// LoginAudit lists recent attempts, newest first, optionally for one email.
+func (s AuthService) LoginAudit(ctx context.Context, email string, limit int) ([]LoginAuditEntry, error) {
+	q := `SELECT id, email, user_id::text, actor_id::text, ip, user_agent, success, reason, created_at
+	      FROM login_audit WHERE $1 = '' OR email = $1
+	      ORDER BY id DESC LIMIT $2`
+	rows, err := s.DB.Query(ctx, q, strings.ToLower(email), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []LoginAuditEntry{}
+	for rows.Next() {
+		var e LoginAuditEntry
+		if err = rows.Scan(&e.ID, &e.Email, &e.UserID, &e.ActorID, &e.IP, &e.UserAgent, &e.Success, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Unlock clears the lockout of a user's account.
+func (s AuthService) Unlock(ctx context.Context, userID string) error {
+	var email string
+	if err := s.DB.QueryRow(ctx, `SELECT email FROM users WHERE id::text = $1`, userID).Scan(&email); err != nil {
+		return ErrUserNotFound
+	}
+	return s.Throttle.Reset(ctx, accountKey(email))
+}
+
+func loginSource(c *gin.Context) LoginSource {
+	return LoginSource{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+func throttled(c *gin.Context, e *ThrottledError) {
+	secs := int(e.RetryAfter.Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, try again later", "retry_after": secs})
+}
+
+func (h AuthHandler) Unlock(c *gin.Context) {
+	if err := h.Svc.Unlock(c.Request.Context(), c.Param("id")); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h AuthHandler) LoginAudit(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	entries, err := h.Svc.LoginAudit(c.Request.Context(), c.Query("email"), limit)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
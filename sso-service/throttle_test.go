@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleDelay(t *testing.T) {
+	th := LoginThrottle{MaxFailures: 10, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{freeLoginFailures, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{9, 64 * time.Second},
+		{10, 15 * time.Minute},
+		{11, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := th.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottleDelayNeverWraps(t *testing.T) {
+	// with a high MaxFailures the backoff alone must hold the line
+	th := LoginThrottle{MaxFailures: 1 << 20, BaseDelay: time.Second, Lockout: 15 * time.Minute}
+	prev := time.Duration(0)
+	for failures := freeLoginFailures + 1; failures <= 1000; failures++ {
+		d := th.delay(failures)
+		if d < prev || d <= 0 || d > th.Lockout {
+			t.Fatalf("delay(%d) = %s after %s; want between the previous delay and %s", failures, d, prev, th.Lockout)
+		}
+		prev = d
+	}
+	for _, failures := range []int{64, 65, 100, 1<<20 - 1} {
+		if got := th.delay(failures); got != th.Lockout {
+			t.Errorf("delay(%d) = %s, want the lockout %s", failures, got, th.Lockout)
+		}
+	}
+}
@@ -1,11 +1,304 @@
 package main
 
-import "time"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type User struct {
-	ID           string    `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"-"`
+	Role          string     `json:"role"`
+	Roles         []string   `json:"roles"`
+	FirstName     string     `json:"first_name"`
+	LastName      string     `json:"last_name"`
+	EmailVerified bool       `json:"email_verified"`
+	MFAEnabled    bool       `json:"mfa_enabled"`
+	JMBG          *string    `json:"jmbg"`
+	BirthDate     *time.Time `json:"birth_date"`
+	IAL           int        `json:"ial"`
+	// IdentityVerifiedAt is set when an official checked the ID document.
+	IdentityVerifiedAt *time.Time `json:"identity_verified_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	DeactivatedAt      *time.Time `json:"deactivated_at,omitempty"`
+}
+
+// UserSummary is what staff of other services may see about any user.
+type UserSummary struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+}
+
+// UserFilter narrows the admin user search. Query matches email and names.
+type UserFilter struct {
+	Query  string
+	Role   string
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+var ErrAccountDisabled = errors.New("account is deactivated")
+
+const userColumns = `u.id, u.email, u.role, ` + rolesColumn + `, u.first_name, u.last_name,
+	u.email_verified_at IS NOT NULL,
+	EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.confirmed_at IS NOT NULL),
+	u.jmbg, u.birth_date, u.ial, u.identity_verified_at, u.created_at, u.deactivated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.Role, &u.Roles, &u.FirstName, &u.LastName,
+		&u.EmailVerified, &u.MFAEnabled, &u.JMBG, &u.BirthDate, &u.IAL, &u.IdentityVerifiedAt,
+		&u.CreatedAt, &u.DeactivatedAt)
+	return u, err
+}
+
+func (s AuthService) User(ctx context.Context, userID string) (User, error) {
+	u, err := scanUser(s.DB.QueryRow(ctx, `SELECT `+userColumns+` FROM users u WHERE u.id::text = $1`, userID))
+	if err != nil {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// UpdateProfile changes the user's name. Nil values keep the current one.
+// Names of a verified identity come from the ID document and stay fixed.
+func (s AuthService) UpdateProfile(ctx context.Context, userID string, firstName, lastName *string) (User, error) {
+	var ial int
+	if err := s.DB.QueryRow(ctx, `SELECT ial FROM users WHERE id::text = $1`, userID).Scan(&ial); err != nil {
+		return User{}, ErrUserNotFound
+	}
+	if ial >= ialVerified && (firstName != nil || lastName != nil) {
+		return User{}, ErrIdentityVerified
+	}
+	q := `UPDATE users SET first_name = COALESCE($2, first_name), last_name = COALESCE($3, last_name)
+	      WHERE id::text = $1`
+	if _, err := s.DB.Exec(ctx, q, userID, firstName, lastName); err != nil {
+		return User{}, err
+	}
+	return s.User(ctx, userID)
+}
+
+// SearchUsers returns one page of users and the total number of matches.
+func (s AuthService) SearchUsers(ctx context.Context, f UserFilter) ([]User, int, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	if f.Query != "" {
+		args = append(args, "%"+f.Query+"%")
+		n := strconv.Itoa(len(args))
+		where = append(where, "(u.email ILIKE $"+n+" OR u.first_name ILIKE $"+n+" OR u.last_name ILIKE $"+n+
+			" OR (u.first_name || ' ' || u.last_name) ILIKE $"+n+")")
+	}
+	if f.Role != "" {
+		args = append(args, f.Role)
+		where = append(where, "EXISTS (SELECT 1 FROM user_roles r WHERE r.user_id = u.id AND r.role = $"+strconv.Itoa(len(args))+")")
+	}
+	if f.Active != nil {
+		if *f.Active {
+			where = append(where, "u.deactivated_at IS NULL")
+		} else {
+			where = append(where, "u.deactivated_at IS NOT NULL")
+		}
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := s.DB.QueryRow(ctx, `SELECT count(*) FROM users u WHERE `+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	args = append(args, f.Limit, f.Offset)
+	q := `SELECT ` + userColumns + ` FROM users u WHERE ` + cond +
+		` ORDER BY u.last_name, u.first_name, u.email LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+	rows, err := s.DB.Query(ctx, q, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// SetActive deactivates or reactivates an account. Deactivation revokes all
+// sessions, so existing tokens stop working right away.
+func (s AuthService) SetActive(ctx context.Context, userID string, active bool) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	q := `UPDATE users SET deactivated_at = CASE WHEN $2 THEN NULL ELSE COALESCE(deactivated_at, now()) END
+	      WHERE id::text = $1`
+	tag, err := tx.Exec(ctx, q, userID, active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if !active {
+		if _, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id::text = $1 AND revoked_at IS NULL`, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// IsActive reports whether the account exists and is not deactivated.
+func (s AuthService) IsActive(ctx context.Context, userID string) (bool, error) {
+	var active bool
+	q := `SELECT EXISTS (SELECT 1 FROM users WHERE id::text = $1 AND deactivated_at IS NULL)`
+	err := s.DB.QueryRow(ctx, q, userID).Scan(&active)
+	return active, err
+}
+
+type UserHandler struct {
+	Svc AuthService
+}
+
+type UpdateProfileReq struct {
+	FirstName *string `json:"first_name" binding:"omitempty,min=1,max=100"`
+	LastName  *string `json:"last_name" binding:"omitempty,min=1,max=100"`
+}
+
+func (h UserHandler) Me(c *gin.Context) {
+	u, err := h.Svc.User(c.Request.Context(), claimsSub(c))
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+func (h UserHandler) UpdateMe(c *gin.Context) {
+	var req UpdateProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	u, err := h.Svc.UpdateProfile(c.Request.Context(), claimsSub(c), req.FirstName, req.LastName)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// Get returns the full record to admins and a summary to staff of other
+// services, who need names of patients, students and colleagues. Citizens
+// may only look up themselves.
+func (h UserHandler) Get(c *gin.Context) {
+	claims := c.MustGet("claims").(jwt.MapClaims)
+	id := c.Param("id")
+	u, err := h.Svc.User(c.Request.Context(), id)
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	switch {
+	case hasAnyRole(claims, adminRoles...):
+		c.JSON(http.StatusOK, u)
+	case claimsSub(c) == id || hasStaffRole(claims):
+		c.JSON(http.StatusOK, UserSummary{ID: u.ID, FirstName: u.FirstName, LastName: u.LastName, Role: u.Role})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	}
+}
+
+func (h UserHandler) Search(c *gin.Context) {
+	f := UserFilter{Query: strings.TrimSpace(c.Query("q")), Role: c.Query("role"), Limit: 50}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+		f.Limit = l
+	}
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o >= 0 {
+		f.Offset = o
+	}
+	if a := c.Query("active"); a != "" {
+		active := a == "true"
+		f.Active = &active
+	}
+	users, total, err := h.Svc.SearchUsers(c.Request.Context(), f)
+	if err != nil {
+		serverError(c, err)
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(http.StatusOK, users)
+}
+
+func (h UserHandler) Deactivate(c *gin.Context) {
+	if c.Param("id") == claimsSub(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot deactivate your own account"})
+		return
+	}
+	h.setActive(c, false)
+}
+
+func (h UserHandler) Activate(c *gin.Context) {
+	h.setActive(c, true)
+}
+
+func (h UserHandler) setActive(c *gin.Context, active bool) {
+	if err := h.Svc.SetActive(c.Request.Context(), c.Param("id"), active); err != nil {
+		userError(c, err)
+		return
+	}
+	u, err := h.Svc.User(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		userError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+func hasAnyRole(claims jwt.MapClaims, roles ...string) bool {
+	for _, r := range roles {
+		if hasRole(claims, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasStaffRole reports whether the token holds any role beyond the citizen ones.
+func hasStaffRole(claims jwt.MapClaims) bool {
+	for r := range validRoles {
+		if !citizenRoles[r] && hasRole(claims, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, ErrInvalidJMBG):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrJMBGTaken), errors.Is(err, ErrIdentityVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		serverError(c, err)
+	}
 }